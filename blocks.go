@@ -0,0 +1,137 @@
+package main
+
+import (
+    "log/slog"
+    "net/http"
+    "time"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+    "github.com/sudonetizen/problem"
+)
+
+// a blocked, muted or requesting user
+type relation_res struct {
+    User_id    uuid.UUID `json:"user_id"`
+    Username   string    `json:"username"`
+    Created_at time.Time `json:"created_at"`
+}
+
+// authenticates the caller and parses the other user from the path,
+// on failure the problem is written and ok is false
+func (cfg *apiConfig) relationUsers(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return uuid.Nil, uuid.Nil, false}
+
+    other, err := uuid.Parse(r.PathValue("userID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidID, "user id is invalid"))
+        return uuid.Nil, uuid.Nil, false
+    }
+    if other == userid {
+        slog.WarnContext(r.Context(), "error with relation: self")
+        problem.Write(w, r, problem.Validation(problem.FieldError{Field: "userID", Code: "self", Message: "user must not be yourself"}))
+        return uuid.Nil, uuid.Nil, false
+    }
+
+    return userid, other, true
+}
+
+// writes the result of creating a relation, a missing user is 404
+func writeRelation(w http.ResponseWriter, r *http.Request, err error) {
+    if isForeignKeyViolation(err) {
+        slog.WarnContext(r.Context(), "error with relation: user not found", "error", err)
+        problem.Write(w, r, problem.New(404, problem.NotFound, "user does not exist"))
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with relation", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    w.WriteHeader(204)
+}
+
+// handles -> put /api/blocks/{userID}
+func (cfg *apiConfig) handlerBlock(w http.ResponseWriter, r *http.Request) {
+    userid, other, ok := cfg.relationUsers(w, r)
+    if !ok {return}
+
+    // blocking ends follows and follow requests both ways
+    err := cfg.withTx(r.Context(), func(q *database.Queries) error {
+        err := q.CreateBlock(r.Context(), database.CreateBlockParams{BlockerID: userid, BlockedID: other})
+        if err != nil {return err}
+
+        return q.DeleteFollowsBetween(r.Context(), database.DeleteFollowsBetweenParams{A: userid, B: other})
+    })
+    writeRelation(w, r, err)
+}
+
+// handles -> delete /api/blocks/{userID}
+func (cfg *apiConfig) handlerUnblock(w http.ResponseWriter, r *http.Request) {
+    userid, other, ok := cfg.relationUsers(w, r)
+    if !ok {return}
+
+    err := cfg.db.DeleteBlock(r.Context(), database.DeleteBlockParams{BlockerID: userid, BlockedID: other})
+    writeRelation(w, r, err)
+}
+
+// handles -> get /api/blocks
+func (cfg *apiConfig) handlerGetBlocks(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    rows, err := cfg.db.GetBlocks(r.Context(), userid)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting blocks", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    list := []relation_res{}
+    for _, row := range rows {list = append(list, relation_res{row.ID, row.Username.String, row.CreatedAt})}
+    writeJSON(w, r, 200, list)
+}
+
+// handles -> put /api/mutes/{userID}
+func (cfg *apiConfig) handlerMute(w http.ResponseWriter, r *http.Request) {
+    userid, other, ok := cfg.relationUsers(w, r)
+    if !ok {return}
+
+    err := cfg.db.CreateMute(r.Context(), database.CreateMuteParams{MuterID: userid, MutedID: other})
+    writeRelation(w, r, err)
+}
+
+// handles -> delete /api/mutes/{userID}
+func (cfg *apiConfig) handlerUnmute(w http.ResponseWriter, r *http.Request) {
+    userid, other, ok := cfg.relationUsers(w, r)
+    if !ok {return}
+
+    err := cfg.db.DeleteMute(r.Context(), database.DeleteMuteParams{MuterID: userid, MutedID: other})
+    writeRelation(w, r, err)
+}
+
+// handles -> get /api/mutes
+func (cfg *apiConfig) handlerGetMutes(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    rows, err := cfg.db.GetMutes(r.Context(), userid)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting mutes", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    list := []relation_res{}
+    for _, row := range rows {list = append(list, relation_res{row.ID, row.Username.String, row.CreatedAt})}
+    writeJSON(w, r, 200, list)
+}
+
+// the caller of an optionally authenticated request, uuid.Nil when anonymous,
+// a bad token is still an error
+func (cfg *apiConfig) viewer(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+    if r.Header.Get("Authorization") == "" {return uuid.Nil, true}
+    return cfg.authUser(w, r)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+    "database/sql"
+    "errors"
+    "log/slog"
+    "net/http"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+    "github.com/sudonetizen/problem"
+)
+
+// chirps per page of bookmarks and list feeds
+const (
+    defaultChirpPage = 50
+    maxChirpPage     = 100
+)
+
+// writes chirps in the shape of get /api/chirps, attachments, quotes and
+// polls as viewer sees them included
+func (cfg *apiConfig) writeChirps(w http.ResponseWriter, r *http.Request, viewer uuid.UUID, chirps []database.Chirp) {
+    list := []chirp_res{}
+    for _, ch := range chirps {list = append(list, toChirpRes(ch))}
+
+    err := cfg.withMedia(r.Context(), cfg.db, list)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting chirp media", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    err = cfg.withViewer(r.Context(), viewer, list)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting quotes and polls", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    writeJSON(w, r, 200, list)
+}
+
+// authenticates the caller and parses the chirp from the path,
+// on failure the problem is written and ok is false
+func (cfg *apiConfig) bookmarkChirp(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return uuid.Nil, uuid.Nil, false}
+
+    id, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidID, "chirp id is invalid"))
+        return uuid.Nil, uuid.Nil, false
+    }
+
+    return userid, id, true
+}
+
+// handles -> put /api/bookmarks/{chirpID}
+func (cfg *apiConfig) handlerBookmark(w http.ResponseWriter, r *http.Request) {
+    userid, chirpid, ok := cfg.bookmarkChirp(w, r)
+    if !ok {return}
+
+    // only chirps the caller can see can be bookmarked
+    _, err := cfg.db.GetChirpForViewer(r.Context(), database.GetChirpForViewerParams{ID: chirpid, ViewerID: userid})
+    if err == nil {err = cfg.db.CreateBookmark(r.Context(), database.CreateBookmarkParams{UserID: userid, ChirpID: chirpid})}
+
+    // deleted between the two queries
+    if errors.Is(err, sql.ErrNoRows) || isForeignKeyViolation(err) {
+        slog.WarnContext(r.Context(), "error with bookmarking: chirp not found", "error", err)
+        problem.Write(w, r, problem.New(404, problem.NotFound, "chirp does not exist"))
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with bookmarking", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    w.WriteHeader(204)
+}
+
+// handles -> delete /api/bookmarks/{chirpID}
+func (cfg *apiConfig) handlerUnbookmark(w http.ResponseWriter, r *http.Request) {
+    userid, chirpid, ok := cfg.bookmarkChirp(w, r)
+    if !ok {return}
+
+    err := cfg.db.DeleteBookmark(r.Context(), database.DeleteBookmarkParams{UserID: userid, ChirpID: chirpid})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with deleting bookmark", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    w.WriteHeader(204)
+}
+
+// handles -> get /api/bookmarks
+func (cfg *apiConfig) handlerGetBookmarks(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    // paging with ?before=<last chirp id seen>&limit=
+    before, limit, ok := page(w, r, defaultChirpPage, maxChirpPage)
+    if !ok {return}
+
+    chirps, err := cfg.db.GetBookmarks(r.Context(), database.GetBookmarksParams{UserID: userid, BeforeID: before, MaxRows: limit})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting bookmarks", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    cfg.writeChirps(w, r, userid, chirps)
+}
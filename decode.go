@@ -0,0 +1,105 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "strconv"
+    "github.com/google/uuid"
+    "github.com/lib/pq"
+    "github.com/sudonetizen/moderation"
+    "github.com/sudonetizen/problem"
+    "github.com/sudonetizen/validate"
+)
+
+// decodes exactly one json value from the body, unknown fields and
+// anything after the value are rejected
+func decodeJSON(r *http.Request, v any) error {
+    decoder := json.NewDecoder(r.Body)
+    decoder.DisallowUnknownFields()
+
+    err := decoder.Decode(v)
+    if err != nil {return err}
+
+    // only whitespace may follow
+    err = decoder.Decode(&struct{}{})
+    if err != io.EOF {
+        mbErr := &http.MaxBytesError{}
+        if errors.As(err, &mbErr) {return err}
+        return errors.New("body must hold a single json value")
+    }
+
+    return nil
+}
+
+// problem for a decode error, 413 when the body hit the size limit
+func decodeProblem(err error) *problem.Problem {
+    mbErr := &http.MaxBytesError{}
+    if errors.As(err, &mbErr) {return problem.New(413, problem.BodyTooLarge, fmt.Sprintf("body is larger than %d bytes", mbErr.Limit))}
+    return problem.New(400, problem.InvalidJSON, err.Error())
+}
+
+// problem listing every invalid field of a payload
+func validationProblem(err error) *problem.Problem {
+    errs := validate.Errors{}
+    if !errors.As(err, &errs) {return problem.New(400, problem.ValidationFailed, err.Error())}
+
+    fields := []problem.FieldError{}
+    for _, fe := range errs {
+        fields = append(fields, problem.FieldError{Field: fe.Field, Code: fe.Code, Message: fe.Message})
+    }
+    return problem.Validation(fields...)
+}
+
+// true when err is a unique constraint violation, e.g. a taken email
+func isUniqueViolation(err error) bool {
+    pqErr := &pq.Error{}
+    return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// true when err is a foreign key violation, e.g. a user that does not exist
+func isForeignKeyViolation(err error) bool {
+    pqErr := &pq.Error{}
+    return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// maps a moderation error to a problem, a rejected body is invalid
+func moderationProblem(err error) *problem.Problem {
+    if errors.Is(err, moderation.ErrRejected) {
+        return problem.Validation(problem.FieldError{Field: "body", Code: "rejected", Message: err.Error()})
+    }
+    return problem.New(500, problem.Internal, "")
+}
+
+// parses ?before=<last id seen>&limit= of a paged list, limit defaults to def,
+// on failure the problem is written and ok is false
+func page(w http.ResponseWriter, r *http.Request, def, max int) (uuid.NullUUID, int32, bool) {
+    before := uuid.NullUUID{}
+    bVal := r.URL.Query().Get("before")
+    if bVal != "" {
+        id, err := uuid.Parse(bVal)
+        if err != nil {
+            slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+            problem.Write(w, r, problem.New(400, problem.InvalidQuery, "before is not a valid id"))
+            return before, 0, false
+        }
+        before = uuid.NullUUID{UUID: id, Valid: true}
+    }
+
+    limit := def
+    lVal := r.URL.Query().Get("limit")
+    if lVal != "" {
+        n, err := strconv.Atoi(lVal)
+        if err != nil || n < 1 || n > max {
+            slog.WarnContext(r.Context(), "error with parsing limit", "limit", lVal)
+            problem.Write(w, r, problem.New(400, problem.InvalidQuery, fmt.Sprintf("limit must be between 1 and %d", max)))
+            return before, 0, false
+        }
+        limit = n
+    }
+
+    return before, int32(limit), true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+    "context"
+    "html/template"
+    "log/slog"
+    "net/http"
+    "slices"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+    "github.com/sudonetizen/digest"
+    "github.com/sudonetizen/problem"
+)
+
+var digestFrequencies = []string{digest.Off, digest.Daily, digest.Weekly}
+
+type digest_settings struct {
+    Frequency string `json:"frequency"`
+}
+
+// mail scanners open links in emails, so the link only shows a form and the
+// post from it or from the mail client's unsubscribe button does the work
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+{{if .Done}}<p>You will not get Chirpy digests anymore.</p>
+{{else}}<form method="post" action="/api/digest/unsubscribe?token={{.Token}}">
+<p>Stop getting Chirpy digests by email?</p>
+<button type="submit">Unsubscribe</button>
+</form>
+{{end}}</body>
+</html>
+`))
+
+// records activity, users active lately get no digest
+func (cfg *apiConfig) touchActive(ctx context.Context, userID uuid.UUID) {
+    err := cfg.db.TouchUserActive(ctx, userID)
+    if err != nil {slog.ErrorContext(ctx, "error with touching user activity", "error", err)}
+}
+
+// handles -> get /api/digest/settings
+func (cfg *apiConfig) handlerGetDigest(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    u, err := cfg.db.GetDigestUser(r.Context(), userid)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting digest settings", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    writeJSON(w, r, 200, digest_settings{u.DigestFrequency})
+}
+
+// handles -> put /api/digest/settings
+func (cfg *apiConfig) handlerUpdateDigest(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    req := digest_settings{}
+    err := decodeJSON(r, &req)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with decoding", "error", err)
+        problem.Write(w, r, decodeProblem(err))
+        return
+    }
+    if !slices.Contains(digestFrequencies, req.Frequency) {
+        slog.WarnContext(r.Context(), "error with validating digest frequency", "frequency", req.Frequency)
+        problem.Write(w, r, problem.Validation(problem.FieldError{Field: "frequency", Code: "invalid", Message: "must be off, daily or weekly"}))
+        return
+    }
+
+    freq, err := cfg.db.SetDigestFrequency(r.Context(), database.SetDigestFrequencyParams{ID: userid, DigestFrequency: req.Frequency})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with updating digest settings", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    writeJSON(w, r, 200, digest_settings{freq})
+}
+
+// handles -> get and post /api/digest/unsubscribe?token=, needs no login
+func (cfg *apiConfig) handlerUnsubscribe(w http.ResponseWriter, r *http.Request) {
+    token := r.URL.Query().Get("token")
+    if token == "" {
+        slog.WarnContext(r.Context(), "error with unsubscribing: missing token")
+        problem.Write(w, r, problem.New(400, problem.InvalidQuery, "token is required"))
+        return
+    }
+
+    data := struct {
+        Token string
+        Done  bool
+    }{Token: token}
+
+    if r.Method == http.MethodPost {
+        n, err := cfg.db.UnsubscribeDigest(r.Context(), token)
+        if err != nil {
+            slog.ErrorContext(r.Context(), "error with unsubscribing", "error", err)
+            problem.Write(w, r, problem.New(500, problem.Internal, ""))
+            return
+        }
+        if n == 0 {
+            slog.WarnContext(r.Context(), "error with unsubscribing: unknown token")
+            problem.Write(w, r, problem.New(404, problem.NotFound, "unsubscribe link is invalid"))
+            return
+        }
+        data.Done = true
+    }
+
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.WriteHeader(200)
+    err := unsubscribePage.Execute(w, data)
+    if err != nil {slog.ErrorContext(r.Context(), "error with writing unsubscribe page", "error", err)}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+    "database/sql"
+    "errors"
+    "log/slog"
+    "net/http"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+    "github.com/sudonetizen/problem"
+)
+
+type follow_res struct {
+    User_id uuid.UUID `json:"user_id"`
+    Status  string    `json:"status"`
+}
+
+// handles -> put /api/follows/{userID}
+func (cfg *apiConfig) handlerFollow(w http.ResponseWriter, r *http.Request) {
+    userid, other, ok := cfg.relationUsers(w, r)
+    if !ok {return}
+
+    // private accounts get a pending request, blocks are checked by the query
+    row, err := cfg.db.CreateFollow(r.Context(), database.CreateFollowParams{FollowerID: userid, FolloweeID: other})
+    if errors.Is(err, sql.ErrNoRows) {
+        _, err = cfg.db.GetUser(r.Context(), other)
+        if errors.Is(err, sql.ErrNoRows) {
+            slog.WarnContext(r.Context(), "error with following: user not found")
+            problem.Write(w, r, problem.New(404, problem.NotFound, "user does not exist"))
+            return
+        }
+        if err == nil {
+            slog.WarnContext(r.Context(), "error with following: blocked")
+            problem.Write(w, r, problem.New(403, problem.Forbidden, "you can not follow this user"))
+            return
+        }
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with following", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    // repeating the request does not notify again
+    if row.Created {
+        kind := notifyFollow
+        if row.Status == "pending" {kind = notifyFollowRequest}
+        cfg.notify(r.Context(), other, kind, userid, other)
+    }
+
+    writeJSON(w, r, 200, follow_res{other, row.Status})
+}
+
+// handles -> delete /api/follows/{userID}, also withdraws a pending request
+func (cfg *apiConfig) handlerUnfollow(w http.ResponseWriter, r *http.Request) {
+    userid, other, ok := cfg.relationUsers(w, r)
+    if !ok {return}
+
+    err := cfg.db.DeleteFollow(r.Context(), database.DeleteFollowParams{FollowerID: userid, FolloweeID: other})
+    writeRelation(w, r, err)
+}
+
+// handles -> get /api/follows/requests
+func (cfg *apiConfig) handlerGetFollowRequests(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    rows, err := cfg.db.GetFollowRequests(r.Context(), userid)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting follow requests", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    list := []relation_res{}
+    for _, row := range rows {list = append(list, relation_res{row.ID, row.Username.String, row.CreatedAt})}
+    writeJSON(w, r, 200, list)
+}
+
+// handles -> post /api/follows/requests/{userID}/approve
+func (cfg *apiConfig) handlerApproveFollow(w http.ResponseWriter, r *http.Request) {
+    userid, other, ok := cfg.relationUsers(w, r)
+    if !ok {return}
+
+    n, err := cfg.db.AcceptFollow(r.Context(), database.AcceptFollowParams{FollowerID: other, FolloweeID: userid})
+    if err == nil && n > 0 {cfg.notify(r.Context(), other, notifyFollowAccepted, userid, other)}
+    writeFollowRequest(w, r, n, err)
+}
+
+// handles -> post /api/follows/requests/{userID}/deny
+func (cfg *apiConfig) handlerDenyFollow(w http.ResponseWriter, r *http.Request) {
+    userid, other, ok := cfg.relationUsers(w, r)
+    if !ok {return}
+
+    n, err := cfg.db.DenyFollow(r.Context(), database.DenyFollowParams{FollowerID: other, FolloweeID: userid})
+    writeFollowRequest(w, r, n, err)
+}
+
+// writes the result of answering a follow request, no pending request is 404
+func writeFollowRequest(w http.ResponseWriter, r *http.Request, n int64, err error) {
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with answering follow request", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+    if n == 0 {
+        slog.WarnContext(r.Context(), "error with answering follow request: not found")
+        problem.Write(w, r, problem.New(404, problem.NotFound, "follow request does not exist"))
+        return
+    }
+
+    w.WriteHeader(204)
+}
@@ -6,16 +6,98 @@ replace github.com/sudonetizen/database v0.0.0 => ./internal/database/
 
 replace github.com/sudonetizen/auth v0.0.0 => ./internal/auth/
 
+replace github.com/sudonetizen/outbox v0.0.0 => ./internal/outbox/
+
+replace github.com/sudonetizen/jobs v0.0.0 => ./internal/jobs/
+
+replace github.com/sudonetizen/janitor v0.0.0 => ./internal/janitor/
+
+replace github.com/sudonetizen/stream v0.0.0 => ./internal/stream/
+
+replace github.com/sudonetizen/metrics v0.0.0 => ./internal/metrics/
+
+replace github.com/sudonetizen/logging v0.0.0 => ./internal/logging/
+
+replace github.com/sudonetizen/tracing v0.0.0 => ./internal/tracing/
+
+replace github.com/sudonetizen/health v0.0.0 => ./internal/health/
+
+replace github.com/sudonetizen/config v0.0.0 => ./internal/config/
+
+replace github.com/sudonetizen/problem v0.0.0 => ./internal/problem/
+
+replace github.com/sudonetizen/validate v0.0.0 => ./internal/validate/
+
+replace github.com/sudonetizen/storage v0.0.0 => ./internal/storage/
+
+replace github.com/sudonetizen/media v0.0.0 => ./internal/media/
+
+replace github.com/sudonetizen/moderation v0.0.0 => ./internal/moderation/
+
+replace github.com/sudonetizen/mailer v0.0.0 => ./internal/mailer/
+
+replace github.com/sudonetizen/digest v0.0.0 => ./internal/digest/
+
 require github.com/sudonetizen/database v0.0.0
 
 require (
 	github.com/google/uuid v1.6.0
+	github.com/gorilla/websocket v1.5.3
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.9
+	github.com/prometheus/client_golang v1.22.0
 	github.com/sudonetizen/auth v0.0.0
+	github.com/sudonetizen/config v0.0.0
+	github.com/sudonetizen/digest v0.0.0
+	github.com/sudonetizen/health v0.0.0
+	github.com/sudonetizen/janitor v0.0.0
+	github.com/sudonetizen/jobs v0.0.0
+	github.com/sudonetizen/logging v0.0.0
+	github.com/sudonetizen/mailer v0.0.0
+	github.com/sudonetizen/media v0.0.0
+	github.com/sudonetizen/metrics v0.0.0
+	github.com/sudonetizen/moderation v0.0.0
+	github.com/sudonetizen/outbox v0.0.0
+	github.com/sudonetizen/problem v0.0.0
+	github.com/sudonetizen/storage v0.0.0
+	github.com/sudonetizen/stream v0.0.0
+	github.com/sudonetizen/tracing v0.0.0
+	github.com/sudonetizen/validate v0.0.0
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.60.0
+	go.opentelemetry.io/otel v1.35.0
+	go.opentelemetry.io/otel/trace v1.35.0
 )
 
 require (
+	github.com/BurntSushi/toml v1.5.0 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cenkalti/backoff/v4 v4.3.0 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/felixge/httpsnoop v1.0.4 // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.26.1 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.62.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	github.com/rivo/uniseg v0.4.7 // indirect
+	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace v1.35.0 // indirect
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.35.0 // indirect
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.35.0 // indirect
+	go.opentelemetry.io/otel/metric v1.35.0 // indirect
+	go.opentelemetry.io/otel/sdk v1.35.0 // indirect
+	go.opentelemetry.io/proto/otlp v1.5.0 // indirect
 	golang.org/x/crypto v0.41.0 // indirect
+	golang.org/x/image v0.27.0 // indirect
+	golang.org/x/net v0.42.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20250218202821-56aae31c358a // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250218202821-56aae31c358a // indirect
+	google.golang.org/grpc v1.71.0 // indirect
+	google.golang.org/protobuf v1.36.5 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,63 @@
+package main
+
+import (
+    "context"
+    "embed"
+    "errors"
+    "fmt"
+    "io/fs"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/sudonetizen/health"
+)
+
+// migrations shipped with this binary, readiness fails until they are applied
+//go:embed sql/schema/*.sql
+var schemaFS embed.FS
+
+// newest migration version, taken from the NNN_ file name prefix
+func latestMigration() (int64, error) {
+    files, err := fs.Glob(schemaFS, "sql/schema/*.sql")
+    if err != nil {return 0, err}
+
+    latest := int64(0)
+    for _, f := range files {
+        prefix, _, _ := strings.Cut(strings.TrimPrefix(f, "sql/schema/"), "_")
+        v, err := strconv.ParseInt(prefix, 10, 64)
+        if err != nil {return 0, fmt.Errorf("migration %s has no version prefix", f)}
+        latest = max(latest, v)
+    }
+
+    return latest, nil
+}
+
+// checks behind /api/readyz
+func (cfg *apiConfig) readiness() *health.Checker {
+    c := health.New(2 * time.Second)
+
+    c.Add("database", func(ctx context.Context) (string, error) {
+        return "", cfg.conn.PingContext(ctx)
+    })
+
+    c.Add("migrations", func(ctx context.Context) (string, error) {
+        want, err := latestMigration()
+        if err != nil {return "", err}
+
+        // goose keeps applied versions in goose_db_version
+        have := int64(0)
+        err = cfg.conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied").Scan(&have)
+        if err != nil {return "", err}
+
+        detail := fmt.Sprintf("database at %d, binary expects %d", have, want)
+        if have < want {return detail, errors.New("migrations are pending")}
+        return detail, nil
+    })
+
+    c.Add("draining", func(ctx context.Context) (string, error) {
+        if cfg.draining.Load() {return "", errors.New("server is shutting down")}
+        return "", nil
+    })
+
+    return c
+}
@@ -45,16 +45,27 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+    userID, _, err := ValidateJWTExpiry(tokenString, tokenSecret)
+    return userID, err
+}
+
+// ValidateJWTExpiry also returns when the token expires, for connections
+// that outlive a single request
+func ValidateJWTExpiry(tokenString, tokenSecret string) (uuid.UUID, time.Time, error) {
     token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {return []byte(tokenSecret), nil})
-    if err != nil {return uuid.Nil, err}
+    if err != nil {return uuid.Nil, time.Time{}, err}
     
     claims, ok := token.Claims.(*jwt.RegisteredClaims)
-    if !ok {return uuid.Nil, fmt.Errorf("invalid token\n")}
+    if !ok {return uuid.Nil, time.Time{}, fmt.Errorf("invalid token\n")}
 
     userID, err := uuid.Parse(claims.Subject)
-    if err != nil {return uuid.Nil, err}
+    if err != nil {return uuid.Nil, time.Time{}, err}
+
+    // zero time for tokens without an expiry
+    expires := time.Time{}
+    if claims.ExpiresAt != nil {expires = claims.ExpiresAt.Time}
 
-    return userID, nil
+    return userID, expires, nil
 }
 
 func GetBearerToken(h http.Header) (string, error) {
@@ -32,5 +32,10 @@ func TestMakeJWTAndValidateJWT(t *testing.T) {
         if err != nil {t.Errorf("error with ValidateJWT: %v\n", err)}
 
         if tst.userID != pip {t.Errorf("not equal")}
+
+        _, exp, err := ValidateJWTExpiry(tkn, tst.tokenS)
+        if err != nil {t.Errorf("error with ValidateJWTExpiry: %v\n", err)}
+
+        if time.Until(exp) > tst.expire || time.Until(exp) < tst.expire - 2 * time.Second {t.Errorf("unexpected expiry %v", exp)}
     }
 }
@@ -0,0 +1,547 @@
+package config
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "net/mail"
+    "net/url"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/BurntSushi/toml"
+    "gopkg.in/yaml.v3"
+    "github.com/sudonetizen/jobs"
+)
+
+// sources of a value, later ones win
+const (
+    SourceDefault = "default"
+    SourceFile    = "file"
+    SourceEnv     = "env"
+    SourceFlag    = "flag"
+)
+
+const redacted = "[redacted]"
+
+type Server struct {
+    Addr              string
+    PublicURL         string
+    FileserverRoot    string
+    ShutdownDelay     time.Duration
+    ShutdownTimeout   time.Duration
+    ReadHeaderTimeout time.Duration
+    ReadTimeout       time.Duration
+    WriteTimeout      time.Duration
+    IdleTimeout       time.Duration
+    MaxHeaderBytes    int
+    MaxBodyBytes      int
+}
+
+type Database struct {
+    URL string
+}
+
+type Auth struct {
+    Secret          string
+    PolkaKey        string
+    AccessTokenTTL  time.Duration
+    RefreshTokenTTL time.Duration
+}
+
+type Users struct {
+    UsernameCooldown time.Duration
+}
+
+type Chirps struct {
+    MaxLength     int
+    MaxPins       int
+    MaxPinsRed    int
+    PollsSchedule string
+}
+
+type Messages struct {
+    MaxLength    int
+    MaxGroupSize int
+}
+
+type Media struct {
+    Storage       string
+    Dir           string
+    S3Endpoint    string
+    S3Bucket      string
+    S3Region      string
+    S3AccessKey   string
+    S3SecretKey   string
+    MaxBytes      int
+    MaxDimension  int
+    ThumbnailSize int
+    MaxFrames     int
+    MaxPixels     int
+}
+
+type Mail struct {
+    Backend      string
+    Dir          string
+    From         string
+    SMTPAddr     string
+    SMTPUsername string
+    SMTPPassword string
+}
+
+type Digest struct {
+    Schedule      string
+    InactiveAfter time.Duration
+    BatchSize     int
+}
+
+type Log struct {
+    Format string
+    Level  string
+}
+
+type Tracing struct {
+    Exporter string
+}
+
+type Outbox struct {
+    WebhookURL string
+}
+
+type Stream struct {
+    Bus string
+}
+
+type Janitor struct {
+    Schedule              string
+    RevokedTokenRetention time.Duration
+    JobRetention          time.Duration
+    OutboxRetention       time.Duration
+}
+
+// Config is the resolved configuration of the server
+type Config struct {
+    Server   Server
+    Database Database
+    Auth     Auth
+    Users    Users
+    Chirps   Chirps
+    Messages Messages
+    Media    Media
+    Mail     Mail
+    Digest   Digest
+    Log      Log
+    Tracing  Tracing
+    Outbox   Outbox
+    Stream   Stream
+    Janitor  Janitor
+
+    // file the values were read from, empty without one
+    File string
+
+    sources map[string]string
+}
+
+// Value is one resolved setting as shown on the admin endpoint
+type Value struct {
+    Value  string `json:"value"`
+    Source string `json:"source"`
+}
+
+// one setting, key is used in config files and as flag name
+type field struct {
+    key    string
+    env    string
+    def    string
+    usage  string
+    secret bool
+    set    func(c *Config, val string) error
+    get    func(c *Config) string
+}
+
+func str(p func(c *Config) *string) (func(*Config, string) error, func(*Config) string) {
+    set := func(c *Config, val string) error {
+        *p(c) = val
+        return nil
+    }
+    return set, func(c *Config) string {return *p(c)}
+}
+
+// one of a few names, stored lowercased since everything reading it compares exactly
+func enum(p func(c *Config) *string) (func(*Config, string) error, func(*Config) string) {
+    set := func(c *Config, val string) error {
+        *p(c) = strings.ToLower(strings.TrimSpace(val))
+        return nil
+    }
+    return set, func(c *Config) string {return *p(c)}
+}
+
+func integer(p func(c *Config) *int) (func(*Config, string) error, func(*Config) string) {
+    set := func(c *Config, val string) error {
+        n, err := strconv.Atoi(val)
+        if err != nil {return fmt.Errorf("%q is not an integer", val)}
+        *p(c) = n
+        return nil
+    }
+    return set, func(c *Config) string {return strconv.Itoa(*p(c))}
+}
+
+func duration(p func(c *Config) *time.Duration) (func(*Config, string) error, func(*Config) string) {
+    set := func(c *Config, val string) error {
+        d, err := time.ParseDuration(val)
+        if err != nil {return fmt.Errorf("%q is not a duration like 90s or 1h", val)}
+        *p(c) = d
+        return nil
+    }
+    return set, func(c *Config) string {return p(c).String()}
+}
+
+func fields() []field {
+    fs := []field{}
+    add := func(key, env, def, usage string, secret bool, set func(*Config, string) error, get func(*Config) string) {
+        fs = append(fs, field{key: key, env: env, def: def, usage: usage, secret: secret, set: set, get: get})
+    }
+
+    s, g := str(func(c *Config) *string {return &c.Server.Addr})
+    add("server.addr", "ADDR", ":8080", "address the server listens on", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Server.PublicURL})
+    add("server.public_url", "PUBLIC_URL", "http://localhost:8080", "url clients reach the server at, used in emails", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Server.FileserverRoot})
+    add("server.fileserver_root", "FILESERVER_ROOT", ".", "directory served under /app/", false, s, g)
+    s, g = duration(func(c *Config) *time.Duration {return &c.Server.ShutdownDelay})
+    add("server.shutdown_delay", "SHUTDOWN_DELAY", "0s", "time readiness fails before connections are drained", false, s, g)
+    s, g = duration(func(c *Config) *time.Duration {return &c.Server.ShutdownTimeout})
+    add("server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "30s", "time in-flight requests get to finish on shutdown", false, s, g)
+    s, g = duration(func(c *Config) *time.Duration {return &c.Server.ReadHeaderTimeout})
+    add("server.read_header_timeout", "READ_HEADER_TIMEOUT", "5s", "time a client gets to send request headers", false, s, g)
+    s, g = duration(func(c *Config) *time.Duration {return &c.Server.ReadTimeout})
+    add("server.read_timeout", "READ_TIMEOUT", "15s", "time a client gets to send the whole request", false, s, g)
+    s, g = duration(func(c *Config) *time.Duration {return &c.Server.WriteTimeout})
+    add("server.write_timeout", "WRITE_TIMEOUT", "30s", "time a response may take, streams are exempt", false, s, g)
+    s, g = duration(func(c *Config) *time.Duration {return &c.Server.IdleTimeout})
+    add("server.idle_timeout", "IDLE_TIMEOUT", "120s", "time an idle keep-alive connection stays open", false, s, g)
+    s, g = integer(func(c *Config) *int {return &c.Server.MaxHeaderBytes})
+    add("server.max_header_bytes", "MAX_HEADER_BYTES", "16384", "largest request headers accepted", false, s, g)
+    s, g = integer(func(c *Config) *int {return &c.Server.MaxBodyBytes})
+    add("server.max_body_bytes", "MAX_BODY_BYTES", "65536", "largest json request body accepted", false, s, g)
+
+    s, g = str(func(c *Config) *string {return &c.Database.URL})
+    add("database.url", "DB_URL", "", "postgres connection url", true, s, g)
+
+    s, g = str(func(c *Config) *string {return &c.Auth.Secret})
+    add("auth.secret", "SECRET", "", "key signing access tokens", true, s, g)
+    s, g = str(func(c *Config) *string {return &c.Auth.PolkaKey})
+    add("auth.polka_key", "POLKA", "", "api key of polka webhooks", true, s, g)
+    s, g = duration(func(c *Config) *time.Duration {return &c.Auth.AccessTokenTTL})
+    add("auth.access_token_ttl", "ACCESS_TOKEN_TTL", "1h", "lifetime of access tokens", false, s, g)
+    s, g = duration(func(c *Config) *time.Duration {return &c.Auth.RefreshTokenTTL})
+    add("auth.refresh_token_ttl", "REFRESH_TOKEN_TTL", "1440h", "lifetime of refresh tokens", false, s, g)
+
+    s, g = duration(func(c *Config) *time.Duration {return &c.Users.UsernameCooldown})
+    add("users.username_cooldown", "USERNAME_COOLDOWN", "720h", "time between two username changes", false, s, g)
+
+    s, g = integer(func(c *Config) *int {return &c.Chirps.MaxLength})
+    add("chirps.max_length", "MAX_CHIRP_LENGTH", "140", "longest chirp body accepted", false, s, g)
+    s, g = integer(func(c *Config) *int {return &c.Chirps.MaxPins})
+    add("chirps.max_pins", "MAX_PINS", "1", "chirps a user can pin to their profile", false, s, g)
+    s, g = integer(func(c *Config) *int {return &c.Chirps.MaxPinsRed})
+    add("chirps.max_pins_red", "MAX_PINS_RED", "5", "chirps a chirpy red user can pin to their profile", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Chirps.PollsSchedule})
+    add("chirps.polls_schedule", "POLLS_SCHEDULE", "* * * * *", "cron spec of the job notifying voters of closed polls", false, s, g)
+
+    s, g = integer(func(c *Config) *int {return &c.Messages.MaxLength})
+    add("messages.max_length", "MAX_MESSAGE_LENGTH", "1000", "longest direct message body accepted", false, s, g)
+    s, g = integer(func(c *Config) *int {return &c.Messages.MaxGroupSize})
+    add("messages.max_group_size", "MAX_GROUP_SIZE", "10", "most participants of a conversation, the creator included", false, s, g)
+
+    s, g = enum(func(c *Config) *string {return &c.Media.Storage})
+    add("media.storage", "MEDIA_STORAGE", "filesystem", "where uploads are kept, filesystem or s3", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Media.Dir})
+    add("media.dir", "MEDIA_DIR", "media", "directory of the filesystem storage", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Media.S3Endpoint})
+    add("media.s3_endpoint", "MEDIA_S3_ENDPOINT", "", "url of the s3 compatible service", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Media.S3Bucket})
+    add("media.s3_bucket", "MEDIA_S3_BUCKET", "", "bucket uploads are stored in", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Media.S3Region})
+    add("media.s3_region", "MEDIA_S3_REGION", "us-east-1", "region requests are signed for", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Media.S3AccessKey})
+    add("media.s3_access_key", "MEDIA_S3_ACCESS_KEY", "", "s3 access key id", true, s, g)
+    s, g = str(func(c *Config) *string {return &c.Media.S3SecretKey})
+    add("media.s3_secret_key", "MEDIA_S3_SECRET_KEY", "", "s3 secret access key", true, s, g)
+    s, g = integer(func(c *Config) *int {return &c.Media.MaxBytes})
+    add("media.max_bytes", "MEDIA_MAX_BYTES", "5242880", "largest upload accepted", false, s, g)
+    s, g = integer(func(c *Config) *int {return &c.Media.MaxDimension})
+    add("media.max_dimension", "MEDIA_MAX_DIMENSION", "4096", "longest image side accepted in pixels", false, s, g)
+    s, g = integer(func(c *Config) *int {return &c.Media.ThumbnailSize})
+    add("media.thumbnail_size", "MEDIA_THUMBNAIL_SIZE", "320", "longest thumbnail side in pixels", false, s, g)
+    s, g = integer(func(c *Config) *int {return &c.Media.MaxFrames})
+    add("media.max_frames", "MEDIA_MAX_FRAMES", "200", "most frames of a gif accepted", false, s, g)
+    s, g = integer(func(c *Config) *int {return &c.Media.MaxPixels})
+    add("media.max_pixels", "MEDIA_MAX_PIXELS", "50000000", "most pixels of all gif frames together", false, s, g)
+
+    s, g = enum(func(c *Config) *string {return &c.Mail.Backend})
+    add("mail.backend", "MAIL_BACKEND", "file", "how email is sent, file or smtp", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Mail.Dir})
+    add("mail.dir", "MAIL_DIR", "mail", "directory the file backend writes .eml files to", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Mail.From})
+    add("mail.from", "MAIL_FROM", "Chirpy <no-reply@chirpy.local>", "sender address of emails", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Mail.SMTPAddr})
+    add("mail.smtp_addr", "SMTP_ADDR", "", "host:port of the smtp server", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Mail.SMTPUsername})
+    add("mail.smtp_username", "SMTP_USERNAME", "", "smtp login, empty sends without auth", false, s, g)
+    s, g = str(func(c *Config) *string {return &c.Mail.SMTPPassword})
+    add("mail.smtp_password", "SMTP_PASSWORD", "", "smtp password", true, s, g)
+
+    s, g = str(func(c *Config) *string {return &c.Digest.Schedule})
+    add("digest.schedule", "DIGEST_SCHEDULE", "@hourly", "cron spec of the job looking for due digests", false, s, g)
+    s, g = duration(func(c *Config) *time.Duration {return &c.Digest.InactiveAfter})
+    add("digest.inactive_after", "DIGEST_INACTIVE_AFTER", "72h", "time without activity before a user gets digests", false, s, g)
+    s, g = integer(func(c *Config) *int {return &c.Digest.BatchSize})
+    add("digest.batch_size", "DIGEST_BATCH_SIZE", "500", "most digests enqueued per run", false, s, g)
+
+    s, g = enum(func(c *Config) *string {return &c.Log.Format})
+    add("log.format", "LOG_FORMAT", "text", "log format, text or json", false, s, g)
+    s, g = enum(func(c *Config) *string {return &c.Log.Level})
+    add("log.level", "LOG_LEVEL", "info", "lowest level logged, debug, info, warn or error", false, s, g)
+
+    s, g = enum(func(c *Config) *string {return &c.Tracing.Exporter})
+    add("tracing.exporter", "OTEL_TRACES_EXPORTER", "none", "trace exporter, none, stdout or otlp", false, s, g)
+
+    s, g = str(func(c *Config) *string {return &c.Outbox.WebhookURL})
+    add("outbox.webhook_url", "OUTBOX_WEBHOOK_URL", "", "url outbox events are posted to", false, s, g)
+
+    s, g = enum(func(c *Config) *string {return &c.Stream.Bus})
+    add("stream.bus", "STREAM_BUS", "local", "bus sharing stream events, local or postgres", false, s, g)
+
+    s, g = str(func(c *Config) *string {return &c.Janitor.Schedule})
+    add("janitor.schedule", "JANITOR_SCHEDULE", "@hourly", "cron spec of the cleanup job", false, s, g)
+    s, g = duration(func(c *Config) *time.Duration {return &c.Janitor.RevokedTokenRetention})
+    add("janitor.revoked_token_retention", "REVOKED_TOKEN_RETENTION", "168h", "time revoked refresh tokens are kept", false, s, g)
+    s, g = duration(func(c *Config) *time.Duration {return &c.Janitor.JobRetention})
+    add("janitor.job_retention", "JOB_RETENTION", "168h", "time done and dead jobs are kept", false, s, g)
+    s, g = duration(func(c *Config) *time.Duration {return &c.Janitor.OutboxRetention})
+    add("janitor.outbox_retention", "OUTBOX_RETENTION", "24h", "time relayed outbox events are kept", false, s, g)
+
+    return fs
+}
+
+// Load resolves the configuration from defaults, a yaml or toml file, env
+// and flags in that order, the file is given by -config or CONFIG. It returns
+// the arguments left after the flags, flag.ErrHelp is returned for -h
+func Load(args []string, getenv func(string) string, out io.Writer) (*Config, []string, error) {
+    fields := fields()
+
+    fset := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+    fset.SetOutput(out)
+    file := fset.String("config", "", "yaml or toml config file (env CONFIG)")
+    flagVals := map[string]*string{}
+    for _, f := range fields {
+        flagVals[f.key] = fset.String(f.key, "", fmt.Sprintf("%s (env %s, default %q)", f.usage, f.env, f.def))
+    }
+
+    err := fset.Parse(args)
+    if err != nil {return nil, nil, err}
+
+    c := &Config{File: *file, sources: map[string]string{}}
+    if c.File == "" {c.File = getenv("CONFIG")}
+
+    // defaults
+    for _, f := range fields {
+        err := f.set(c, f.def)
+        if err != nil {return nil, nil, fmt.Errorf("default of %s: %w", f.key, err)}
+        c.sources[f.key] = SourceDefault
+    }
+
+    errs := []error{}
+    apply := func(f field, val, source, name string) {
+        err := f.set(c, val)
+        if err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", name, err))
+            return
+        }
+        c.sources[f.key] = source
+    }
+
+    // file
+    if c.File != "" {
+        vals, err := readFile(c.File)
+        if err != nil {return nil, nil, err}
+
+        known := map[string]field{}
+        for _, f := range fields {known[f.key] = f}
+        for _, key := range sortedKeys(vals) {
+            f, ok := known[key]
+            if !ok {
+                errs = append(errs, fmt.Errorf("%s: unknown key %s", c.File, key))
+                continue
+            }
+            apply(f, vals[key], SourceFile, fmt.Sprintf("%s: %s", c.File, key))
+        }
+    }
+
+    // env
+    for _, f := range fields {
+        val := getenv(f.env)
+        if val != "" {apply(f, val, SourceEnv, f.env)}
+    }
+
+    // flags, only the ones given
+    fset.Visit(func(fl *flag.Flag) {
+        for _, f := range fields {
+            if f.key == fl.Name {apply(f, *flagVals[f.key], SourceFlag, "-" + f.key)}
+        }
+    })
+
+    if len(errs) > 0 {return nil, nil, errors.Join(errs...)}
+
+    err = c.Validate()
+    if err != nil {return nil, nil, err}
+
+    return c, fset.Args(), nil
+}
+
+// Validate reports every invalid value at once
+func (c *Config) Validate() error {
+    errs := []error{}
+    check := func(ok bool, key, format string, args ...any) {
+        if ok {return}
+        env := ""
+        for _, f := range fields() {
+            if f.key == key {env = f.env}
+        }
+        errs = append(errs, fmt.Errorf("%s (%s): %s", key, env, fmt.Sprintf(format, args...)))
+    }
+    // same parser the job queue schedules with
+    cron := func(spec, key string) {
+        _, err := jobs.ParseCron(spec)
+        check(err == nil, key, "%v", err)
+    }
+
+    check(c.Server.Addr != "", "server.addr", "is required")
+    u, err := url.Parse(c.Server.PublicURL)
+    check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "server.public_url", "%q is not an http or https url", c.Server.PublicURL)
+    info, err := os.Stat(c.Server.FileserverRoot)
+    check(err == nil && info.IsDir(), "server.fileserver_root", "%q is not a directory", c.Server.FileserverRoot)
+    check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay", "must not be negative")
+    check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+    check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout", "must be positive")
+    check(c.Server.ReadTimeout >= c.Server.ReadHeaderTimeout, "server.read_timeout", "must not be shorter than server.read_header_timeout")
+    check(c.Server.WriteTimeout > 0, "server.write_timeout", "must be positive")
+    check(c.Server.IdleTimeout > 0, "server.idle_timeout", "must be positive")
+    check(c.Server.MaxHeaderBytes >= 1024, "server.max_header_bytes", "must be at least 1024")
+    check(c.Server.MaxBodyBytes > 0, "server.max_body_bytes", "must be positive")
+
+    check(c.Database.URL != "", "database.url", "is required")
+
+    check(c.Auth.Secret != "", "auth.secret", "is required")
+    // an empty key would accept a bare "ApiKey " header on the polka webhook
+    check(c.Auth.PolkaKey != "", "auth.polka_key", "is required")
+    check(c.Auth.AccessTokenTTL > 0, "auth.access_token_ttl", "must be positive")
+    check(c.Auth.RefreshTokenTTL > c.Auth.AccessTokenTTL, "auth.refresh_token_ttl", "must be longer than auth.access_token_ttl")
+
+    check(c.Users.UsernameCooldown >= 0, "users.username_cooldown", "must not be negative")
+    check(c.Chirps.MaxLength > 0, "chirps.max_length", "must be positive")
+    check(c.Chirps.MaxPins >= 0, "chirps.max_pins", "must not be negative")
+    check(c.Chirps.MaxPinsRed >= c.Chirps.MaxPins, "chirps.max_pins_red", "must not be less than chirps.max_pins")
+    cron(c.Chirps.PollsSchedule, "chirps.polls_schedule")
+    check(c.Messages.MaxLength > 0, "messages.max_length", "must be positive")
+    check(c.Messages.MaxGroupSize >= 2, "messages.max_group_size", "must be at least 2")
+
+    check(oneOf(c.Media.Storage, "filesystem", "s3"), "media.storage", "%q is not filesystem or s3", c.Media.Storage)
+    check(c.Media.Storage != "filesystem" || c.Media.Dir != "", "media.dir", "is required for filesystem storage")
+    s3 := c.Media.Storage == "s3"
+    check(!s3 || c.Media.S3Endpoint != "", "media.s3_endpoint", "is required for s3 storage")
+    check(!s3 || c.Media.S3Bucket != "", "media.s3_bucket", "is required for s3 storage")
+    check(!s3 || (c.Media.S3AccessKey != "" && c.Media.S3SecretKey != ""), "media.s3_access_key", "s3 storage needs an access and a secret key")
+    check(c.Media.MaxBytes > 0, "media.max_bytes", "must be positive")
+    check(c.Media.MaxDimension > 0, "media.max_dimension", "must be positive")
+    check(c.Media.ThumbnailSize > 0 && c.Media.ThumbnailSize <= c.Media.MaxDimension, "media.thumbnail_size", "must be positive and at most media.max_dimension")
+    check(c.Media.MaxFrames > 0, "media.max_frames", "must be positive")
+    check(c.Media.MaxPixels > 0, "media.max_pixels", "must be positive")
+
+    check(oneOf(c.Mail.Backend, "file", "smtp"), "mail.backend", "%q is not file or smtp", c.Mail.Backend)
+    check(c.Mail.Backend != "file" || c.Mail.Dir != "", "mail.dir", "is required for the file backend")
+    check(c.Mail.Backend != "smtp" || c.Mail.SMTPAddr != "", "mail.smtp_addr", "is required for the smtp backend")
+    _, err = mail.ParseAddress(c.Mail.From)
+    check(err == nil, "mail.from", "%q is not an email address", c.Mail.From)
+    cron(c.Digest.Schedule, "digest.schedule")
+    check(c.Digest.InactiveAfter > 0, "digest.inactive_after", "must be positive")
+    check(c.Digest.BatchSize > 0, "digest.batch_size", "must be positive")
+
+    check(oneOf(c.Log.Format, "text", "json"), "log.format", "%q is not text or json", c.Log.Format)
+    check(oneOf(c.Log.Level, "debug", "info", "warn", "error"), "log.level", "%q is not debug, info, warn or error", c.Log.Level)
+    check(oneOf(c.Tracing.Exporter, "none", "stdout", "console", "otlp"), "tracing.exporter", "%q is not none, stdout or otlp", c.Tracing.Exporter)
+    check(oneOf(c.Stream.Bus, "local", "postgres"), "stream.bus", "%q is not local or postgres", c.Stream.Bus)
+
+    cron(c.Janitor.Schedule, "janitor.schedule")
+    check(c.Janitor.RevokedTokenRetention >= 0, "janitor.revoked_token_retention", "must not be negative")
+    check(c.Janitor.JobRetention >= 0, "janitor.job_retention", "must not be negative")
+    check(c.Janitor.OutboxRetention >= 0, "janitor.outbox_retention", "must not be negative")
+
+    return errors.Join(errs...)
+}
+
+// Redacted returns every setting with its source, secrets are masked
+func (c *Config) Redacted() map[string]Value {
+    vals := map[string]Value{}
+    for _, f := range fields() {
+        val := f.get(c)
+        if f.secret && val != "" {val = redacted}
+        vals[f.key] = Value{Value: val, Source: c.sources[f.key]}
+    }
+    return vals
+}
+
+func oneOf(val string, allowed ...string) bool {
+    for _, a := range allowed {
+        if val == a {return true}
+    }
+    return false
+}
+
+// reads a config file into dotted keys like server.addr
+func readFile(path string) (map[string]string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {return nil, fmt.Errorf("error with reading config file: %w", err)}
+
+    raw := map[string]any{}
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".yaml", ".yml":
+        err = yaml.Unmarshal(data, &raw)
+    case ".toml":
+        err = toml.Unmarshal(data, &raw)
+    default:
+        return nil, fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+    }
+    if err != nil {return nil, fmt.Errorf("error with parsing %s: %w", path, err)}
+
+    vals := map[string]string{}
+    flatten("", raw, vals)
+    return vals, nil
+}
+
+func flatten(prefix string, raw map[string]any, vals map[string]string) {
+    for k, v := range raw {
+        key := k
+        if prefix != "" {key = prefix + "." + k}
+
+        switch v := v.(type) {
+        case map[string]any:
+            flatten(key, v, vals)
+        case nil:
+        default:
+            vals[key] = fmt.Sprint(v)
+        }
+    }
+}
+
+func sortedKeys(m map[string]string) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {keys = append(keys, k)}
+    sort.Strings(keys)
+    return keys
+}
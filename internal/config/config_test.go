@@ -0,0 +1,104 @@
+package config
+
+import (
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func env(vals map[string]string) func(string) string {
+    return func(key string) string {return vals[key]}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+    dir := t.TempDir()
+    files := map[string]string{
+        "chirpy.yaml": "server:\n  addr: \":9000\"\nchirps:\n  max_length: 280\nauth:\n  access_token_ttl: 30m\n",
+        "chirpy.toml": "[server]\naddr = \":9000\"\n[chirps]\nmax_length = 280\n[auth]\naccess_token_ttl = \"30m\"\n",
+    }
+
+    for name, content := range files {
+        path := filepath.Join(dir, name)
+        err := os.WriteFile(path, []byte(content), 0o600)
+        if err != nil {t.Fatal(err)}
+
+        c, rest, err := Load(
+            []string{"-config", path, "-auth.access_token_ttl", "15m", "janitor"},
+            env(map[string]string{"SECRET": "s3cret", "DB_URL": "postgres://localhost/chirpy", "POLKA": "k", "MAX_CHIRP_LENGTH": "200", "ACCESS_TOKEN_TTL": "20m", "STREAM_BUS": "Postgres", "MEDIA_STORAGE": " FileSystem"}),
+            io.Discard,
+        )
+        if err != nil {t.Fatalf("%s: %v", name, err)}
+
+        if c.Server.Addr != ":9000" {t.Errorf("%s: file must override default, got %s", name, c.Server.Addr)}
+        if c.Chirps.MaxLength != 200 {t.Errorf("%s: env must override file, got %d", name, c.Chirps.MaxLength)}
+        if c.Auth.AccessTokenTTL != 15 * time.Minute {t.Errorf("%s: flag must override env, got %s", name, c.Auth.AccessTokenTTL)}
+        if c.Auth.RefreshTokenTTL != 60 * 24 * time.Hour {t.Errorf("%s: expected default refresh ttl, got %s", name, c.Auth.RefreshTokenTTL)}
+        if len(rest) != 1 || rest[0] != "janitor" {t.Errorf("%s: expected janitor to be left, got %v", name, rest)}
+        if c.Stream.Bus != "postgres" || c.Media.Storage != "filesystem" {t.Errorf("%s: names must be lowercased, got %s and %s", name, c.Stream.Bus, c.Media.Storage)}
+
+        vals := c.Redacted()
+        if vals["auth.secret"].Value != "[redacted]" {t.Errorf("%s: secret must be redacted, got %s", name, vals["auth.secret"].Value)}
+        if vals["server.addr"].Source != SourceFile {t.Errorf("%s: expected file source, got %s", name, vals["server.addr"].Source)}
+        if vals["auth.access_token_ttl"].Source != SourceFlag {t.Errorf("%s: expected flag source, got %s", name, vals["auth.access_token_ttl"].Source)}
+        if vals["database.url"].Value != "[redacted]" {t.Errorf("%s: database url must be redacted, got %s", name, vals["database.url"].Value)}
+    }
+}
+
+func TestLoadErrors(t *testing.T) {
+    dir := t.TempDir()
+    unknown := filepath.Join(dir, "unknown.yaml")
+    err := os.WriteFile(unknown, []byte("server:\n  port: 8080\n"), 0o600)
+    if err != nil {t.Fatal(err)}
+
+    tests := []struct {
+        name string
+        args []string
+        env  map[string]string
+        want []string
+    }{
+        {
+            name: "missing secrets",
+            want: []string{"auth.secret (SECRET): is required", "database.url (DB_URL): is required", "auth.polka_key (POLKA): is required"},
+        },
+        {
+            name: "bad cron specs",
+            env: map[string]string{"SECRET": "x", "DB_URL": "postgres://localhost/chirpy", "POLKA": "k", "JANITOR_SCHEDULE": "hourly", "DIGEST_SCHEDULE": "0 25 * * *"},
+            want: []string{"janitor.schedule (JANITOR_SCHEDULE)", "digest.schedule (DIGEST_SCHEDULE)"},
+        },
+        {
+            name: "every invalid value",
+            env: map[string]string{"SECRET": "x", "LOG_FORMAT": "xml", "MAX_CHIRP_LENGTH": "0", "STREAM_BUS": "kafka"},
+            want: []string{"log.format", "chirps.max_length", "stream.bus"},
+        },
+        {
+            name: "smtp without server",
+            env: map[string]string{"SECRET": "x", "MAIL_BACKEND": "smtp", "MAIL_FROM": "nobody", "PUBLIC_URL": "chirpy.test"},
+            want: []string{"mail.smtp_addr", "mail.from", "server.public_url"},
+        },
+        {
+            name: "bad duration",
+            args: []string{"-server.shutdown_timeout", "soon"},
+            env: map[string]string{"SECRET": "x"},
+            want: []string{"-server.shutdown_timeout", "not a duration"},
+        },
+        {
+            name: "unknown file key",
+            env: map[string]string{"SECRET": "x", "CONFIG": unknown},
+            want: []string{"unknown key server.port"},
+        },
+    }
+
+    for _, tst := range tests {
+        _, _, err := Load(tst.args, env(tst.env), io.Discard)
+        if err == nil {
+            t.Errorf("%s: expected error", tst.name)
+            continue
+        }
+        for _, w := range tst.want {
+            if !strings.Contains(err.Error(), w) {t.Errorf("%s: expected %q in %q", tst.name, w, err)}
+        }
+    }
+}
@@ -0,0 +1,19 @@
+module github.com/sudonetizen/config
+
+go 1.24.2
+
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/sudonetizen/jobs v0.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/lib/pq v1.10.9 // indirect
+	github.com/sudonetizen/database v0.0.0 // indirect
+)
+
+replace github.com/sudonetizen/jobs v0.0.0 => ../jobs/
+
+replace github.com/sudonetizen/database v0.0.0 => ../database/
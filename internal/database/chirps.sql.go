@@ -9,21 +9,23 @@ import (
 	"context"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, quote_of)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3)
+RETURNING id, created_at, updated_at, body, user_id, quote_of, quote_count
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body    string
+	UserID  uuid.UUID
+	QuoteOf uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.QuoteOf)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,10 +33,21 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.QuoteOf,
+		&i.QuoteCount,
 	)
 	return i, err
 }
 
+const decrementQuoteCount = `-- name: DecrementQuoteCount :exec
+UPDATE chirps SET quote_count = GREATEST(quote_count - 1, 0) WHERE id = $1
+`
+
+func (q *Queries) DecrementQuoteCount(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, decrementQuoteCount, id)
+	return err
+}
+
 const delChirp = `-- name: DelChirp :exec
 DELETE FROM chirps WHERE id = $1
 `
@@ -45,7 +58,7 @@ func (q *Queries) DelChirp(ctx context.Context, id uuid.UUID) error {
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count FROM chirps WHERE id = $1
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -57,12 +70,56 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.QuoteOf,
+		&i.QuoteCount,
+	)
+	return i, err
+}
+
+const getChirpForViewer = `-- name: GetChirpForViewer :one
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.quote_of, chirps.quote_count FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = $2 AND blocks.blocked_id = chirps.user_id)
+       OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $2)
+)
+AND (
+    NOT users.is_private
+    OR chirps.user_id = $2
+    OR EXISTS (
+        SELECT 1 FROM follows
+        WHERE follows.follower_id = $2 AND follows.followee_id = chirps.user_id
+        AND follows.status = 'accepted'
+    )
+)
+`
+
+type GetChirpForViewerParams struct {
+	ID       uuid.UUID
+	ViewerID uuid.UUID
+}
+
+// a chirp is hidden when its author and the viewer blocked each other or
+// the author is private and not followed by the viewer
+func (q *Queries) GetChirpForViewer(ctx context.Context, arg GetChirpForViewerParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForViewer, arg.ID, arg.ViewerID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.QuoteOf,
+		&i.QuoteCount,
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at ASC
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count FROM chirps ORDER BY created_at ASC
 `
 
 func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
@@ -80,6 +137,122 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsForViewer = `-- name: GetChirpsForViewer :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.quote_of, chirps.quote_count FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = $1 AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = $1 AND blocks.blocked_id = chirps.user_id)
+       OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $1)
+)
+AND (
+    NOT users.is_private
+    OR chirps.user_id = $1
+    OR EXISTS (
+        SELECT 1 FROM follows
+        WHERE follows.follower_id = $1 AND follows.followee_id = chirps.user_id
+        AND follows.status = 'accepted'
+    )
+)
+ORDER BY chirps.created_at ASC
+`
+
+// leaves out muted authors, authors blocked by or blocking the viewer and
+// private authors the viewer does not follow
+func (q *Queries) GetChirpsForViewer(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsForViewer, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getQuotedChirps = `-- name: GetQuotedChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.quote_of, chirps.quote_count FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = ANY($1::uuid[])
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = $2 AND blocks.blocked_id = chirps.user_id)
+       OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $2)
+)
+AND (
+    NOT users.is_private
+    OR chirps.user_id = $2
+    OR EXISTS (
+        SELECT 1 FROM follows
+        WHERE follows.follower_id = $2 AND follows.followee_id = chirps.user_id
+        AND follows.status = 'accepted'
+    )
+)
+`
+
+type GetQuotedChirpsParams struct {
+	Ids      []uuid.UUID
+	ViewerID uuid.UUID
+}
+
+// the quoted chirps the viewer can see, like GetChirpForViewer
+func (q *Queries) GetQuotedChirps(ctx context.Context, arg GetQuotedChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getQuotedChirps, pq.Array(arg.Ids), arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
 		); err != nil {
 			return nil, err
 		}
@@ -93,3 +266,12 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	}
 	return items, nil
 }
+
+const incrementQuoteCount = `-- name: IncrementQuoteCount :exec
+UPDATE chirps SET quote_count = quote_count + 1 WHERE id = $1
+`
+
+func (q *Queries) IncrementQuoteCount(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, incrementQuoteCount, id)
+	return err
+}
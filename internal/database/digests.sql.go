@@ -0,0 +1,197 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: digests.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const getDigestActivity = `-- name: GetDigestActivity :many
+SELECT notifications.kind, notifications.actor_ids, notifications.updated_at, chirps.body AS chirp_body
+FROM notifications
+LEFT JOIN chirps ON chirps.id = notifications.target_id
+WHERE notifications.user_id = $1
+AND notifications.kind = 'mention'
+AND notifications.updated_at > $2
+UNION ALL
+SELECT 'follow', ARRAY[follows.follower_id]::uuid[], follows.updated_at, NULL::text
+FROM follows
+WHERE follows.followee_id = $1 AND follows.status = 'accepted'
+AND follows.updated_at > $2
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = $1 AND mutes.muted_id = follows.follower_id
+)
+ORDER BY updated_at DESC
+`
+
+type GetDigestActivityParams struct {
+	UserID uuid.UUID
+	Since  time.Time
+}
+
+type GetDigestActivityRow struct {
+	Kind      string
+	ActorIds  []uuid.UUID
+	UpdatedAt time.Time
+	ChirpBody sql.NullString
+}
+
+// mentions of the recipient and new followers since a time, newest first,
+// followers come from the follows themselves so an approved request to a
+// private account counts from when it was accepted
+func (q *Queries) GetDigestActivity(ctx context.Context, arg GetDigestActivityParams) ([]GetDigestActivityRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDigestActivity, arg.UserID, arg.Since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDigestActivityRow
+	for rows.Next() {
+		var i GetDigestActivityRow
+		if err := rows.Scan(
+			&i.Kind,
+			pq.Array(&i.ActorIds),
+			&i.UpdatedAt,
+			&i.ChirpBody,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDigestUser = `-- name: GetDigestUser :one
+SELECT id, email, username, digest_frequency, digest_sent_at, last_active_at, unsubscribe_token
+FROM users WHERE id = $1
+`
+
+type GetDigestUserRow struct {
+	ID               uuid.UUID
+	Email            string
+	Username         sql.NullString
+	DigestFrequency  string
+	DigestSentAt     sql.NullTime
+	LastActiveAt     sql.NullTime
+	UnsubscribeToken string
+}
+
+func (q *Queries) GetDigestUser(ctx context.Context, id uuid.UUID) (GetDigestUserRow, error) {
+	row := q.db.QueryRowContext(ctx, getDigestUser, id)
+	var i GetDigestUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Username,
+		&i.DigestFrequency,
+		&i.DigestSentAt,
+		&i.LastActiveAt,
+		&i.UnsubscribeToken,
+	)
+	return i, err
+}
+
+const getDueDigests = `-- name: GetDueDigests :many
+SELECT id FROM users
+WHERE digest_frequency <> 'off'
+AND (last_active_at IS NULL OR last_active_at < NOW() - make_interval(secs => $1::float8))
+AND (
+    digest_sent_at IS NULL
+    OR digest_sent_at < NOW() - CASE digest_frequency WHEN 'daily' THEN INTERVAL '1 day' ELSE INTERVAL '7 days' END
+)
+ORDER BY digest_sent_at ASC NULLS FIRST
+LIMIT $2
+`
+
+type GetDueDigestsParams struct {
+	InactiveSeconds float64
+	BatchSize       int32
+}
+
+// users away for inactive_seconds whose last digest is a full period old
+func (q *Queries) GetDueDigests(ctx context.Context, arg GetDueDigestsParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getDueDigests, arg.InactiveSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markDigestSent = `-- name: MarkDigestSent :exec
+UPDATE users SET digest_sent_at = NOW() WHERE id = $1
+`
+
+func (q *Queries) MarkDigestSent(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markDigestSent, id)
+	return err
+}
+
+const setDigestFrequency = `-- name: SetDigestFrequency :one
+UPDATE users SET digest_frequency = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING digest_frequency
+`
+
+type SetDigestFrequencyParams struct {
+	ID              uuid.UUID
+	DigestFrequency string
+}
+
+func (q *Queries) SetDigestFrequency(ctx context.Context, arg SetDigestFrequencyParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, setDigestFrequency, arg.ID, arg.DigestFrequency)
+	var digest_frequency string
+	err := row.Scan(&digest_frequency)
+	return digest_frequency, err
+}
+
+const touchUserActive = `-- name: TouchUserActive :exec
+UPDATE users SET last_active_at = NOW() WHERE id = $1
+`
+
+func (q *Queries) TouchUserActive(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, touchUserActive, id)
+	return err
+}
+
+const unsubscribeDigest = `-- name: UnsubscribeDigest :execrows
+UPDATE users SET digest_frequency = 'off', updated_at = NOW()
+WHERE unsubscribe_token = $1
+`
+
+func (q *Queries) UnsubscribeDigest(ctx context.Context, unsubscribeToken string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, unsubscribeDigest, unsubscribeToken)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,187 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: follows.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const acceptFollow = `-- name: AcceptFollow :execrows
+UPDATE follows SET status = 'accepted', updated_at = NOW()
+WHERE follower_id = $1 AND followee_id = $2 AND status = 'pending'
+`
+
+type AcceptFollowParams struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+}
+
+func (q *Queries) AcceptFollow(ctx context.Context, arg AcceptFollowParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, acceptFollow, arg.FollowerID, arg.FolloweeID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const acceptPendingFollows = `-- name: AcceptPendingFollows :exec
+UPDATE follows SET status = 'accepted', updated_at = NOW()
+WHERE followee_id = $1 AND status = 'pending'
+`
+
+func (q *Queries) AcceptPendingFollows(ctx context.Context, followeeID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, acceptPendingFollows, followeeID)
+	return err
+}
+
+const createFollow = `-- name: CreateFollow :one
+INSERT INTO follows (follower_id, followee_id, status, created_at, updated_at)
+SELECT $1, users.id,
+    CASE WHEN users.is_private THEN 'pending' ELSE 'accepted' END, NOW(), NOW()
+FROM users
+WHERE users.id = $2
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = $1 AND blocks.blocked_id = users.id)
+       OR (blocks.blocker_id = users.id AND blocks.blocked_id = $1)
+)
+ON CONFLICT (follower_id, followee_id) DO UPDATE SET updated_at = follows.updated_at
+RETURNING status, (xmax = 0)::boolean AS created
+`
+
+type CreateFollowParams struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+}
+
+type CreateFollowRow struct {
+	Status  string
+	Created bool
+}
+
+// no row when the followee does not exist or either user blocked the other,
+// following again keeps the current status, created is false then
+func (q *Queries) CreateFollow(ctx context.Context, arg CreateFollowParams) (CreateFollowRow, error) {
+	row := q.db.QueryRowContext(ctx, createFollow, arg.FollowerID, arg.FolloweeID)
+	var i CreateFollowRow
+	err := row.Scan(&i.Status, &i.Created)
+	return i, err
+}
+
+const deleteFollow = `-- name: DeleteFollow :exec
+DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2
+`
+
+type DeleteFollowParams struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+}
+
+func (q *Queries) DeleteFollow(ctx context.Context, arg DeleteFollowParams) error {
+	_, err := q.db.ExecContext(ctx, deleteFollow, arg.FollowerID, arg.FolloweeID)
+	return err
+}
+
+const deleteFollowsBetween = `-- name: DeleteFollowsBetween :exec
+DELETE FROM follows
+WHERE (follower_id = $1 AND followee_id = $2)
+   OR (follower_id = $2 AND followee_id = $1)
+`
+
+type DeleteFollowsBetweenParams struct {
+	A uuid.UUID
+	B uuid.UUID
+}
+
+func (q *Queries) DeleteFollowsBetween(ctx context.Context, arg DeleteFollowsBetweenParams) error {
+	_, err := q.db.ExecContext(ctx, deleteFollowsBetween, arg.A, arg.B)
+	return err
+}
+
+const denyFollow = `-- name: DenyFollow :execrows
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2 AND status = 'pending'
+`
+
+type DenyFollowParams struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+}
+
+func (q *Queries) DenyFollow(ctx context.Context, arg DenyFollowParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, denyFollow, arg.FollowerID, arg.FolloweeID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getFollowRequests = `-- name: GetFollowRequests :many
+SELECT users.id, users.username, follows.created_at FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = $1 AND follows.status = 'pending'
+ORDER BY follows.created_at ASC
+`
+
+type GetFollowRequestsRow struct {
+	ID        uuid.UUID
+	Username  sql.NullString
+	CreatedAt time.Time
+}
+
+func (q *Queries) GetFollowRequests(ctx context.Context, followeeID uuid.UUID) ([]GetFollowRequestsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowRequests, followeeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFollowRequestsRow
+	for rows.Next() {
+		var i GetFollowRequestsRow
+		if err := rows.Scan(&i.ID, &i.Username, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFolloweeIDs = `-- name: GetFolloweeIDs :many
+SELECT followee_id FROM follows WHERE follower_id = $1 AND status = 'accepted'
+`
+
+func (q *Queries) GetFolloweeIDs(ctx context.Context, followerID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getFolloweeIDs, followerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var followee_id uuid.UUID
+		if err := rows.Scan(&followee_id); err != nil {
+			return nil, err
+		}
+		items = append(items, followee_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
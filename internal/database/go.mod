@@ -1,3 +1,8 @@
 module github.com/sudonetizen/database
 
 go 1.24.2
+
+require (
+	github.com/google/uuid v1.6.0
+	github.com/lib/pq v1.10.9
+)
@@ -0,0 +1,295 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: jobs.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const claimJob = `-- name: ClaimJob :one
+UPDATE jobs
+SET status = 'running', attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+WHERE id = (
+    SELECT id FROM jobs
+    WHERE status = 'queued' AND run_at <= NOW() AND kind = ANY($1::text[])
+    ORDER BY run_at ASC
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at, locked_at, last_error, unique_key
+`
+
+func (q *Queries) ClaimJob(ctx context.Context, kinds []string) (Job, error) {
+	row := q.db.QueryRowContext(ctx, claimJob, pq.Array(kinds))
+	var i Job
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Kind,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.RunAt,
+		&i.LockedAt,
+		&i.LastError,
+		&i.UniqueKey,
+	)
+	return i, err
+}
+
+const completeJob = `-- name: CompleteJob :execrows
+UPDATE jobs
+SET status = 'done', locked_at = NULL, updated_at = NOW()
+WHERE id = $1 AND status = 'running' AND attempts = $2
+`
+
+type CompleteJobParams struct {
+	ID       uuid.UUID
+	Attempts int32
+}
+
+func (q *Queries) CompleteJob(ctx context.Context, arg CompleteJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, completeJob, arg.ID, arg.Attempts)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteFinishedJobs = `-- name: DeleteFinishedJobs :execrows
+DELETE FROM jobs
+WHERE id IN (
+    SELECT id FROM jobs
+    WHERE status IN ('done', 'dead')
+    AND updated_at < NOW() - make_interval(secs => $1::float8)
+    LIMIT $2
+)
+`
+
+type DeleteFinishedJobsParams struct {
+	RetentionSeconds float64
+	BatchSize        int32
+}
+
+func (q *Queries) DeleteFinishedJobs(ctx context.Context, arg DeleteFinishedJobsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFinishedJobs, arg.RetentionSeconds, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const enqueueJob = `-- name: EnqueueJob :one
+INSERT INTO jobs (id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at, unique_key)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, 'queued', 0, $3,
+    NOW() + make_interval(secs => $5::float8), $4
+)
+ON CONFLICT (unique_key) DO NOTHING
+RETURNING id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at, locked_at, last_error, unique_key
+`
+
+type EnqueueJobParams struct {
+	Kind         string
+	Payload      json.RawMessage
+	MaxAttempts  int32
+	UniqueKey    sql.NullString
+	DelaySeconds float64
+}
+
+func (q *Queries) EnqueueJob(ctx context.Context, arg EnqueueJobParams) (Job, error) {
+	row := q.db.QueryRowContext(ctx, enqueueJob,
+		arg.Kind,
+		arg.Payload,
+		arg.MaxAttempts,
+		arg.UniqueKey,
+		arg.DelaySeconds,
+	)
+	var i Job
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Kind,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.RunAt,
+		&i.LockedAt,
+		&i.LastError,
+		&i.UniqueKey,
+	)
+	return i, err
+}
+
+const getFailedJobs = `-- name: GetFailedJobs :many
+SELECT id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at, locked_at, last_error, unique_key FROM jobs
+WHERE last_error IS NOT NULL
+ORDER BY updated_at DESC
+LIMIT $1
+`
+
+func (q *Queries) GetFailedJobs(ctx context.Context, limit int32) ([]Job, error) {
+	rows, err := q.db.QueryContext(ctx, getFailedJobs, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Job
+	for rows.Next() {
+		var i Job
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Kind,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.MaxAttempts,
+			&i.RunAt,
+			&i.LockedAt,
+			&i.LastError,
+			&i.UniqueKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getJobStats = `-- name: GetJobStats :many
+SELECT kind, status, COUNT(*) AS total FROM jobs
+GROUP BY kind, status
+ORDER BY kind, status
+`
+
+type GetJobStatsRow struct {
+	Kind   string
+	Status string
+	Total  int64
+}
+
+func (q *Queries) GetJobStats(ctx context.Context) ([]GetJobStatsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getJobStats)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetJobStatsRow
+	for rows.Next() {
+		var i GetJobStatsRow
+		if err := rows.Scan(&i.Kind, &i.Status, &i.Total); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const heartbeatJob = `-- name: HeartbeatJob :execrows
+UPDATE jobs
+SET locked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'running' AND attempts = $2
+`
+
+type HeartbeatJobParams struct {
+	ID       uuid.UUID
+	Attempts int32
+}
+
+// keeps a running job from being requeued as stale, attempts identifies the
+// claim, no row when the job was requeued or claimed again meanwhile
+func (q *Queries) HeartbeatJob(ctx context.Context, arg HeartbeatJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, heartbeatJob, arg.ID, arg.Attempts)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const killJob = `-- name: KillJob :execrows
+UPDATE jobs
+SET status = 'dead', locked_at = NULL, updated_at = NOW(), last_error = $3
+WHERE id = $1 AND status = 'running' AND attempts = $2
+`
+
+type KillJobParams struct {
+	ID        uuid.UUID
+	Attempts  int32
+	LastError sql.NullString
+}
+
+func (q *Queries) KillJob(ctx context.Context, arg KillJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, killJob, arg.ID, arg.Attempts, arg.LastError)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const requeueStaleJobs = `-- name: RequeueStaleJobs :execrows
+UPDATE jobs
+SET status = 'queued', locked_at = NULL, updated_at = NOW()
+WHERE status = 'running'
+AND locked_at < NOW() - make_interval(secs => $1::float8)
+`
+
+func (q *Queries) RequeueStaleJobs(ctx context.Context, staleSeconds float64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, requeueStaleJobs, staleSeconds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const retryJob = `-- name: RetryJob :execrows
+UPDATE jobs
+SET status = 'queued', locked_at = NULL, updated_at = NOW(), last_error = $3,
+    run_at = NOW() + make_interval(secs => $4::float8)
+WHERE id = $1 AND status = 'running' AND attempts = $2
+`
+
+type RetryJobParams struct {
+	ID           uuid.UUID
+	Attempts     int32
+	LastError    sql.NullString
+	DelaySeconds float64
+}
+
+func (q *Queries) RetryJob(ctx context.Context, arg RetryJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, retryJob,
+		arg.ID,
+		arg.Attempts,
+		arg.LastError,
+		arg.DelaySeconds,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,342 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: lists.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const addListMember = `-- name: AddListMember :execrows
+INSERT INTO list_members (list_id, user_id, created_at)
+SELECT lists.id, $1, NOW() FROM lists
+WHERE lists.id = $2 AND lists.owner_id = $3
+AND (
+    SELECT COUNT(*) FROM list_members
+    WHERE list_members.list_id = lists.id AND list_members.user_id <> $1
+) < $4::bigint
+ON CONFLICT (list_id, user_id) DO UPDATE SET created_at = list_members.created_at
+`
+
+type AddListMemberParams struct {
+	UserID     uuid.UUID
+	ListID     uuid.UUID
+	OwnerID    uuid.UUID
+	MaxMembers int64
+}
+
+// no row when the list is not the owner's or has max_members other members,
+// adding a member twice keeps the first time and still counts as a row, the
+// count only holds under LockList
+func (q *Queries) AddListMember(ctx context.Context, arg AddListMemberParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, addListMember,
+		arg.UserID,
+		arg.ListID,
+		arg.OwnerID,
+		arg.MaxMembers,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const createList = `-- name: CreateList :one
+INSERT INTO lists (id, owner_id, name, is_private, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW(), NOW())
+RETURNING id, owner_id, name, is_private, created_at, updated_at
+`
+
+type CreateListParams struct {
+	OwnerID   uuid.UUID
+	Name      string
+	IsPrivate bool
+}
+
+func (q *Queries) CreateList(ctx context.Context, arg CreateListParams) (List, error) {
+	row := q.db.QueryRowContext(ctx, createList, arg.OwnerID, arg.Name, arg.IsPrivate)
+	var i List
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.Name,
+		&i.IsPrivate,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteList = `-- name: DeleteList :execrows
+DELETE FROM lists WHERE id = $1 AND owner_id = $2
+`
+
+type DeleteListParams struct {
+	ID      uuid.UUID
+	OwnerID uuid.UUID
+}
+
+func (q *Queries) DeleteList(ctx context.Context, arg DeleteListParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteList, arg.ID, arg.OwnerID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getList = `-- name: GetList :one
+SELECT id, owner_id, name, is_private, created_at, updated_at FROM lists
+WHERE id = $1
+AND (NOT is_private OR owner_id = $2)
+`
+
+type GetListParams struct {
+	ID       uuid.UUID
+	ViewerID uuid.UUID
+}
+
+// private lists are only found by their owner
+func (q *Queries) GetList(ctx context.Context, arg GetListParams) (List, error) {
+	row := q.db.QueryRowContext(ctx, getList, arg.ID, arg.ViewerID)
+	var i List
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.Name,
+		&i.IsPrivate,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getListChirps = `-- name: GetListChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.quote_of, chirps.quote_count FROM chirps
+JOIN users ON users.id = chirps.user_id
+JOIN list_members ON list_members.user_id = chirps.user_id AND list_members.list_id = $1
+WHERE (
+    $2::uuid IS NULL
+    OR (chirps.created_at, chirps.id) < (SELECT c.created_at, c.id FROM chirps c WHERE c.id = $2)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = $3 AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = $3 AND blocks.blocked_id = chirps.user_id)
+       OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $3)
+)
+AND (
+    NOT users.is_private
+    OR chirps.user_id = $3
+    OR EXISTS (
+        SELECT 1 FROM follows
+        WHERE follows.follower_id = $3 AND follows.followee_id = chirps.user_id
+        AND follows.status = 'accepted'
+    )
+)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4
+`
+
+type GetListChirpsParams struct {
+	ListID   uuid.UUID
+	BeforeID uuid.NullUUID
+	ViewerID uuid.UUID
+	MaxRows  int32
+}
+
+// one page of the members' chirps, newest first, before_id is the last chirp
+// of the previous page, filtered for the viewer like the public feed
+func (q *Queries) GetListChirps(ctx context.Context, arg GetListChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getListChirps,
+		arg.ListID,
+		arg.BeforeID,
+		arg.ViewerID,
+		arg.MaxRows,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getListMembers = `-- name: GetListMembers :many
+SELECT users.id, users.username, list_members.created_at FROM list_members
+JOIN users ON users.id = list_members.user_id
+WHERE list_members.list_id = $1
+ORDER BY list_members.created_at ASC, users.id ASC
+`
+
+type GetListMembersRow struct {
+	ID        uuid.UUID
+	Username  sql.NullString
+	CreatedAt time.Time
+}
+
+func (q *Queries) GetListMembers(ctx context.Context, listID uuid.UUID) ([]GetListMembersRow, error) {
+	rows, err := q.db.QueryContext(ctx, getListMembers, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetListMembersRow
+	for rows.Next() {
+		var i GetListMembersRow
+		if err := rows.Scan(&i.ID, &i.Username, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLists = `-- name: GetLists :many
+SELECT id, owner_id, name, is_private, created_at, updated_at FROM lists
+WHERE owner_id = $1
+AND (NOT is_private OR owner_id = $2)
+ORDER BY created_at ASC, id ASC
+`
+
+type GetListsParams struct {
+	OwnerID  uuid.UUID
+	ViewerID uuid.UUID
+}
+
+// lists of an owner, private ones only for the owner
+func (q *Queries) GetLists(ctx context.Context, arg GetListsParams) ([]List, error) {
+	rows, err := q.db.QueryContext(ctx, getLists, arg.OwnerID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []List
+	for rows.Next() {
+		var i List
+		if err := rows.Scan(
+			&i.ID,
+			&i.OwnerID,
+			&i.Name,
+			&i.IsPrivate,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockList = `-- name: LockList :one
+SELECT id FROM lists WHERE id = $1 AND owner_id = $2 FOR UPDATE
+`
+
+type LockListParams struct {
+	ID      uuid.UUID
+	OwnerID uuid.UUID
+}
+
+// taken before adding members so concurrent adds count one after another
+func (q *Queries) LockList(ctx context.Context, arg LockListParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, lockList, arg.ID, arg.OwnerID)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const removeListMember = `-- name: RemoveListMember :execrows
+DELETE FROM list_members
+USING lists
+WHERE list_members.list_id = lists.id
+AND lists.id = $1 AND lists.owner_id = $2
+AND list_members.user_id = $3
+`
+
+type RemoveListMemberParams struct {
+	ListID  uuid.UUID
+	OwnerID uuid.UUID
+	UserID  uuid.UUID
+}
+
+func (q *Queries) RemoveListMember(ctx context.Context, arg RemoveListMemberParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, removeListMember, arg.ListID, arg.OwnerID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateList = `-- name: UpdateList :one
+UPDATE lists SET name = $3, is_private = $4, updated_at = NOW()
+WHERE id = $1 AND owner_id = $2
+RETURNING id, owner_id, name, is_private, created_at, updated_at
+`
+
+type UpdateListParams struct {
+	ID        uuid.UUID
+	OwnerID   uuid.UUID
+	Name      string
+	IsPrivate bool
+}
+
+func (q *Queries) UpdateList(ctx context.Context, arg UpdateListParams) (List, error) {
+	row := q.db.QueryRowContext(ctx, updateList,
+		arg.ID,
+		arg.OwnerID,
+		arg.Name,
+		arg.IsPrivate,
+	)
+	var i List
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.Name,
+		&i.IsPrivate,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
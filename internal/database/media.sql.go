@@ -0,0 +1,159 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: media.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const attachMedia = `-- name: AttachMedia :exec
+INSERT INTO chirp_media (chirp_id, media_id, position)
+VALUES ($1, $2, $3)
+`
+
+type AttachMediaParams struct {
+	ChirpID  uuid.UUID
+	MediaID  uuid.UUID
+	Position int32
+}
+
+func (q *Queries) AttachMedia(ctx context.Context, arg AttachMediaParams) error {
+	_, err := q.db.ExecContext(ctx, attachMedia, arg.ChirpID, arg.MediaID, arg.Position)
+	return err
+}
+
+const countOwnedMedia = `-- name: CountOwnedMedia :one
+SELECT COUNT(*) FROM media
+WHERE id = ANY($1::uuid[]) AND owner_id = $2
+`
+
+type CountOwnedMediaParams struct {
+	Ids     []uuid.UUID
+	OwnerID uuid.UUID
+}
+
+func (q *Queries) CountOwnedMedia(ctx context.Context, arg CountOwnedMediaParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countOwnedMedia, pq.Array(arg.Ids), arg.OwnerID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createMedia = `-- name: CreateMedia :one
+INSERT INTO media (id, created_at, owner_id, content_type, size_bytes, width, height, storage_key, thumbnail_key, thumbnail_type)
+VALUES ($1, NOW(), $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, created_at, owner_id, content_type, size_bytes, width, height, storage_key, thumbnail_key, thumbnail_type
+`
+
+type CreateMediaParams struct {
+	ID            uuid.UUID
+	OwnerID       uuid.UUID
+	ContentType   string
+	SizeBytes     int64
+	Width         int32
+	Height        int32
+	StorageKey    string
+	ThumbnailKey  string
+	ThumbnailType string
+}
+
+func (q *Queries) CreateMedia(ctx context.Context, arg CreateMediaParams) (Media, error) {
+	row := q.db.QueryRowContext(ctx, createMedia,
+		arg.ID,
+		arg.OwnerID,
+		arg.ContentType,
+		arg.SizeBytes,
+		arg.Width,
+		arg.Height,
+		arg.StorageKey,
+		arg.ThumbnailKey,
+		arg.ThumbnailType,
+	)
+	var i Media
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.OwnerID,
+		&i.ContentType,
+		&i.SizeBytes,
+		&i.Width,
+		&i.Height,
+		&i.StorageKey,
+		&i.ThumbnailKey,
+		&i.ThumbnailType,
+	)
+	return i, err
+}
+
+const getChirpMedia = `-- name: GetChirpMedia :many
+SELECT chirp_media.chirp_id, media.id, media.content_type, media.width, media.height
+FROM chirp_media
+JOIN media ON media.id = chirp_media.media_id
+WHERE chirp_media.chirp_id = ANY($1::uuid[])
+ORDER BY chirp_media.chirp_id, chirp_media.position
+`
+
+type GetChirpMediaRow struct {
+	ChirpID     uuid.UUID
+	ID          uuid.UUID
+	ContentType string
+	Width       int32
+	Height      int32
+}
+
+func (q *Queries) GetChirpMedia(ctx context.Context, chirpIds []uuid.UUID) ([]GetChirpMediaRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpMedia, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpMediaRow
+	for rows.Next() {
+		var i GetChirpMediaRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.ID,
+			&i.ContentType,
+			&i.Width,
+			&i.Height,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMedia = `-- name: GetMedia :one
+SELECT id, created_at, owner_id, content_type, size_bytes, width, height, storage_key, thumbnail_key, thumbnail_type FROM media WHERE id = $1
+`
+
+func (q *Queries) GetMedia(ctx context.Context, id uuid.UUID) (Media, error) {
+	row := q.db.QueryRowContext(ctx, getMedia, id)
+	var i Media
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.OwnerID,
+		&i.ContentType,
+		&i.SizeBytes,
+		&i.Width,
+		&i.Height,
+		&i.StorageKey,
+		&i.ThumbnailKey,
+		&i.ThumbnailType,
+	)
+	return i, err
+}
@@ -0,0 +1,348 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: messages.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const addConversationMember = `-- name: AddConversationMember :exec
+INSERT INTO conversation_members (conversation_id, user_id, joined_at)
+VALUES ($1, $2, NOW())
+`
+
+type AddConversationMemberParams struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+}
+
+func (q *Queries) AddConversationMember(ctx context.Context, arg AddConversationMemberParams) error {
+	_, err := q.db.ExecContext(ctx, addConversationMember, arg.ConversationID, arg.UserID)
+	return err
+}
+
+const countBlocksWith = `-- name: CountBlocksWith :one
+SELECT COUNT(*) FROM blocks
+WHERE (blocker_id = $1 AND blocked_id = ANY($2::uuid[]))
+   OR (blocked_id = $1 AND blocker_id = ANY($2::uuid[]))
+`
+
+type CountBlocksWithParams struct {
+	UserID uuid.UUID
+	Ids    []uuid.UUID
+}
+
+// blocks between user_id and any of ids, in either direction
+func (q *Queries) CountBlocksWith(ctx context.Context, arg CountBlocksWithParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countBlocksWith, arg.UserID, pq.Array(arg.Ids))
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUsers = `-- name: CountUsers :one
+SELECT COUNT(*) FROM users WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) CountUsers(ctx context.Context, ids []uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsers, pq.Array(ids))
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createConversation = `-- name: CreateConversation :one
+INSERT INTO conversations (id, created_at, updated_at, direct_key)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1)
+ON CONFLICT (direct_key) DO NOTHING
+RETURNING id, created_at, updated_at, direct_key
+`
+
+// direct conversations pass the key of both users, there is no row when the
+// two users already have one, groups pass null
+func (q *Queries) CreateConversation(ctx context.Context, directKey sql.NullString) (Conversation, error) {
+	row := q.db.QueryRowContext(ctx, createConversation, directKey)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DirectKey,
+	)
+	return i, err
+}
+
+const createMessage = `-- name: CreateMessage :one
+INSERT INTO messages (id, conversation_id, sender_id, body, created_at)
+SELECT gen_random_uuid(), $1, $2, $3, NOW()
+WHERE EXISTS (
+    SELECT 1 FROM conversation_members
+    WHERE conversation_id = $1 AND user_id = $2
+)
+AND NOT EXISTS (
+    SELECT 1 FROM conversation_members other
+    JOIN blocks ON (blocks.blocker_id = $2 AND blocks.blocked_id = other.user_id)
+                OR (blocks.blocker_id = other.user_id AND blocks.blocked_id = $2)
+    WHERE other.conversation_id = $1
+)
+RETURNING id, conversation_id, sender_id, body, created_at
+`
+
+type CreateMessageParams struct {
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+}
+
+// no row unless the sender is a member with no block between them and
+// another member
+func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (Message, error) {
+	row := q.db.QueryRowContext(ctx, createMessage, arg.ConversationID, arg.SenderID, arg.Body)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.ConversationID,
+		&i.SenderID,
+		&i.Body,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const findDirectConversation = `-- name: FindDirectConversation :one
+SELECT id FROM conversations WHERE direct_key = $1
+`
+
+func (q *Queries) FindDirectConversation(ctx context.Context, directKey sql.NullString) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, findDirectConversation, directKey)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getConversation = `-- name: GetConversation :one
+SELECT conversations.id, conversations.created_at, conversations.updated_at,
+    (SELECT COUNT(*) FROM messages
+     WHERE messages.conversation_id = conversations.id
+     AND messages.sender_id <> $1
+     AND (me.last_read_at IS NULL OR messages.created_at > me.last_read_at))::bigint AS unread
+FROM conversations
+JOIN conversation_members me ON me.conversation_id = conversations.id AND me.user_id = $1
+WHERE conversations.id = $2
+`
+
+type GetConversationParams struct {
+	UserID uuid.UUID
+	ID     uuid.UUID
+}
+
+type GetConversationRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Unread    int64
+}
+
+func (q *Queries) GetConversation(ctx context.Context, arg GetConversationParams) (GetConversationRow, error) {
+	row := q.db.QueryRowContext(ctx, getConversation, arg.UserID, arg.ID)
+	var i GetConversationRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Unread,
+	)
+	return i, err
+}
+
+const getConversationMembers = `-- name: GetConversationMembers :many
+SELECT conversation_members.conversation_id, users.id, users.username, conversation_members.last_read_at
+FROM conversation_members
+JOIN users ON users.id = conversation_members.user_id
+WHERE conversation_members.conversation_id = ANY($1::uuid[])
+ORDER BY conversation_members.joined_at ASC, users.id ASC
+`
+
+type GetConversationMembersRow struct {
+	ConversationID uuid.UUID
+	ID             uuid.UUID
+	Username       sql.NullString
+	LastReadAt     sql.NullTime
+}
+
+func (q *Queries) GetConversationMembers(ctx context.Context, conversationIds []uuid.UUID) ([]GetConversationMembersRow, error) {
+	rows, err := q.db.QueryContext(ctx, getConversationMembers, pq.Array(conversationIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetConversationMembersRow
+	for rows.Next() {
+		var i GetConversationMembersRow
+		if err := rows.Scan(
+			&i.ConversationID,
+			&i.ID,
+			&i.Username,
+			&i.LastReadAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getConversations = `-- name: GetConversations :many
+SELECT conversations.id, conversations.created_at, conversations.updated_at,
+    (SELECT COUNT(*) FROM messages
+     WHERE messages.conversation_id = conversations.id
+     AND messages.sender_id <> $1
+     AND (me.last_read_at IS NULL OR messages.created_at > me.last_read_at))::bigint AS unread
+FROM conversations
+JOIN conversation_members me ON me.conversation_id = conversations.id AND me.user_id = $1
+ORDER BY conversations.updated_at DESC
+`
+
+type GetConversationsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Unread    int64
+}
+
+// conversations of a user, latest activity first, with the user's unread count
+func (q *Queries) GetConversations(ctx context.Context, userID uuid.UUID) ([]GetConversationsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getConversations, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetConversationsRow
+	for rows.Next() {
+		var i GetConversationsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Unread,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessages = `-- name: GetMessages :many
+SELECT messages.id, messages.conversation_id, messages.sender_id, messages.body, messages.created_at FROM messages
+WHERE messages.conversation_id = $1
+AND (
+    $2::uuid IS NULL
+    OR (messages.created_at, messages.id) < (SELECT m.created_at, m.id FROM messages m WHERE m.id = $2)
+)
+ORDER BY messages.created_at DESC, messages.id DESC
+LIMIT $3
+`
+
+type GetMessagesParams struct {
+	ConversationID uuid.UUID
+	BeforeID       uuid.NullUUID
+	MaxRows        int32
+}
+
+// one page, newest first, before_id is the oldest message of the previous page
+func (q *Queries) GetMessages(ctx context.Context, arg GetMessagesParams) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, getMessages, arg.ConversationID, arg.BeforeID, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConversationID,
+			&i.SenderID,
+			&i.Body,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isConversationMember = `-- name: IsConversationMember :one
+SELECT EXISTS (
+    SELECT 1 FROM conversation_members WHERE conversation_id = $1 AND user_id = $2
+)
+`
+
+type IsConversationMemberParams struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+}
+
+func (q *Queries) IsConversationMember(ctx context.Context, arg IsConversationMemberParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isConversationMember, arg.ConversationID, arg.UserID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const markConversationRead = `-- name: MarkConversationRead :exec
+UPDATE conversation_members SET last_read_at = NOW()
+WHERE conversation_id = $1 AND user_id = $2
+`
+
+type MarkConversationReadParams struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+}
+
+func (q *Queries) MarkConversationRead(ctx context.Context, arg MarkConversationReadParams) error {
+	_, err := q.db.ExecContext(ctx, markConversationRead, arg.ConversationID, arg.UserID)
+	return err
+}
+
+const touchConversation = `-- name: TouchConversation :exec
+UPDATE conversations SET updated_at = $2 WHERE id = $1
+`
+
+type TouchConversationParams struct {
+	ID        uuid.UUID
+	UpdatedAt time.Time
+}
+
+func (q *Queries) TouchConversation(ctx context.Context, arg TouchConversationParams) error {
+	_, err := q.db.ExecContext(ctx, touchConversation, arg.ID, arg.UpdatedAt)
+	return err
+}
@@ -6,17 +6,175 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
+type Bookmark struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	QuoteOf    uuid.NullUUID
+	QuoteCount int32
+}
+
+type ChirpMedia struct {
+	ChirpID  uuid.UUID
+	MediaID  uuid.UUID
+	Position int32
+}
+
+type Conversation struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DirectKey sql.NullString
+}
+
+type ConversationMember struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+	JoinedAt       time.Time
+	LastReadAt     sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	Status     string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type Job struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Kind        string
+	Payload     json.RawMessage
+	Status      string
+	Attempts    int32
+	MaxAttempts int32
+	RunAt       time.Time
+	LockedAt    sql.NullTime
+	LastError   sql.NullString
+	UniqueKey   sql.NullString
+}
+
+type List struct {
+	ID        uuid.UUID
+	OwnerID   uuid.UUID
+	Name      string
+	IsPrivate bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type ListMember struct {
+	ListID    uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type Media struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	OwnerID       uuid.UUID
+	ContentType   string
+	SizeBytes     int64
+	Width         int32
+	Height        int32
+	StorageKey    string
+	ThumbnailKey  string
+	ThumbnailType string
+}
+
+type Message struct {
+	ID             uuid.UUID
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+	CreatedAt      time.Time
+}
+
+type Mute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type Notification struct {
 	ID        uuid.UUID
+	UserID    uuid.UUID
+	Kind      string
+	TargetID  uuid.UUID
+	ActorIds  []uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Body      string
+	ReadAt    sql.NullTime
+}
+
+type NotificationPreference struct {
+	UserID  uuid.UUID
+	Kind    string
+	Enabled bool
+}
+
+type Outbox struct {
+	ID        int64
+	CreatedAt time.Time
+	Topic     string
+	Payload   json.RawMessage
+	Xid       int64
+}
+
+type OutboxCheckpoint struct {
+	Sink      string
+	UpdatedAt time.Time
+	LastID    int64
+	LastXid   int64
+}
+
+type Pin struct {
+	ChirpID   uuid.UUID
 	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type Poll struct {
+	ChirpID          uuid.UUID
+	ClosesAt         time.Time
+	ClosedNotifiedAt sql.NullTime
+	CreatedAt        time.Time
+}
+
+type PollOption struct {
+	ChirpID  uuid.UUID
+	Position int32
+	Text     string
+}
+
+type PollVote struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	Position  int32
+	CreatedAt time.Time
 }
 
 type RefreshToken struct {
@@ -29,10 +187,21 @@ type RefreshToken struct {
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    sql.NullBool
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Email             string
+	HashedPassword    string
+	IsChirpyRed       sql.NullBool
+	Username          sql.NullString
+	DisplayName       string
+	Bio               string
+	AvatarUrl         string
+	UsernameChangedAt sql.NullTime
+	AvatarMediaID     uuid.NullUUID
+	IsPrivate         bool
+	LastActiveAt      sql.NullTime
+	DigestFrequency   string
+	DigestSentAt      sql.NullTime
+	UnsubscribeToken  string
 }
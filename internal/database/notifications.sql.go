@@ -0,0 +1,303 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: notifications.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const countUnreadNotifications = `-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL
+`
+
+func (q *Queries) CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUnreadNotifications, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteTargetNotifications = `-- name: DeleteTargetNotifications :exec
+DELETE FROM notifications WHERE target_id = $1
+`
+
+// targets are not foreign keys, a deleted chirp takes its notifications along
+func (q *Queries) DeleteTargetNotifications(ctx context.Context, targetID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteTargetNotifications, targetID)
+	return err
+}
+
+const getNotificationPreferences = `-- name: GetNotificationPreferences :many
+SELECT kind, enabled FROM notification_preferences WHERE user_id = $1
+`
+
+type GetNotificationPreferencesRow struct {
+	Kind    string
+	Enabled bool
+}
+
+func (q *Queries) GetNotificationPreferences(ctx context.Context, userID uuid.UUID) ([]GetNotificationPreferencesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getNotificationPreferences, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetNotificationPreferencesRow
+	for rows.Next() {
+		var i GetNotificationPreferencesRow
+		if err := rows.Scan(&i.Kind, &i.Enabled); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNotifications = `-- name: GetNotifications :many
+SELECT notifications.id, notifications.user_id, notifications.kind, notifications.target_id, notifications.actor_ids, notifications.created_at, notifications.updated_at, notifications.read_at FROM notifications
+WHERE notifications.user_id = $1
+AND (NOT $2::bool OR notifications.read_at IS NULL)
+AND (
+    $3::uuid IS NULL
+    OR (notifications.updated_at, notifications.id) < (SELECT n.updated_at, n.id FROM notifications n WHERE n.id = $3)
+)
+ORDER BY notifications.updated_at DESC, notifications.id DESC
+LIMIT $4
+`
+
+type GetNotificationsParams struct {
+	UserID     uuid.UUID
+	UnreadOnly bool
+	BeforeID   uuid.NullUUID
+	MaxRows    int32
+}
+
+// one page, latest activity first, before_id is the last one of the previous page
+func (q *Queries) GetNotifications(ctx context.Context, arg GetNotificationsParams) ([]Notification, error) {
+	rows, err := q.db.QueryContext(ctx, getNotifications,
+		arg.UserID,
+		arg.UnreadOnly,
+		arg.BeforeID,
+		arg.MaxRows,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Notification
+	for rows.Next() {
+		var i Notification
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Kind,
+			&i.TargetID,
+			pq.Array(&i.ActorIds),
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ReadAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersByIDs = `-- name: GetUsersByIDs :many
+SELECT id, username FROM users WHERE id = ANY($1::uuid[])
+`
+
+type GetUsersByIDsRow struct {
+	ID       uuid.UUID
+	Username sql.NullString
+}
+
+func (q *Queries) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) ([]GetUsersByIDsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersByIDsRow
+	for rows.Next() {
+		var i GetUsersByIDsRow
+		if err := rows.Scan(&i.ID, &i.Username); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersByUsernames = `-- name: GetUsersByUsernames :many
+SELECT id, username FROM users WHERE lower(username) = ANY($1::text[])
+`
+
+type GetUsersByUsernamesRow struct {
+	ID       uuid.UUID
+	Username sql.NullString
+}
+
+// usernames are matched ignoring case
+func (q *Queries) GetUsersByUsernames(ctx context.Context, usernames []string) ([]GetUsersByUsernamesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByUsernames, pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersByUsernamesRow
+	for rows.Next() {
+		var i GetUsersByUsernamesRow
+		if err := rows.Scan(&i.ID, &i.Username); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markAllNotificationsRead = `-- name: MarkAllNotificationsRead :exec
+UPDATE notifications SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL
+`
+
+func (q *Queries) MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markAllNotificationsRead, userID)
+	return err
+}
+
+const markNotificationRead = `-- name: MarkNotificationRead :execrows
+UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+WHERE id = $1 AND user_id = $2
+`
+
+type MarkNotificationReadParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) MarkNotificationRead(ctx context.Context, arg MarkNotificationReadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markNotificationRead, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const notify = `-- name: Notify :one
+INSERT INTO notifications (id, user_id, kind, target_id, actor_ids, created_at, updated_at)
+SELECT gen_random_uuid(), $1, $2, $3, ARRAY[$4::uuid], NOW(), NOW()
+WHERE $4::uuid <> $1
+AND NOT EXISTS (
+    SELECT 1 FROM notification_preferences
+    WHERE notification_preferences.user_id = $1
+    AND notification_preferences.kind = $2
+    AND NOT notification_preferences.enabled
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = $1 AND blocks.blocked_id = $4)
+       OR (blocks.blocker_id = $4 AND blocks.blocked_id = $1)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = $1 AND mutes.muted_id = $4
+)
+AND NOT EXISTS (
+    SELECT 1 FROM chirps
+    JOIN users ON users.id = chirps.user_id
+    WHERE chirps.id = $3
+    AND users.is_private
+    AND chirps.user_id <> $1
+    AND NOT EXISTS (
+        SELECT 1 FROM follows
+        WHERE follows.follower_id = $1 AND follows.followee_id = chirps.user_id
+        AND follows.status = 'accepted'
+    )
+)
+ON CONFLICT (user_id, kind, target_id) WHERE read_at IS NULL
+DO UPDATE SET
+    actor_ids = array_prepend($4::uuid, array_remove(notifications.actor_ids, $4::uuid)),
+    updated_at = NOW()
+RETURNING id, user_id, kind, target_id, actor_ids, created_at, updated_at, read_at
+`
+
+type NotifyParams struct {
+	UserID   uuid.UUID
+	Kind     string
+	TargetID uuid.UUID
+	ActorID  uuid.UUID
+}
+
+// adds actor_id to the unread group or starts one, no row when the recipient
+// is the actor, turned the kind off, blocked or muted the actor, was blocked
+// by them, or can not see the target chirp
+func (q *Queries) Notify(ctx context.Context, arg NotifyParams) (Notification, error) {
+	row := q.db.QueryRowContext(ctx, notify,
+		arg.UserID,
+		arg.Kind,
+		arg.TargetID,
+		arg.ActorID,
+	)
+	var i Notification
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Kind,
+		&i.TargetID,
+		pq.Array(&i.ActorIds),
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ReadAt,
+	)
+	return i, err
+}
+
+const setNotificationPreference = `-- name: SetNotificationPreference :exec
+INSERT INTO notification_preferences (user_id, kind, enabled)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, kind) DO UPDATE SET enabled = EXCLUDED.enabled
+`
+
+type SetNotificationPreferenceParams struct {
+	UserID  uuid.UUID
+	Kind    string
+	Enabled bool
+}
+
+func (q *Queries) SetNotificationPreference(ctx context.Context, arg SetNotificationPreferenceParams) error {
+	_, err := q.db.ExecContext(ctx, setNotificationPreference, arg.UserID, arg.Kind, arg.Enabled)
+	return err
+}
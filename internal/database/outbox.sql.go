@@ -0,0 +1,145 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: outbox.sql
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/lib/pq"
+)
+
+const createOutboxEvent = `-- name: CreateOutboxEvent :one
+INSERT INTO outbox (created_at, topic, payload)
+VALUES (NOW(), $1, $2)
+RETURNING id, created_at, topic, payload, xid
+`
+
+type CreateOutboxEventParams struct {
+	Topic   string
+	Payload json.RawMessage
+}
+
+func (q *Queries) CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) (Outbox, error) {
+	row := q.db.QueryRowContext(ctx, createOutboxEvent, arg.Topic, arg.Payload)
+	var i Outbox
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Topic,
+		&i.Payload,
+		&i.Xid,
+	)
+	return i, err
+}
+
+const deleteRelayedOutboxEvents = `-- name: DeleteRelayedOutboxEvents :execrows
+DELETE FROM outbox
+WHERE id IN (
+    SELECT id FROM outbox
+    WHERE NOT EXISTS (
+        SELECT 1 FROM unnest($1::text[]) AS s(name)
+        LEFT JOIN outbox_checkpoints c ON c.sink = s.name
+        WHERE (outbox.xid, outbox.id) > (COALESCE(c.last_xid, 0), COALESCE(c.last_id, 0))
+    )
+    AND created_at < NOW() - make_interval(secs => $2::float8)
+    LIMIT $3
+)
+`
+
+type DeleteRelayedOutboxEventsParams struct {
+	Sinks            []string
+	RetentionSeconds float64
+	BatchSize        int32
+}
+
+func (q *Queries) DeleteRelayedOutboxEvents(ctx context.Context, arg DeleteRelayedOutboxEventsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRelayedOutboxEvents, pq.Array(arg.Sinks), arg.RetentionSeconds, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getOutboxCheckpoint = `-- name: GetOutboxCheckpoint :one
+SELECT last_xid, last_id FROM outbox_checkpoints WHERE sink = $1
+`
+
+type GetOutboxCheckpointRow struct {
+	LastXid int64
+	LastID  int64
+}
+
+func (q *Queries) GetOutboxCheckpoint(ctx context.Context, sink string) (GetOutboxCheckpointRow, error) {
+	row := q.db.QueryRowContext(ctx, getOutboxCheckpoint, sink)
+	var i GetOutboxCheckpointRow
+	err := row.Scan(&i.LastXid, &i.LastID)
+	return i, err
+}
+
+const getOutboxEvents = `-- name: GetOutboxEvents :many
+SELECT id, created_at, topic, payload, xid FROM outbox
+WHERE (xid, id) > ($1::bigint, $2::bigint)
+AND xid < pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+ORDER BY xid ASC, id ASC
+LIMIT $3
+`
+
+type GetOutboxEventsParams struct {
+	AfterXid  int64
+	AfterID   int64
+	MaxEvents int32
+}
+
+// events after the checkpoint in (xid, id) order, only from transactions
+// older than every running one, so no event can later show up behind the
+// checkpoint
+func (q *Queries) GetOutboxEvents(ctx context.Context, arg GetOutboxEventsParams) ([]Outbox, error) {
+	rows, err := q.db.QueryContext(ctx, getOutboxEvents, arg.AfterXid, arg.AfterID, arg.MaxEvents)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Outbox
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Topic,
+			&i.Payload,
+			&i.Xid,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const saveOutboxCheckpoint = `-- name: SaveOutboxCheckpoint :exec
+INSERT INTO outbox_checkpoints (sink, updated_at, last_xid, last_id)
+VALUES ($1, NOW(), $2, $3)
+ON CONFLICT (sink) DO UPDATE
+SET updated_at = NOW(), last_xid = EXCLUDED.last_xid, last_id = EXCLUDED.last_id
+`
+
+type SaveOutboxCheckpointParams struct {
+	Sink    string
+	LastXid int64
+	LastID  int64
+}
+
+func (q *Queries) SaveOutboxCheckpoint(ctx context.Context, arg SaveOutboxCheckpointParams) error {
+	_, err := q.db.ExecContext(ctx, saveOutboxCheckpoint, arg.Sink, arg.LastXid, arg.LastID)
+	return err
+}
@@ -0,0 +1,96 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: pins.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const getPinnedChirpIDs = `-- name: GetPinnedChirpIDs :many
+SELECT chirp_id FROM pins WHERE user_id = $1 ORDER BY created_at DESC, chirp_id DESC
+`
+
+// latest pin first
+func (q *Queries) GetPinnedChirpIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getPinnedChirpIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var chirp_id uuid.UUID
+		if err := rows.Scan(&chirp_id); err != nil {
+			return nil, err
+		}
+		items = append(items, chirp_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockPinningUser = `-- name: LockPinningUser :one
+SELECT is_chirpy_red FROM users WHERE id = $1 FOR NO KEY UPDATE
+`
+
+// taken before pinning so concurrent pins of one user count one after another,
+// no key update leaves inserts referencing the user alone
+func (q *Queries) LockPinningUser(ctx context.Context, id uuid.UUID) (sql.NullBool, error) {
+	row := q.db.QueryRowContext(ctx, lockPinningUser, id)
+	var is_chirpy_red sql.NullBool
+	err := row.Scan(&is_chirpy_red)
+	return is_chirpy_red, err
+}
+
+const pinChirp = `-- name: PinChirp :execrows
+INSERT INTO pins (chirp_id, user_id, created_at)
+SELECT chirps.id, chirps.user_id, NOW() FROM chirps
+WHERE chirps.id = $1 AND chirps.user_id = $2
+AND (
+    SELECT COUNT(*) FROM pins
+    WHERE pins.user_id = $2 AND pins.chirp_id <> $1
+) < $3::bigint
+ON CONFLICT (chirp_id) DO UPDATE SET created_at = pins.created_at
+`
+
+type PinChirpParams struct {
+	ChirpID uuid.UUID
+	UserID  uuid.UUID
+	MaxPins int64
+}
+
+// no row when the chirp is not the user's or max_pins other chirps are
+// pinned, pinning a chirp twice keeps the first time and still counts as a
+// row, the count only holds under LockPinningUser
+func (q *Queries) PinChirp(ctx context.Context, arg PinChirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pinChirp, arg.ChirpID, arg.UserID, arg.MaxPins)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const unpinChirp = `-- name: UnpinChirp :exec
+DELETE FROM pins WHERE chirp_id = $1 AND user_id = $2
+`
+
+type UnpinChirpParams struct {
+	ChirpID uuid.UUID
+	UserID  uuid.UUID
+}
+
+func (q *Queries) UnpinChirp(ctx context.Context, arg UnpinChirpParams) error {
+	_, err := q.db.ExecContext(ctx, unpinChirp, arg.ChirpID, arg.UserID)
+	return err
+}
@@ -0,0 +1,206 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: polls.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const claimClosedPoll = `-- name: ClaimClosedPoll :one
+UPDATE polls SET closed_notified_at = NOW()
+WHERE chirp_id = (
+    SELECT p.chirp_id FROM polls p
+    WHERE p.closes_at <= NOW() AND p.closed_notified_at IS NULL
+    AND NOT (p.chirp_id = ANY($1::uuid[]))
+    ORDER BY p.closes_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING chirp_id
+`
+
+// a closed poll whose voters were not notified yet, claimed so only one
+// instance notifies, skip holds polls that failed earlier in the same run
+func (q *Queries) ClaimClosedPoll(ctx context.Context, skip []uuid.UUID) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, claimClosedPoll, pq.Array(skip))
+	var chirp_id uuid.UUID
+	err := row.Scan(&chirp_id)
+	return chirp_id, err
+}
+
+const createPoll = `-- name: CreatePoll :exec
+INSERT INTO polls (chirp_id, closes_at, created_at)
+VALUES ($1, NOW() + make_interval(mins => $2::int), NOW())
+`
+
+type CreatePollParams struct {
+	ChirpID uuid.UUID
+	Minutes int32
+}
+
+func (q *Queries) CreatePoll(ctx context.Context, arg CreatePollParams) error {
+	_, err := q.db.ExecContext(ctx, createPoll, arg.ChirpID, arg.Minutes)
+	return err
+}
+
+const createPollOption = `-- name: CreatePollOption :exec
+INSERT INTO poll_options (chirp_id, position, text)
+VALUES ($1, $2, $3)
+`
+
+type CreatePollOptionParams struct {
+	ChirpID  uuid.UUID
+	Position int32
+	Text     string
+}
+
+func (q *Queries) CreatePollOption(ctx context.Context, arg CreatePollOptionParams) error {
+	_, err := q.db.ExecContext(ctx, createPollOption, arg.ChirpID, arg.Position, arg.Text)
+	return err
+}
+
+const createVote = `-- name: CreateVote :execrows
+INSERT INTO poll_votes (chirp_id, user_id, position, created_at)
+SELECT polls.chirp_id, $1, $2, NOW() FROM polls
+WHERE polls.chirp_id = $3 AND polls.closes_at > NOW()
+ON CONFLICT (chirp_id, user_id) DO NOTHING
+`
+
+type CreateVoteParams struct {
+	UserID   uuid.UUID
+	Position int32
+	ChirpID  uuid.UUID
+}
+
+// no row when the poll closed or the user already voted
+func (q *Queries) CreateVote(ctx context.Context, arg CreateVoteParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createVote, arg.UserID, arg.Position, arg.ChirpID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getPollOptions = `-- name: GetPollOptions :many
+SELECT polls.chirp_id, polls.closes_at, (polls.closes_at <= NOW())::bool AS closed,
+    poll_options.position, poll_options.text, COUNT(poll_votes.user_id) AS votes
+FROM polls
+JOIN poll_options ON poll_options.chirp_id = polls.chirp_id
+LEFT JOIN poll_votes ON poll_votes.chirp_id = poll_options.chirp_id AND poll_votes.position = poll_options.position
+WHERE polls.chirp_id = ANY($1::uuid[])
+GROUP BY polls.chirp_id, polls.closes_at, poll_options.position, poll_options.text
+ORDER BY polls.chirp_id, poll_options.position
+`
+
+type GetPollOptionsRow struct {
+	ChirpID  uuid.UUID
+	ClosesAt time.Time
+	Closed   bool
+	Position int32
+	Text     string
+	Votes    int64
+}
+
+// options of the polls of chirps with their vote counts, closed is decided by
+// the database clock
+func (q *Queries) GetPollOptions(ctx context.Context, ids []uuid.UUID) ([]GetPollOptionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPollOptions, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPollOptionsRow
+	for rows.Next() {
+		var i GetPollOptionsRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.ClosesAt,
+			&i.Closed,
+			&i.Position,
+			&i.Text,
+			&i.Votes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPollVoters = `-- name: GetPollVoters :many
+SELECT user_id FROM poll_votes WHERE chirp_id = $1
+`
+
+func (q *Queries) GetPollVoters(ctx context.Context, chirpID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getPollVoters, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var user_id uuid.UUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPollVotesBy = `-- name: GetPollVotesBy :many
+SELECT chirp_id, position FROM poll_votes
+WHERE chirp_id = ANY($1::uuid[]) AND user_id = $2
+`
+
+type GetPollVotesByParams struct {
+	Ids    []uuid.UUID
+	UserID uuid.UUID
+}
+
+type GetPollVotesByRow struct {
+	ChirpID  uuid.UUID
+	Position int32
+}
+
+func (q *Queries) GetPollVotesBy(ctx context.Context, arg GetPollVotesByParams) ([]GetPollVotesByRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPollVotesBy, pq.Array(arg.Ids), arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPollVotesByRow
+	for rows.Next() {
+		var i GetPollVotesByRow
+		if err := rows.Scan(&i.ChirpID, &i.Position); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -38,6 +38,29 @@ func (q *Queries) CreateRToken(ctx context.Context, arg CreateRTokenParams) (Ref
 	return i, err
 }
 
+const deleteExpiredRTokens = `-- name: DeleteExpiredRTokens :execrows
+DELETE FROM refresh_tokens
+WHERE token IN (
+    SELECT token FROM refresh_tokens
+    WHERE expires_at < NOW()
+    OR revoked_at < NOW() - make_interval(secs => $1::float8)
+    LIMIT $2
+)
+`
+
+type DeleteExpiredRTokensParams struct {
+	RetentionSeconds float64
+	BatchSize        int32
+}
+
+func (q *Queries) DeleteExpiredRTokens(ctx context.Context, arg DeleteExpiredRTokensParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredRTokens, arg.RetentionSeconds, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getRToken = `-- name: GetRToken :one
 SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens WHERE token = $1
 `
@@ -14,14 +14,15 @@ import (
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, email, is_chirpy_red
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3)
+RETURNING id, created_at, updated_at, email, is_chirpy_red, username
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Username       sql.NullString
 }
 
 type CreateUserRow struct {
@@ -30,10 +31,11 @@ type CreateUserRow struct {
 	UpdatedAt   time.Time
 	Email       string
 	IsChirpyRed sql.NullBool
+	Username    sql.NullString
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Username)
 	var i CreateUserRow
 	err := row.Scan(
 		&i.ID,
@@ -41,6 +43,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 		&i.UpdatedAt,
 		&i.Email,
 		&i.IsChirpyRed,
+		&i.Username,
 	)
 	return i, err
 }
@@ -55,7 +58,7 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE id = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, username_changed_at, avatar_media_id, is_private, last_active_at, digest_frequency, digest_sent_at, unsubscribe_token FROM users WHERE id = $1
 `
 
 func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
@@ -68,12 +71,23 @@ func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.UsernameChangedAt,
+		&i.AvatarMediaID,
+		&i.IsPrivate,
+		&i.LastActiveAt,
+		&i.DigestFrequency,
+		&i.DigestSentAt,
+		&i.UnsubscribeToken,
 	)
 	return i, err
 }
 
 const getUserByEml = `-- name: GetUserByEml :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, username_changed_at, avatar_media_id, is_private, last_active_at, digest_frequency, digest_sent_at, unsubscribe_token FROM users WHERE lower(email) = lower($1)
 `
 
 func (q *Queries) GetUserByEml(ctx context.Context, email string) (User, error) {
@@ -86,11 +100,99 @@ func (q *Queries) GetUserByEml(ctx context.Context, email string) (User, error)
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.UsernameChangedAt,
+		&i.AvatarMediaID,
+		&i.IsPrivate,
+		&i.LastActiveAt,
+		&i.DigestFrequency,
+		&i.DigestSentAt,
+		&i.UnsubscribeToken,
 	)
 	return i, err
 }
 
-const updateRed = `-- name: UpdateRed :exec
+const getUserByUsername = `-- name: GetUserByUsername :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, username_changed_at, avatar_media_id, is_private, last_active_at, digest_frequency, digest_sent_at, unsubscribe_token FROM users WHERE lower(username) = lower($1)
+`
+
+func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByUsername, username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.UsernameChangedAt,
+		&i.AvatarMediaID,
+		&i.IsPrivate,
+		&i.LastActiveAt,
+		&i.DigestFrequency,
+		&i.DigestSentAt,
+		&i.UnsubscribeToken,
+	)
+	return i, err
+}
+
+const updateProfile = `-- name: UpdateProfile :one
+UPDATE users
+SET updated_at = NOW(), display_name = $2, bio = $3, avatar_url = $4, avatar_media_id = $5, is_private = $6
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, avatar_url, username_changed_at, avatar_media_id, is_private, last_active_at, digest_frequency, digest_sent_at, unsubscribe_token
+`
+
+type UpdateProfileParams struct {
+	ID            uuid.UUID
+	DisplayName   string
+	Bio           string
+	AvatarUrl     string
+	AvatarMediaID uuid.NullUUID
+	IsPrivate     bool
+}
+
+func (q *Queries) UpdateProfile(ctx context.Context, arg UpdateProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateProfile,
+		arg.ID,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarUrl,
+		arg.AvatarMediaID,
+		arg.IsPrivate,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.UsernameChangedAt,
+		&i.AvatarMediaID,
+		&i.IsPrivate,
+		&i.LastActiveAt,
+		&i.DigestFrequency,
+		&i.DigestSentAt,
+		&i.UnsubscribeToken,
+	)
+	return i, err
+}
+
+const updateRed = `-- name: UpdateRed :execrows
 UPDATE users
 SET is_chirpy_red = $1
 WHERE id = $2
@@ -101,9 +203,12 @@ type UpdateRedParams struct {
 	ID          uuid.UUID
 }
 
-func (q *Queries) UpdateRed(ctx context.Context, arg UpdateRedParams) error {
-	_, err := q.db.ExecContext(ctx, updateRed, arg.IsChirpyRed, arg.ID)
-	return err
+func (q *Queries) UpdateRed(ctx context.Context, arg UpdateRedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateRed, arg.IsChirpyRed, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const updateUser = `-- name: UpdateUser :exec
@@ -122,3 +227,24 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
 	_, err := q.db.ExecContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
 	return err
 }
+
+const updateUsername = `-- name: UpdateUsername :execrows
+UPDATE users
+SET updated_at = NOW(), username = $2, username_changed_at = NOW()
+WHERE id = $1
+AND (username_changed_at IS NULL OR username_changed_at < NOW() - make_interval(secs => $3::float8))
+`
+
+type UpdateUsernameParams struct {
+	ID              uuid.UUID
+	Username        sql.NullString
+	CooldownSeconds float64
+}
+
+func (q *Queries) UpdateUsername(ctx context.Context, arg UpdateUsernameParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateUsername, arg.ID, arg.Username, arg.CooldownSeconds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
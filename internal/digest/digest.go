@@ -0,0 +1,217 @@
+package digest
+
+import (
+    "bytes"
+    "context"
+    "embed"
+    "fmt"
+    htmltemplate "html/template"
+    "net/url"
+    "strings"
+    "text/template"
+    "time"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+    "github.com/sudonetizen/mailer"
+)
+
+// job queue kinds, the schedule job finds due users and enqueues one send
+// job per user so a failing address only retries itself
+const (
+    ScheduleKind = "digest.schedule"
+    SendKind     = "digest.send"
+)
+
+// frequencies stored in users.digest_frequency
+const (
+    Off    = "off"
+    Daily  = "daily"
+    Weekly = "weekly"
+)
+
+// items listed per section, the rest are only counted
+const maxItems = 5
+
+//go:embed templates
+var templates embed.FS
+
+var funcs = map[string]any{
+    "plural": plural,
+    "sub": func(a, b int) int {return a - b},
+}
+
+var (
+    textTmpl = template.Must(template.New("digest.txt.tmpl").Funcs(funcs).ParseFS(templates, "templates/digest.txt.tmpl"))
+    htmlTmpl = htmltemplate.Must(htmltemplate.New("digest.html.tmpl").Funcs(funcs).ParseFS(templates, "templates/digest.html.tmpl"))
+)
+
+// Payload of a SendKind job
+type Payload struct {
+    UserID uuid.UUID `json:"user_id"`
+}
+
+type Config struct {
+    // sender of every digest
+    From string
+    // public url of the api, unsubscribe links point at it
+    BaseURL string
+    // users active more recently get no digest
+    InactiveAfter time.Duration
+    // users picked per schedule run
+    Batch int32
+}
+
+// Item is one mention
+type Item struct {
+    Actor string
+    Body  string
+}
+
+// Data is what the templates render
+type Data struct {
+    Name           string
+    Frequency      string
+    Period         string
+    Mentions       []Item
+    MentionCount   int
+    Followers      []string
+    FollowerCount  int
+    UnsubscribeURL string
+}
+
+func (d Data) Empty() bool {
+    return d.MentionCount + d.FollowerCount == 0
+}
+
+// Render builds the email of one digest
+func Render(from, to string, d Data) (mailer.Message, error) {
+    text, html := &bytes.Buffer{}, &bytes.Buffer{}
+    err := textTmpl.Execute(text, d)
+    if err != nil {return mailer.Message{}, err}
+    err = htmlTmpl.Execute(html, d)
+    if err != nil {return mailer.Message{}, err}
+
+    parts := []string{}
+    if d.MentionCount > 0 {parts = append(parts, fmt.Sprintf("%d %s", d.MentionCount, plural(d.MentionCount, "mention", "mentions")))}
+    if d.FollowerCount > 0 {parts = append(parts, fmt.Sprintf("%d new %s", d.FollowerCount, plural(d.FollowerCount, "follower", "followers")))}
+
+    return mailer.Message{
+        From: from,
+        To: to,
+        Subject: fmt.Sprintf("Your %s Chirpy digest: %s", d.Frequency, strings.Join(parts, ", ")),
+        Text: text.String(),
+        HTML: html.String(),
+        // rfc 8058, mail clients show an unsubscribe button that posts to the link
+        Headers: map[string]string{
+            "List-Unsubscribe": "<" + d.UnsubscribeURL + ">",
+            "List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+        },
+    }, nil
+}
+
+func plural(n int, one, many string) string {
+    if n == 1 {return one}
+    return many
+}
+
+// Digester finds users due a digest and mails it
+type Digester struct {
+    db     *database.Queries
+    mailer mailer.Mailer
+    cfg    Config
+}
+
+func New(db *database.Queries, m mailer.Mailer, cfg Config) *Digester {
+    return &Digester{db: db, mailer: m, cfg: cfg}
+}
+
+// Due returns users that should get a digest now
+func (d *Digester) Due(ctx context.Context) ([]uuid.UUID, error) {
+    return d.db.GetDueDigests(ctx, database.GetDueDigestsParams{InactiveSeconds: d.cfg.InactiveAfter.Seconds(), BatchSize: d.cfg.Batch})
+}
+
+// Send mails the digest of one user, a period without activity sends nothing
+// but still counts as done
+func (d *Digester) Send(ctx context.Context, userID uuid.UUID) error {
+    u, err := d.db.GetDigestUser(ctx, userID)
+    if err != nil {return err}
+    // unsubscribed after the job was enqueued
+    if u.DigestFrequency == Off {return nil}
+
+    period, name := 7 * 24 * time.Hour, "week"
+    if u.DigestFrequency == Daily {period, name = 24 * time.Hour, "day"}
+
+    // activity the user has not seen in the app or in an earlier digest
+    since := time.Now().Add(-period)
+    if u.DigestSentAt.Valid && u.DigestSentAt.Time.After(since) {since = u.DigestSentAt.Time}
+    if u.LastActiveAt.Valid && u.LastActiveAt.Time.After(since) {since = u.LastActiveAt.Time}
+
+    rows, err := d.db.GetDigestActivity(ctx, database.GetDigestActivityParams{UserID: userID, Since: since})
+    if err != nil {return err}
+
+    data, err := d.collect(ctx, rows)
+    if err != nil {return err}
+
+    if !data.Empty() {
+        data.Name = u.Username.String
+        if data.Name == "" {data.Name = "there"}
+        data.Frequency, data.Period = u.DigestFrequency, name
+        data.UnsubscribeURL = strings.TrimRight(d.cfg.BaseURL, "/") + "/api/digest/unsubscribe?token=" + url.QueryEscape(u.UnsubscribeToken)
+
+        msg, err := Render(d.cfg.From, u.Email, data)
+        if err != nil {return err}
+
+        err = d.mailer.Send(ctx, msg)
+        if err != nil {return err}
+    }
+
+    return d.db.MarkDigestSent(ctx, userID)
+}
+
+// groups activity rows into sections, actor names are loaded with one query
+func (d *Digester) collect(ctx context.Context, rows []database.GetDigestActivityRow) (Data, error) {
+    ids := []uuid.UUID{}
+    for _, row := range rows {ids = append(ids, row.ActorIds...)}
+
+    names := map[uuid.UUID]string{}
+    if len(ids) > 0 {
+        users, err := d.db.GetUsersByIDs(ctx, ids)
+        if err != nil {return Data{}, err}
+        for _, u := range users {
+            names[u.ID] = "someone"
+            if u.Username.Valid {names[u.ID] = "@" + u.Username.String}
+        }
+    }
+
+    return Collect(rows, names), nil
+}
+
+// Collect builds the sections of a digest from activity rows, newest first
+func Collect(rows []database.GetDigestActivityRow, names map[uuid.UUID]string) Data {
+    data := Data{}
+    followers := map[uuid.UUID]struct{}{}
+
+    for _, row := range rows {
+        if len(row.ActorIds) == 0 {continue}
+        actor := names[row.ActorIds[0]]
+        if actor == "" {actor = "someone"}
+
+        switch row.Kind {
+        case "mention":
+            data.MentionCount++
+            if len(data.Mentions) < maxItems {data.Mentions = append(data.Mentions, Item{actor, row.ChirpBody.String})}
+        case "follow":
+            for _, id := range row.ActorIds {
+                if _, ok := followers[id]; ok {continue}
+                followers[id] = struct{}{}
+                data.FollowerCount++
+
+                name := names[id]
+                if name == "" {name = "someone"}
+                if len(data.Followers) < maxItems {data.Followers = append(data.Followers, name)}
+            }
+        }
+    }
+
+    return data
+}
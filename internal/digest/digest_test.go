@@ -0,0 +1,58 @@
+package digest
+
+import (
+    "database/sql"
+    "strings"
+    "testing"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+)
+
+func TestCollect(t *testing.T) {
+    ann, bob, cid := uuid.New(), uuid.New(), uuid.New()
+    names := map[uuid.UUID]string{ann: "@ann", bob: "@bob"}
+
+    rows := []database.GetDigestActivityRow{
+        {Kind: "mention", ActorIds: []uuid.UUID{ann}, ChirpBody: sql.NullString{String: "hi @me", Valid: true}},
+        {Kind: "follow", ActorIds: []uuid.UUID{bob, ann}},
+        // a second follow group repeats bob after an unfollow
+        {Kind: "follow", ActorIds: []uuid.UUID{bob, cid}},
+        {Kind: "mention", ActorIds: []uuid.UUID{}},
+    }
+    for range 6 {rows = append(rows, database.GetDigestActivityRow{Kind: "mention", ActorIds: []uuid.UUID{ann}})}
+
+    d := Collect(rows, names)
+    if d.MentionCount != 7 || len(d.Mentions) != maxItems {t.Errorf("mentions %d, listed %d", d.MentionCount, len(d.Mentions))}
+    if d.Mentions[0] != (Item{"@ann", "hi @me"}) {t.Errorf("mention %+v", d.Mentions[0])}
+    if d.FollowerCount != 3 || strings.Join(d.Followers, ",") != "@bob,@ann,someone" {t.Errorf("followers %d %v", d.FollowerCount, d.Followers)}
+
+    if !Collect(nil, names).Empty() {t.Errorf("no rows must be empty")}
+}
+
+func TestRender(t *testing.T) {
+    d := Data{
+        Name: "me",
+        Frequency: Weekly,
+        Period: "week",
+        Mentions: []Item{{"@ann", "<b>hi</b> @me"}},
+        MentionCount: 3,
+        Followers: []string{"@bob"},
+        FollowerCount: 1,
+        UnsubscribeURL: "https://chirpy.test/api/digest/unsubscribe?token=abc",
+    }
+
+    msg, err := Render("Chirpy <no-reply@chirpy.test>", "me@example.com", d)
+    if err != nil {t.Fatalf("error with Render: %v\n", err)}
+
+    if msg.Subject != "Your weekly Chirpy digest: 3 mentions, 1 new follower" {t.Errorf("subject %q", msg.Subject)}
+    if msg.Headers["List-Unsubscribe"] != "<" + d.UnsubscribeURL + ">" {t.Errorf("List-Unsubscribe %q", msg.Headers["List-Unsubscribe"])}
+    if msg.Headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {t.Errorf("List-Unsubscribe-Post %q", msg.Headers["List-Unsubscribe-Post"])}
+
+    for _, want := range []string{"3 mentions", "@ann: <b>hi</b> @me", "...and 2 more", "1 new follower", d.UnsubscribeURL} {
+        if !strings.Contains(msg.Text, want) {t.Errorf("text missing %q:\n%s", want, msg.Text)}
+    }
+
+    // chirp bodies are escaped in html
+    if !strings.Contains(msg.HTML, "&lt;b&gt;hi&lt;/b&gt; @me") {t.Errorf("html body not escaped:\n%s", msg.HTML)}
+    if !strings.Contains(msg.HTML, `href="https://chirpy.test/api/digest/unsubscribe?token=abc"`) {t.Errorf("html missing unsubscribe link:\n%s", msg.HTML)}
+}
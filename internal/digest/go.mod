@@ -0,0 +1,15 @@
+module github.com/sudonetizen/digest
+
+go 1.24.2
+
+require (
+	github.com/google/uuid v1.6.0
+	github.com/sudonetizen/database v0.0.0
+	github.com/sudonetizen/mailer v0.0.0
+)
+
+require github.com/lib/pq v1.10.9 // indirect
+
+replace github.com/sudonetizen/database v0.0.0 => ../database/
+
+replace github.com/sudonetizen/mailer v0.0.0 => ../mailer/
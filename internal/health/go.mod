@@ -0,0 +1,3 @@
+module github.com/sudonetizen/health
+
+go 1.24.2
@@ -0,0 +1,114 @@
+package health
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "sync"
+    "time"
+)
+
+// CheckFunc reports a dependency's state, detail is optional extra context
+type CheckFunc func(ctx context.Context) (detail string, err error)
+
+type check struct {
+    name string
+    fn   CheckFunc
+}
+
+// Result of one check
+type Result struct {
+    Status  string  `json:"status"`
+    Latency float64 `json:"latency_ms"`
+    Detail  string  `json:"detail,omitempty"`
+    Error   string  `json:"error,omitempty"`
+}
+
+// Report is the json body of a probe
+type Report struct {
+    Status string            `json:"status"`
+    Checks map[string]Result `json:"checks"`
+}
+
+// Checker runs registered checks concurrently, each bounded by Timeout
+type Checker struct {
+    checks  []check
+    Timeout time.Duration
+}
+
+func New(timeout time.Duration) *Checker {
+    return &Checker{Timeout: timeout}
+}
+
+func (c *Checker) Add(name string, fn CheckFunc) {
+    c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// Run executes every check, the report is ok only if all checks are ok
+func (c *Checker) Run(ctx context.Context) Report {
+    rep := Report{Status: "ok", Checks: map[string]Result{}}
+    mu := sync.Mutex{}
+    wg := sync.WaitGroup{}
+
+    for _, ch := range c.checks {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            res := c.run(ctx, ch)
+
+            mu.Lock()
+            defer mu.Unlock()
+            rep.Checks[ch.name] = res
+            if res.Status != "ok" {rep.Status = "fail"}
+        }()
+    }
+
+    wg.Wait()
+    return rep
+}
+
+func (c *Checker) run(ctx context.Context, ch check) Result {
+    ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+    defer cancel()
+
+    start := time.Now()
+    done := make(chan Result, 1)
+    go func() {
+        detail, err := ch.fn(ctx)
+        res := Result{Status: "ok", Detail: detail}
+        if err != nil {res.Status, res.Error = "fail", err.Error()}
+        done <- res
+    }()
+
+    // a check that ignores ctx must not hang the probe
+    var res Result
+    select {
+    case res = <-done:
+    case <-ctx.Done():
+        res = Result{Status: "fail", Error: "timed out"}
+    }
+
+    res.Latency = float64(time.Since(start).Microseconds()) / 1000
+    return res
+}
+
+// Handler serves the report, 200 when ok and 503 otherwise
+func (c *Checker) Handler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        rep := c.Run(r.Context())
+
+        data, err := json.Marshal(rep)
+        if err != nil {
+            w.WriteHeader(500)
+            return
+        }
+
+        code := 200
+        if rep.Status != "ok" {code = 503}
+
+        w.Header().Set("Content-Type", "application/json")
+        w.Header().Set("Cache-Control", "no-store")
+        w.WriteHeader(code)
+        w.Write(data)
+    })
+}
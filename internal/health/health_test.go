@@ -0,0 +1,55 @@
+package health
+
+import (
+    "context"
+    "errors"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestChecker(t *testing.T) {
+    tests := []struct {
+        name   string
+        fn     CheckFunc
+        status string
+        code   int
+    }{
+        {
+            name: "ok",
+            fn: func(ctx context.Context) (string, error) {return "fine", nil},
+            status: "ok",
+            code: 200,
+        },
+        {
+            name: "failing",
+            fn: func(ctx context.Context) (string, error) {return "", errors.New("db is down")},
+            status: "fail",
+            code: 503,
+        },
+        {
+            name: "hanging",
+            fn: func(ctx context.Context) (string, error) {
+                time.Sleep(time.Second)
+                return "", nil
+            },
+            status: "fail",
+            code: 503,
+        },
+    }
+
+    for _, tst := range tests {
+        c := New(50 * time.Millisecond)
+        c.Add("always", func(ctx context.Context) (string, error) {return "", nil})
+        c.Add(tst.name, tst.fn)
+
+        rec := httptest.NewRecorder()
+        c.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/api/readyz", nil))
+
+        if rec.Code != tst.code {t.Errorf("%s: expected code %d, got %d", tst.name, tst.code, rec.Code)}
+
+        rep := c.Run(context.Background())
+        if rep.Status != tst.status {t.Errorf("%s: expected status %s, got %s", tst.name, tst.status, rep.Status)}
+        if rep.Checks["always"].Status != "ok" {t.Errorf("%s: other checks must not be affected", tst.name)}
+    }
+}
@@ -0,0 +1,104 @@
+package janitor
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "time"
+    "github.com/sudonetizen/database"
+)
+
+// JobKind is the job queue kind that runs a full sweep
+const JobKind = "janitor.sweep"
+
+// SweepFunc deletes at most batch rows and reports how many it deleted
+type SweepFunc func(ctx context.Context, batch int32) (int64, error)
+
+type sweeper struct {
+    name  string
+    sweep SweepFunc
+}
+
+// Config holds retention periods, rows younger than these are kept
+type Config struct {
+    // revoked refresh tokens, expired ones are removed right away
+    RevokedTokens time.Duration
+    // done and dead jobs
+    Jobs time.Duration
+    // outbox events already relayed to every sink
+    Outbox time.Duration
+    // names of the configured outbox sinks, a sink without a checkpoint has relayed nothing
+    Sinks []string
+    // rows deleted per statement so long sweeps never hold big locks
+    Batch int32
+    // pause between batches
+    Pause time.Duration
+}
+
+func DefaultConfig() Config {
+    return Config{
+        RevokedTokens: 7 * 24 * time.Hour,
+        Jobs: 7 * 24 * time.Hour,
+        Outbox: 24 * time.Hour,
+        Batch: 500,
+        Pause: 100 * time.Millisecond,
+    }
+}
+
+// Janitor prunes expiring rows in batches
+type Janitor struct {
+    cfg      Config
+    sweepers []sweeper
+}
+
+func New(db *database.Queries, cfg Config) *Janitor {
+    j := &Janitor{cfg: cfg}
+
+    j.Add("refresh_tokens", func(ctx context.Context, batch int32) (int64, error) {
+        return db.DeleteExpiredRTokens(ctx, database.DeleteExpiredRTokensParams{RetentionSeconds: cfg.RevokedTokens.Seconds(), BatchSize: batch})
+    })
+    j.Add("jobs", func(ctx context.Context, batch int32) (int64, error) {
+        return db.DeleteFinishedJobs(ctx, database.DeleteFinishedJobsParams{RetentionSeconds: cfg.Jobs.Seconds(), BatchSize: batch})
+    })
+    j.Add("outbox", func(ctx context.Context, batch int32) (int64, error) {
+        return db.DeleteRelayedOutboxEvents(ctx, database.DeleteRelayedOutboxEventsParams{Sinks: cfg.Sinks, RetentionSeconds: cfg.Outbox.Seconds(), BatchSize: batch})
+    })
+
+    return j
+}
+
+// Add registers another expiring artifact, e.g. reset or verification tokens
+func (j *Janitor) Add(name string, fn SweepFunc) {
+    j.sweepers = append(j.sweepers, sweeper{name: name, sweep: fn})
+}
+
+// Run sweeps every artifact until no full batch is left and returns the
+// number of deleted rows per artifact, a failing artifact does not stop the others
+func (j *Janitor) Run(ctx context.Context) (map[string]int64, error) {
+    deleted := map[string]int64{}
+    errs := []error{}
+
+    for _, s := range j.sweepers {
+        for {
+            n, err := s.sweep(ctx, j.cfg.Batch)
+            if err != nil {
+                errs = append(errs, fmt.Errorf("error with sweeping %s: %w", s.name, err))
+                break
+            }
+            deleted[s.name] += n
+
+            if n < int64(j.cfg.Batch) {break}
+
+            select {
+            case <-ctx.Done():
+                return deleted, ctx.Err()
+            case <-time.After(j.cfg.Pause):
+            }
+        }
+
+        if deleted[s.name] > 0 {slog.InfoContext(ctx, "janitor deleted rows", "artifact", s.name, "deleted", deleted[s.name])}
+    }
+
+    return deleted, errors.Join(errs...)
+}
@@ -0,0 +1,37 @@
+package janitor
+
+import (
+    "context"
+    "errors"
+    "testing"
+)
+
+func TestRunSweepsInBatches(t *testing.T) {
+    j := &Janitor{cfg: Config{Batch: 10}}
+
+    left := 25
+    calls := 0
+    j.Add("tokens", func(ctx context.Context, batch int32) (int64, error) {
+        calls++
+        n := min(left, int(batch))
+        left -= n
+        return int64(n), nil
+    })
+
+    deleted, err := j.Run(context.Background())
+    if err != nil {t.Fatalf("error with Run: %v\n", err)}
+
+    if deleted["tokens"] != 25 {t.Errorf("expected 25 deleted, got %d", deleted["tokens"])}
+    if calls != 3 {t.Errorf("expected 3 batches, got %d", calls)}
+}
+
+func TestRunContinuesAfterError(t *testing.T) {
+    j := &Janitor{cfg: Config{Batch: 10}}
+
+    j.Add("broken", func(ctx context.Context, batch int32) (int64, error) {return 0, errors.New("db is down")})
+    j.Add("tokens", func(ctx context.Context, batch int32) (int64, error) {return 3, nil})
+
+    deleted, err := j.Run(context.Background())
+    if err == nil {t.Errorf("expected error")}
+    if deleted["tokens"] != 3 {t.Errorf("expected 3 deleted after a failed sweeper, got %d", deleted["tokens"])}
+}
@@ -0,0 +1,114 @@
+package jobs
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Cron is a parsed five field cron spec: minute hour day-of-month month day-of-week
+type Cron struct {
+    minute, hour, dom, month, dow uint64
+    // standard cron matches day-of-month OR day-of-week if both are restricted
+    domStar, dowStar bool
+}
+
+var cronAliases = map[string]string{
+    "@hourly":  "0 * * * *",
+    "@daily":   "0 0 * * *",
+    "@weekly":  "0 0 * * 0",
+    "@monthly": "0 0 1 * *",
+}
+
+// ParseCron parses specs like "*/15 * * * *", "0 3 * * 1-5" or "@daily"
+func ParseCron(spec string) (*Cron, error) {
+    if alias, ok := cronAliases[spec]; ok {spec = alias}
+
+    fields := strings.Fields(spec)
+    if len(fields) != 5 {return nil, fmt.Errorf("cron spec %q must have 5 fields", spec)}
+
+    bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+    sets := [5]uint64{}
+    for i, f := range fields {
+        set, err := parseCronField(f, bounds[i][0], bounds[i][1])
+        if err != nil {return nil, fmt.Errorf("cron spec %q: %w", spec, err)}
+        sets[i] = set
+    }
+
+    return &Cron{
+        minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+        domStar: fields[2] == "*", dowStar: fields[4] == "*",
+    }, nil
+}
+
+// parses one comma separated field into a bit set
+func parseCronField(f string, lo, hi int) (uint64, error) {
+    set := uint64(0)
+
+    for _, part := range strings.Split(f, ",") {
+        step := 1
+        if rng, s, ok := strings.Cut(part, "/"); ok {
+            n, err := strconv.Atoi(s)
+            if err != nil || n < 1 {return 0, fmt.Errorf("invalid step %q", s)}
+            part, step = rng, n
+        }
+
+        start, end := lo, hi
+        if part != "*" {
+            a, b, isRange := strings.Cut(part, "-")
+            n, err := strconv.Atoi(a)
+            if err != nil {return 0, fmt.Errorf("invalid value %q", a)}
+            start, end = n, n
+
+            if isRange {
+                end, err = strconv.Atoi(b)
+                if err != nil {return 0, fmt.Errorf("invalid value %q", b)}
+            } else if step > 1 {
+                end = hi
+            }
+        }
+
+        if start < lo || end > hi || start > end {return 0, fmt.Errorf("value %q out of range %d-%d", part, lo, hi)}
+        for v := start; v <= end; v += step {set |= 1 << uint(v)}
+    }
+
+    return set, nil
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+    dom := c.dom&(1<<uint(t.Day())) != 0
+    dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+    if c.domStar || c.dowStar {return dom && dow}
+    return dom || dow
+}
+
+// Next returns the first matching minute strictly after t
+func (c *Cron) Next(t time.Time) time.Time {
+    t = t.Truncate(time.Minute).Add(time.Minute)
+
+    // every valid spec matches at least once within five years (leap days)
+    limit := t.AddDate(5, 0, 0)
+    for t.Before(limit) {
+        if c.month&(1<<uint(t.Month())) == 0 {
+            t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+            continue
+        }
+        if !c.matchDay(t) {
+            t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+            continue
+        }
+        if c.hour&(1<<uint(t.Hour())) == 0 {
+            t = t.Truncate(time.Hour).Add(time.Hour)
+            continue
+        }
+        if c.minute&(1<<uint(t.Minute())) == 0 {
+            t = t.Add(time.Minute)
+            continue
+        }
+        return t
+    }
+
+    return limit
+}
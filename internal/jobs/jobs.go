@@ -0,0 +1,325 @@
+package jobs
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "sync"
+    "sync/atomic"
+    "time"
+    "github.com/sudonetizen/database"
+)
+
+// job statuses stored in jobs.status
+const (
+    StatusQueued  = "queued"
+    StatusRunning = "running"
+    StatusDone    = "done"
+    StatusDead    = "dead"
+)
+
+// ErrDuplicate is returned by Enqueue when a job with the same unique key exists
+var ErrDuplicate = errors.New("job with this unique key already exists")
+
+// a worker whose claim was requeued as stale must not record an outcome
+var errTakenOver = errors.New("job was requeued or claimed by another worker")
+
+// Options for a single enqueued job
+type Options struct {
+    // zero means DefaultMaxAttempts
+    MaxAttempts int
+    // job is not claimed before this delay passed
+    Delay time.Duration
+    // at most one job is ever stored per key
+    UniqueKey string
+}
+
+const DefaultMaxAttempts = 5
+
+// Enqueue stores a job, q may be bound to a transaction so the job is only
+// visible to workers if the surrounding change commits
+func Enqueue(ctx context.Context, q *database.Queries, kind string, payload any, opts Options) error {
+    data, err := json.Marshal(payload)
+    if err != nil {return err}
+
+    if opts.MaxAttempts == 0 {opts.MaxAttempts = DefaultMaxAttempts}
+
+    _, err = q.EnqueueJob(ctx, database.EnqueueJobParams{
+        Kind: kind,
+        Payload: data,
+        MaxAttempts: int32(opts.MaxAttempts),
+        UniqueKey: sql.NullString{String: opts.UniqueKey, Valid: opts.UniqueKey != ""},
+        DelaySeconds: opts.Delay.Seconds(),
+    })
+    if errors.Is(err, sql.ErrNoRows) {return ErrDuplicate}
+
+    return err
+}
+
+type handlerFunc func(ctx context.Context, payload json.RawMessage) error
+
+type schedule struct {
+    kind    string
+    spec    *Cron
+    payload any
+    next    time.Time
+}
+
+// Queue runs registered job handlers on a pool of workers
+type Queue struct {
+    db       *database.Queries
+    handlers map[string]handlerFunc
+    kinds    []string
+    crons    []*schedule
+
+    Workers int
+    // how long an idle worker sleeps before polling again
+    Poll time.Duration
+    // running jobs locked for longer are assumed lost and requeued
+    StaleAfter time.Duration
+    // how often a running job refreshes its lock, well below StaleAfter
+    Heartbeat time.Duration
+
+    cancelClaims context.CancelFunc
+    cancelJobs   context.CancelFunc
+    wg           sync.WaitGroup
+}
+
+func New(db *database.Queries) *Queue {
+    return &Queue{
+        db: db,
+        handlers: map[string]handlerFunc{},
+        Workers: 4,
+        Poll: time.Second,
+        StaleAfter: 15 * time.Minute,
+        Heartbeat: time.Minute,
+    }
+}
+
+// Register adds a typed handler for kind, payloads are decoded into T
+func Register[T any](q *Queue, kind string, fn func(ctx context.Context, payload T) error) {
+    q.kinds = append(q.kinds, kind)
+    q.handlers[kind] = func(ctx context.Context, raw json.RawMessage) error {
+        var payload T
+        err := json.Unmarshal(raw, &payload)
+        if err != nil {return fmt.Errorf("error with decoding payload: %w", err)}
+
+        return fn(ctx, payload)
+    }
+}
+
+// Schedule enqueues a kind job whenever the cron spec matches, several
+// instances may share a schedule because every slot has a unique key
+func (q *Queue) Schedule(kind, spec string, payload any) error {
+    c, err := ParseCron(spec)
+    if err != nil {return err}
+
+    q.crons = append(q.crons, &schedule{kind: kind, spec: c, payload: payload, next: c.Next(time.Now())})
+    return nil
+}
+
+// Enqueue stores a job using the queue's database handle
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload any, opts Options) error {
+    return Enqueue(ctx, q.db, kind, payload, opts)
+}
+
+// Start launches the workers and the scheduler, they run until Shutdown
+func (q *Queue) Start() {
+    claimCtx, cancelClaims := context.WithCancel(context.Background())
+    jobCtx, cancelJobs := context.WithCancel(context.Background())
+    q.cancelClaims, q.cancelJobs = cancelClaims, cancelJobs
+
+    for i := 0; i < q.Workers; i++ {
+        q.wg.Add(1)
+        go func() {
+            defer q.wg.Done()
+            q.work(claimCtx, jobCtx)
+        }()
+    }
+
+    q.wg.Add(1)
+    go func() {
+        defer q.wg.Done()
+        q.schedule(claimCtx)
+    }()
+}
+
+// Shutdown stops claiming new jobs and waits for running ones, when ctx
+// expires first the running jobs are cancelled and retried later
+func (q *Queue) Shutdown(ctx context.Context) error {
+    if q.cancelClaims == nil {return nil}
+    q.cancelClaims()
+
+    done := make(chan struct{})
+    go func() {
+        q.wg.Wait()
+        close(done)
+    }()
+
+    select {
+    case <-done:
+        q.cancelJobs()
+        return nil
+    case <-ctx.Done():
+        q.cancelJobs()
+        <-done
+        return ctx.Err()
+    }
+}
+
+func (q *Queue) work(claimCtx, jobCtx context.Context) {
+    for {
+        if len(q.kinds) == 0 {
+            <-claimCtx.Done()
+            return
+        }
+
+        job, err := q.db.ClaimJob(claimCtx, q.kinds)
+        if err == nil {
+            q.run(jobCtx, job)
+            continue
+        }
+
+        if !errors.Is(err, sql.ErrNoRows) && claimCtx.Err() == nil {
+            slog.ErrorContext(claimCtx, "error with claiming job", "error", err)
+        }
+
+        select {
+        case <-claimCtx.Done():
+            return
+        case <-time.After(q.Poll):
+        }
+    }
+}
+
+// runs one claimed job and records the outcome
+func (q *Queue) run(ctx context.Context, job database.Job) {
+    // the lock is refreshed while the handler runs so a long job is not taken
+    // for lost, a job taken over anyway is cancelled here
+    jobCtx, cancelJob := context.WithCancel(ctx)
+    beatCtx, stopBeat := context.WithCancel(ctx)
+    lost := atomic.Bool{}
+    beating := make(chan struct{})
+    go func() {
+        defer close(beating)
+        if !q.heartbeat(beatCtx, job) {
+            lost.Store(true)
+            cancelJob()
+        }
+    }()
+
+    err := q.call(jobCtx, job)
+    stopBeat()
+    <-beating
+    cancelJob()
+
+    // bookkeeping must happen even if the job was cancelled by shutdown
+    ctx = context.WithoutCancel(ctx)
+
+    if lost.Load() {
+        slog.WarnContext(ctx, "error with running job", "job_id", job.ID, "kind", job.Kind, "error", errTakenOver)
+        return
+    }
+
+    if err == nil {
+        n, err := q.db.CompleteJob(ctx, database.CompleteJobParams{ID: job.ID, Attempts: job.Attempts})
+        if err == nil && n == 0 {err = errTakenOver}
+        if err != nil {slog.ErrorContext(ctx, "error with completing job", "job_id", job.ID, "error", err)}
+        return
+    }
+
+    lastErr := sql.NullString{String: err.Error(), Valid: true}
+    if job.Attempts >= job.MaxAttempts {
+        slog.ErrorContext(ctx, "job is dead", "job_id", job.ID, "kind", job.Kind, "attempts", job.Attempts, "error", err)
+        n, err := q.db.KillJob(ctx, database.KillJobParams{ID: job.ID, Attempts: job.Attempts, LastError: lastErr})
+        if err == nil && n == 0 {err = errTakenOver}
+        if err != nil {slog.ErrorContext(ctx, "error with killing job", "job_id", job.ID, "error", err)}
+        return
+    }
+
+    slog.WarnContext(ctx, "job failed", "job_id", job.ID, "kind", job.Kind, "attempt", job.Attempts, "error", err)
+    n, err := q.db.RetryJob(ctx, database.RetryJobParams{ID: job.ID, Attempts: job.Attempts, LastError: lastErr, DelaySeconds: Backoff(int(job.Attempts)).Seconds()})
+    if err == nil && n == 0 {err = errTakenOver}
+    if err != nil {slog.ErrorContext(ctx, "error with retrying job", "job_id", job.ID, "error", err)}
+}
+
+// refreshes the lock of a running job until ctx is done, false when the job
+// was requeued or claimed by another worker meanwhile
+func (q *Queue) heartbeat(ctx context.Context, job database.Job) bool {
+    ticker := time.NewTicker(q.Heartbeat)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return true
+        case <-ticker.C:
+        }
+
+        n, err := q.db.HeartbeatJob(ctx, database.HeartbeatJobParams{ID: job.ID, Attempts: job.Attempts})
+        if err != nil {
+            if ctx.Err() == nil {slog.ErrorContext(ctx, "error with refreshing job lock", "job_id", job.ID, "error", err)}
+            continue
+        }
+        if n == 0 {return false}
+    }
+}
+
+// calls the handler, a panic counts as a failed attempt
+func (q *Queue) call(ctx context.Context, job database.Job) (err error) {
+    defer func() {
+        if rec := recover(); rec != nil {err = fmt.Errorf("panic: %v", rec)}
+    }()
+
+    fn, ok := q.handlers[job.Kind]
+    if !ok {return fmt.Errorf("no handler for job kind %q", job.Kind)}
+
+    return fn(ctx, job.Payload)
+}
+
+// enqueues due cron jobs and requeues jobs of crashed workers
+func (q *Queue) schedule(ctx context.Context) {
+    ticker := time.NewTicker(q.Poll)
+    defer ticker.Stop()
+    reaped := time.Time{}
+
+    for {
+        now := time.Now()
+        for _, s := range q.crons {
+            if now.Before(s.next) {continue}
+
+            key := fmt.Sprintf("cron:%s:%d", s.kind, s.next.Unix())
+            err := q.Enqueue(ctx, s.kind, s.payload, Options{UniqueKey: key})
+            if err != nil && !errors.Is(err, ErrDuplicate) {
+                slog.ErrorContext(ctx, "error with scheduling job", "kind", s.kind, "error", err)
+                continue
+            }
+
+            s.next = s.spec.Next(now)
+        }
+
+        if now.Sub(reaped) > time.Minute {
+            reaped = now
+            n, err := q.db.RequeueStaleJobs(ctx, q.StaleAfter.Seconds())
+            if err != nil && ctx.Err() == nil {slog.ErrorContext(ctx, "error with requeueing stale jobs", "error", err)}
+            if n > 0 {slog.WarnContext(ctx, "requeued stale jobs", "count", n)}
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Backoff is the delay before retrying a job that failed attempt times,
+// it doubles from 10 seconds and is capped at one hour
+func Backoff(attempt int) time.Duration {
+    d := 10 * time.Second
+    for i := 1; i < attempt && d < time.Hour; i++ {d *= 2}
+    return min(d, time.Hour)
+}
@@ -0,0 +1,54 @@
+package jobs
+
+import (
+    "testing"
+    "time"
+)
+
+func TestCronNext(t *testing.T) {
+    base := time.Date(2025, time.March, 14, 10, 7, 30, 0, time.UTC)
+
+    tests := []struct {
+        spec string
+        want time.Time
+    }{
+        {spec: "* * * * *", want: time.Date(2025, time.March, 14, 10, 8, 0, 0, time.UTC)},
+        {spec: "*/15 * * * *", want: time.Date(2025, time.March, 14, 10, 15, 0, 0, time.UTC)},
+        {spec: "0 3 * * *", want: time.Date(2025, time.March, 15, 3, 0, 0, 0, time.UTC)},
+        {spec: "@hourly", want: time.Date(2025, time.March, 14, 11, 0, 0, 0, time.UTC)},
+        {spec: "30 9 * * 1-5", want: time.Date(2025, time.March, 17, 9, 30, 0, 0, time.UTC)},
+        {spec: "0 0 1 1 *", want: time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)},
+        {spec: "0 0 29 2 *", want: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+    }
+
+    for _, tst := range tests {
+        c, err := ParseCron(tst.spec)
+        if err != nil {t.Errorf("error with ParseCron(%q): %v\n", tst.spec, err); continue}
+
+        got := c.Next(base)
+        if !got.Equal(tst.want) {t.Errorf("%q: expected %v, got %v", tst.spec, tst.want, got)}
+    }
+}
+
+func TestParseCronInvalid(t *testing.T) {
+    for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+        _, err := ParseCron(spec)
+        if err == nil {t.Errorf("expected error for %q", spec)}
+    }
+}
+
+func TestBackoff(t *testing.T) {
+    tests := []struct {
+        attempt int
+        want    time.Duration
+    }{
+        {attempt: 1, want: 10 * time.Second},
+        {attempt: 2, want: 20 * time.Second},
+        {attempt: 4, want: 80 * time.Second},
+        {attempt: 30, want: time.Hour},
+    }
+
+    for _, tst := range tests {
+        if got := Backoff(tst.attempt); got != tst.want {t.Errorf("attempt %d: expected %v, got %v", tst.attempt, tst.want, got)}
+    }
+}
@@ -0,0 +1,119 @@
+package logging
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "strings"
+    "sync"
+)
+
+// New builds a logger writing json or text lines at level or above, every
+// line logged with a request context gets that request's fields
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+    lvl := slog.LevelInfo
+    if level != "" {
+        err := lvl.UnmarshalText([]byte(level))
+        if err != nil {return nil, fmt.Errorf("invalid log level %q", level)}
+    }
+
+    opts := &slog.HandlerOptions{Level: lvl}
+
+    var h slog.Handler
+    switch strings.ToLower(format) {
+    case "", "text":
+        h = slog.NewTextHandler(w, opts)
+    case "json":
+        h = slog.NewJSONHandler(w, opts)
+    default:
+        return nil, fmt.Errorf("invalid log format %q, use json or text", format)
+    }
+
+    return slog.New(contextHandler{h}), nil
+}
+
+// request scoped fields, user is filled in once a handler authenticated the caller
+type requestInfo struct {
+    id   string
+    req  *http.Request
+    mu   sync.Mutex
+    user string
+}
+
+type ctxKey struct{}
+
+// WithRequest returns r with the request id in its context, the route is
+// read from the request's Pattern when logging because the mux only sets it
+// after routing
+func WithRequest(r *http.Request, id string) *http.Request {
+    info := &requestInfo{id: id}
+    r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, info))
+    info.req = r
+    return r
+}
+
+// Track points the request fields at r, middlewares in between may have
+// copied the request so call it right before the mux that sets the route
+func Track(r *http.Request) {
+    info, ok := r.Context().Value(ctxKey{}).(*requestInfo)
+    if !ok {return}
+
+    info.mu.Lock()
+    info.req = r
+    info.mu.Unlock()
+}
+
+// RequestID returns the id of the request ctx belongs to or ""
+func RequestID(ctx context.Context) string {
+    info, ok := ctx.Value(ctxKey{}).(*requestInfo)
+    if !ok {return ""}
+    return info.id
+}
+
+// SetUser adds the authenticated user to every later line of the request
+func SetUser(ctx context.Context, userID string) {
+    info, ok := ctx.Value(ctxKey{}).(*requestInfo)
+    if !ok {return}
+
+    info.mu.Lock()
+    info.user = userID
+    info.mu.Unlock()
+}
+
+// User returns the user set with SetUser or ""
+func User(ctx context.Context) string {
+    info, ok := ctx.Value(ctxKey{}).(*requestInfo)
+    if !ok {return ""}
+
+    info.mu.Lock()
+    defer info.mu.Unlock()
+    return info.user
+}
+
+// adds request fields from the context to each record
+type contextHandler struct {
+    slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+    if info, ok := ctx.Value(ctxKey{}).(*requestInfo); ok {
+        info.mu.Lock()
+        route, user := info.req.Pattern, info.user
+        info.mu.Unlock()
+
+        rec.AddAttrs(slog.String("request_id", info.id))
+        if route != "" {rec.AddAttrs(slog.String("route", route))}
+        if user != "" {rec.AddAttrs(slog.String("user_id", user))}
+    }
+    return h.Handler.Handle(ctx, rec)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+    return contextHandler{h.Handler.WithGroup(name)}
+}
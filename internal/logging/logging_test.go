@@ -0,0 +1,41 @@
+package logging
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestRequestFields(t *testing.T) {
+    buf := &bytes.Buffer{}
+    logger, err := New(buf, "json", "debug")
+    if err != nil {t.Fatalf("error with New: %v\n", err)}
+
+    r := WithRequest(httptest.NewRequest("GET", "/api/chirps", nil), "req-1")
+    ctx := r.Context()
+
+    // a middleware copied the request before the mux set the route
+    inner := r.WithContext(ctx)
+    Track(inner)
+    inner.Pattern = "GET /api/chirps"
+    SetUser(ctx, "user-1")
+
+    logger.InfoContext(ctx, "hello")
+
+    line := map[string]any{}
+    err = json.Unmarshal(buf.Bytes(), &line)
+    if err != nil {t.Fatalf("error with decoding log line: %v\n", err)}
+
+    for key, want := range map[string]string{"msg": "hello", "request_id": "req-1", "route": "GET /api/chirps", "user_id": "user-1"} {
+        if line[key] != want {t.Errorf("expected %s=%q, got %v", key, want, line[key])}
+    }
+}
+
+func TestNewInvalid(t *testing.T) {
+    _, err := New(&bytes.Buffer{}, "xml", "info")
+    if err == nil {t.Errorf("expected error for invalid format")}
+
+    _, err = New(&bytes.Buffer{}, "json", "loud")
+    if err == nil {t.Errorf("expected error for invalid level")}
+}
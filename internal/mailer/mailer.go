@@ -0,0 +1,137 @@
+package mailer
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "mime/multipart"
+    "mime/quotedprintable"
+    "net/smtp"
+    "net/textproto"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+)
+
+// Message is one email with a text and an html body
+type Message struct {
+    From    string
+    To      string
+    Subject string
+    Text    string
+    HTML    string
+    // extra headers such as List-Unsubscribe
+    Headers map[string]string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+    Send(ctx context.Context, msg Message) error
+}
+
+// Bytes renders msg as a multipart/alternative MIME message
+func (msg Message) Bytes() ([]byte, error) {
+    for _, v := range []string{msg.From, msg.To, msg.Subject} {
+        if strings.ContainsAny(v, "\r\n") {return nil, fmt.Errorf("header value %q has a line break", v)}
+    }
+
+    buf := &bytes.Buffer{}
+    body := &bytes.Buffer{}
+    mw := multipart.NewWriter(body)
+
+    headers := map[string]string{
+        "From": msg.From,
+        "To": msg.To,
+        "Subject": msg.Subject,
+        "Date": time.Now().Format(time.RFC1123Z),
+        "MIME-Version": "1.0",
+        "Content-Type": "multipart/alternative; boundary=" + mw.Boundary(),
+    }
+    for k, v := range msg.Headers {
+        if strings.ContainsAny(k + v, "\r\n") {return nil, fmt.Errorf("header %q has a line break", k)}
+        headers[k] = v
+    }
+
+    // sorted so the output is stable
+    keys := make([]string, 0, len(headers))
+    for k := range headers {keys = append(keys, k)}
+    sort.Strings(keys)
+    for _, k := range keys {fmt.Fprintf(buf, "%s: %s\r\n", k, headers[k])}
+    buf.WriteString("\r\n")
+
+    // text first, clients show the last part they understand
+    for _, part := range []struct{typ, content string}{{"text/plain", msg.Text}, {"text/html", msg.HTML}} {
+        w, err := mw.CreatePart(textproto.MIMEHeader{
+            "Content-Type": {part.typ + "; charset=utf-8"},
+            "Content-Transfer-Encoding": {"quoted-printable"},
+        })
+        if err != nil {return nil, err}
+
+        qp := quotedprintable.NewWriter(w)
+        _, err = qp.Write([]byte(part.content))
+        if err == nil {err = qp.Close()}
+        if err != nil {return nil, err}
+    }
+
+    err := mw.Close()
+    if err != nil {return nil, err}
+
+    buf.Write(body.Bytes())
+    return buf.Bytes(), nil
+}
+
+// FileSink writes every message to an .eml file below Dir instead of
+// sending it, for local testing
+type FileSink struct {
+    Dir string
+}
+
+func NewFileSink(dir string) (*FileSink, error) {
+    err := os.MkdirAll(dir, 0o755)
+    if err != nil {return nil, err}
+    return &FileSink{Dir: dir}, nil
+}
+
+func (f *FileSink) Send(ctx context.Context, msg Message) error {
+    data, err := msg.Bytes()
+    if err != nil {return err}
+
+    suffix := make([]byte, 4)
+    _, err = rand.Read(suffix)
+    if err != nil {return err}
+
+    name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+    return os.WriteFile(filepath.Join(f.Dir, name), data, 0o644)
+}
+
+// SMTP sends messages through a relay, auth is skipped without a username
+type SMTP struct {
+    Addr     string
+    Username string
+    Password string
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+    data, err := msg.Bytes()
+    if err != nil {return err}
+
+    var auth smtp.Auth
+    if s.Username != "" {
+        host := s.Addr
+        if i := strings.LastIndex(host, ":"); i >= 0 {host = host[:i]}
+        auth = smtp.PlainAuth("", s.Username, s.Password, host)
+    }
+
+    return smtp.SendMail(s.Addr, auth, address(msg.From), []string{address(msg.To)}, data)
+}
+
+// the bare address of "Name <a@b>"
+func address(s string) string {
+    i, j := strings.LastIndex(s, "<"), strings.LastIndex(s, ">")
+    if i >= 0 && j > i {return s[i+1:j]}
+    return strings.TrimSpace(s)
+}
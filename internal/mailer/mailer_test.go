@@ -0,0 +1,63 @@
+package mailer
+
+import (
+    "context"
+    "io"
+    "mime"
+    "mime/multipart"
+    "net/mail"
+    "os"
+    "strings"
+    "testing"
+)
+
+func TestFileSink(t *testing.T) {
+    sink, err := NewFileSink(t.TempDir())
+    if err != nil {t.Fatalf("error with NewFileSink: %v\n", err)}
+
+    msg := Message{
+        From: "Chirpy <no-reply@chirpy.test>",
+        To: "ann@example.com",
+        Subject: "Your weekly digest",
+        Text: "2 new followers",
+        HTML: "<p>2 new followers, a line long enough to be wrapped by quoted printable encoding so decoding is tested too</p>",
+        Headers: map[string]string{"List-Unsubscribe": "<https://chirpy.test/u?token=abc>"},
+    }
+    err = sink.Send(context.Background(), msg)
+    if err != nil {t.Fatalf("error with Send: %v\n", err)}
+
+    files, _ := os.ReadDir(sink.Dir)
+    if len(files) != 1 {t.Fatalf("expected 1 file, got %d", len(files))}
+    f, _ := os.Open(sink.Dir + "/" + files[0].Name())
+    defer f.Close()
+
+    // the file is a message any mail client can read
+    parsed, err := mail.ReadMessage(f)
+    if err != nil {t.Fatalf("error with parsing message: %v\n", err)}
+    if parsed.Header.Get("Subject") != msg.Subject {t.Errorf("subject %q", parsed.Header.Get("Subject"))}
+    if parsed.Header.Get("List-Unsubscribe") == "" {t.Errorf("missing List-Unsubscribe")}
+
+    mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+    if err != nil || mediaType != "multipart/alternative" {t.Fatalf("content type %q, %v", mediaType, err)}
+
+    bodies := []string{}
+    mr := multipart.NewReader(parsed.Body, params["boundary"])
+    for {
+        part, err := mr.NextPart()
+        if err == io.EOF {break}
+        if err != nil {t.Fatalf("error with reading part: %v\n", err)}
+        data, _ := io.ReadAll(part)
+        bodies = append(bodies, string(data))
+    }
+    if len(bodies) != 2 || bodies[0] != msg.Text || bodies[1] != msg.HTML {t.Errorf("bodies %q", bodies)}
+}
+
+func TestHeaderInjection(t *testing.T) {
+    _, err := Message{To: "a@b.c\r\nBcc: x@y.z", Subject: "hi"}.Bytes()
+    if err == nil || !strings.Contains(err.Error(), "line break") {t.Errorf("expected line break error, got %v", err)}
+}
+
+func TestAddress(t *testing.T) {
+    if got := address("Chirpy <no-reply@chirpy.test>"); got != "no-reply@chirpy.test" {t.Errorf("got %q", got)}
+    if got := address(" ann@example.com "); got != "ann@example.com" {t.Errorf("got %q", got)}
+}
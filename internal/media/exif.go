@@ -0,0 +1,130 @@
+package media
+
+import (
+    "encoding/binary"
+    "errors"
+    "image"
+)
+
+// jpegOrientation reads the exif orientation tag, 1 means upright and is
+// also returned when there is no exif
+func jpegOrientation(data []byte) int {
+    // segments after the start of image marker
+    i := 2
+    for i + 4 <= len(data) {
+        if data[i] != 0xFF {return 1}
+        marker := data[i + 1]
+        // start of scan, no more metadata after it
+        if marker == 0xDA {return 1}
+
+        size := int(binary.BigEndian.Uint16(data[i + 2:]))
+        if size < 2 || i + 2 + size > len(data) {return 1}
+        seg := data[i + 4 : i + 2 + size]
+
+        if marker == 0xE1 && len(seg) > 14 && string(seg[:6]) == "Exif\x00\x00" {
+            return tiffOrientation(seg[6:])
+        }
+        i += 2 + size
+    }
+    return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+    var order binary.ByteOrder
+    switch string(tiff[:2]) {
+    case "II":
+        order = binary.LittleEndian
+    case "MM":
+        order = binary.BigEndian
+    default:
+        return 1
+    }
+
+    ifd := int(order.Uint32(tiff[4:]))
+    if ifd + 2 > len(tiff) {return 1}
+    count := int(order.Uint16(tiff[ifd:]))
+
+    for n := 0; n < count; n++ {
+        entry := ifd + 2 + n * 12
+        if entry + 12 > len(tiff) {return 1}
+        if order.Uint16(tiff[entry:]) != 0x0112 {continue}
+
+        o := int(order.Uint16(tiff[entry + 8:]))
+        if o < 1 || o > 8 {return 1}
+        return o
+    }
+    return 1
+}
+
+// orient turns src upright according to an exif orientation
+func orient(src image.Image, o int) image.Image {
+    if o <= 1 || o > 8 {return src}
+
+    b := src.Bounds()
+    w, h := b.Dx(), b.Dy()
+    dw, dh := w, h
+    if o >= 5 {dw, dh = h, w}
+    dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            dx, dy := x, y
+            switch o {
+            case 2:
+                dx = w - 1 - x
+            case 3:
+                dx, dy = w - 1 - x, h - 1 - y
+            case 4:
+                dy = h - 1 - y
+            case 5:
+                dx, dy = y, x
+            case 6:
+                dx, dy = h - 1 - y, x
+            case 7:
+                dx, dy = h - 1 - y, w - 1 - x
+            case 8:
+                dx, dy = y, w - 1 - x
+            }
+            dst.Set(dx, dy, src.At(b.Min.X + x, b.Min.Y + y))
+        }
+    }
+    return dst
+}
+
+var errBadWebP = errors.New("webp container is malformed")
+
+// stripWebP drops the EXIF and XMP chunks of a webp file and clears their
+// flags in the VP8X header, the image data is copied as is
+func stripWebP(data []byte) ([]byte, error) {
+    if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {return nil, errBadWebP}
+
+    out := append([]byte{}, data[:12]...)
+    for i := 12; i < len(data); {
+        if i + 8 > len(data) {return nil, errBadWebP}
+        fourcc := string(data[i : i + 4])
+        size := int(binary.LittleEndian.Uint32(data[i + 4:]))
+        // chunks are padded to an even size
+        end := i + 8 + size + size % 2
+        if size < 0 || end > len(data) {
+            if i + 8 + size == len(data) {
+                end = len(data)
+            } else {
+                return nil, errBadWebP
+            }
+        }
+
+        switch fourcc {
+        case "EXIF", "XMP ":
+        case "VP8X":
+            chunk := append([]byte{}, data[i:end]...)
+            if len(chunk) > 8 {chunk[8] &^= 0x08 | 0x04}
+            out = append(out, chunk...)
+        default:
+            out = append(out, data[i:end]...)
+        }
+        i = end
+    }
+
+    binary.LittleEndian.PutUint32(out[4:], uint32(len(out) - 8))
+    return out, nil
+}
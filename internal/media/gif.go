@@ -0,0 +1,56 @@
+package media
+
+import (
+    "encoding/binary"
+    "errors"
+)
+
+var errGIFTruncated = errors.New("gif is truncated")
+
+// gifFrames walks the blocks of a gif without decompressing anything and
+// returns the number of frames and the pixels of all frames together, that
+// is what decoding every frame allocates
+func gifFrames(data []byte) (int, int64, error) {
+    // header and logical screen descriptor
+    if len(data) < 13 {return 0, 0, errGIFTruncated}
+    i := 13 + colorTableSize(data[10])
+
+    frames, pixels := 0, int64(0)
+    for {
+        if i >= len(data) {return 0, 0, errGIFTruncated}
+
+        switch data[i] {
+        // extension: label and data sub-blocks
+        case 0x21:
+            i += 2
+        // image descriptor, optional local color table and lzw minimum code size
+        case 0x2C:
+            if i + 10 > len(data) {return 0, 0, errGIFTruncated}
+            w := int64(binary.LittleEndian.Uint16(data[i + 5:]))
+            h := int64(binary.LittleEndian.Uint16(data[i + 7:]))
+            frames++
+            pixels += w * h
+            i += 10 + colorTableSize(data[i + 9]) + 1
+        // trailer
+        case 0x3B:
+            return frames, pixels, nil
+        default:
+            return 0, 0, errors.New("gif has an unknown block")
+        }
+
+        // skipping data sub-blocks up to the empty one
+        for {
+            if i >= len(data) {return 0, 0, errGIFTruncated}
+            size := int(data[i])
+            i += 1 + size
+            if size == 0 {break}
+        }
+    }
+}
+
+// colorTableSize reads the size of the color table following a descriptor
+// from its packed flags
+func colorTableSize(flags byte) int {
+    if flags & 0x80 == 0 {return 0}
+    return 3 << ((flags & 0x07) + 1)
+}
@@ -0,0 +1,5 @@
+module github.com/sudonetizen/media
+
+go 1.24.2
+
+require golang.org/x/image v0.27.0
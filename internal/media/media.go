@@ -0,0 +1,153 @@
+package media
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "image"
+    "image/gif"
+    "image/jpeg"
+    "image/png"
+    "net/http"
+    "golang.org/x/image/draw"
+    _ "golang.org/x/image/webp"
+)
+
+// content types accepted for uploads
+const (
+    PNG  = "image/png"
+    JPEG = "image/jpeg"
+    GIF  = "image/gif"
+    WebP = "image/webp"
+)
+
+var ErrUnsupported = errors.New("image must be png, jpeg, gif or webp")
+
+// ErrTooBig is returned for images with too many pixels, they are refused
+// before decoding so a small file can not blow up into gigabytes of memory
+var ErrTooBig = errors.New("image dimensions are too large")
+
+// ErrTooManyFrames is returned for gifs over the frame or pixel limits, they
+// are counted before decoding for the same reason
+var ErrTooManyFrames = errors.New("gif has too many frames")
+
+// Options limit and shape the processing
+type Options struct {
+    // longest side accepted
+    MaxDimension int
+    // longest side of thumbnails, smaller images are not scaled up
+    ThumbnailSize int
+    // frames of a gif accepted
+    MaxFrames int
+    // pixels of all gif frames together
+    MaxPixels int64
+}
+
+// Image is an upload with its metadata stripped and a thumbnail
+type Image struct {
+    ContentType   string
+    Data          []byte
+    Width         int
+    Height        int
+    Thumbnail     []byte
+    ThumbnailType string
+}
+
+// Process sniffs the real type of data, ignoring what the client claimed,
+// strips exif and other metadata and renders a thumbnail
+func Process(data []byte, opts Options) (*Image, error) {
+    ct := http.DetectContentType(data)
+    switch ct {
+    case PNG, JPEG, GIF, WebP:
+    default:
+        return nil, ErrUnsupported
+    }
+
+    cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+    if err != nil {return nil, fmt.Errorf("error with reading image: %w", err)}
+    if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > opts.MaxDimension || cfg.Height > opts.MaxDimension {return nil, ErrTooBig}
+
+    img := &Image{ContentType: ct}
+    var first image.Image
+
+    switch ct {
+    case JPEG:
+        // exif goes away with re-encoding, its orientation is applied first
+        src, err := jpeg.Decode(bytes.NewReader(data))
+        if err != nil {return nil, fmt.Errorf("error with decoding jpeg: %w", err)}
+        first = orient(src, jpegOrientation(data))
+
+        buf := bytes.Buffer{}
+        err = jpeg.Encode(&buf, first, &jpeg.Options{Quality: 90})
+        if err != nil {return nil, err}
+        img.Data = buf.Bytes()
+    case PNG:
+        // text and exif chunks are not written back
+        src, err := png.Decode(bytes.NewReader(data))
+        if err != nil {return nil, fmt.Errorf("error with decoding png: %w", err)}
+        first = src
+
+        buf := bytes.Buffer{}
+        err = png.Encode(&buf, src)
+        if err != nil {return nil, err}
+        img.Data = buf.Bytes()
+    case GIF:
+        // every frame is as big as the screen at most, their number is not limited by the format
+        frames, pixels, err := gifFrames(data)
+        if err != nil {return nil, fmt.Errorf("error with reading gif: %w", err)}
+        if frames == 0 {return nil, fmt.Errorf("error with reading gif: no frames")}
+        if frames > opts.MaxFrames || pixels > opts.MaxPixels {return nil, ErrTooManyFrames}
+
+        // keeps every frame, comments and application extensions are dropped
+        g, err := gif.DecodeAll(bytes.NewReader(data))
+        if err != nil {return nil, fmt.Errorf("error with decoding gif: %w", err)}
+        first = g.Image[0]
+
+        buf := bytes.Buffer{}
+        err = gif.EncodeAll(&buf, g)
+        if err != nil {return nil, err}
+        img.Data = buf.Bytes()
+    case WebP:
+        // there is no webp encoder, the metadata chunks are cut out instead
+        src, _, err := image.Decode(bytes.NewReader(data))
+        if err != nil {return nil, fmt.Errorf("error with decoding webp: %w", err)}
+        first = src
+
+        img.Data, err = stripWebP(data)
+        if err != nil {return nil, err}
+    }
+
+    b := first.Bounds()
+    img.Width, img.Height = b.Dx(), b.Dy()
+
+    img.Thumbnail, img.ThumbnailType, err = thumbnail(first, ct, opts.ThumbnailSize)
+    if err != nil {return nil, err}
+
+    return img, nil
+}
+
+// scales src to fit size x size, jpeg stays jpeg, the rest becomes png so
+// transparency survives
+func thumbnail(src image.Image, ct string, size int) ([]byte, string, error) {
+    b := src.Bounds()
+    w, h := b.Dx(), b.Dy()
+    if w > size || h > size {
+        if w >= h {
+            w, h = size, max(1, h * size / w)
+        } else {
+            w, h = max(1, w * size / h), size
+        }
+    }
+
+    dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+    draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+
+    buf := bytes.Buffer{}
+    if ct == JPEG {
+        err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+        return buf.Bytes(), JPEG, err
+    }
+
+    err := png.Encode(&buf, dst)
+    return buf.Bytes(), PNG, err
+}
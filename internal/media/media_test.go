@@ -0,0 +1,148 @@
+package media
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "hash/crc32"
+    "image"
+    "image/color"
+    "image/gif"
+    "image/jpeg"
+    "image/png"
+    "testing"
+)
+
+var opts = Options{MaxDimension: 100, ThumbnailSize: 2, MaxFrames: 3, MaxPixels: 100}
+
+func testImage(w, h int) *image.NRGBA {
+    img := image.NewNRGBA(image.Rect(0, 0, w, h))
+    for x := 0; x < w; x++ {
+        for y := 0; y < h; y++ {img.Set(x, y, color.NRGBA{uint8(x * 40), uint8(y * 40), 0, 255})}
+    }
+    return img
+}
+
+// jpeg with an exif segment holding orientation o and a secret string
+func exifJPEG(t *testing.T, w, h, o int) []byte {
+    buf := bytes.Buffer{}
+    err := jpeg.Encode(&buf, testImage(w, h), nil)
+    if err != nil {t.Fatal(err)}
+
+    tiff := []byte("II*\x00\x08\x00\x00\x00")
+    tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+    tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+    tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+    tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+    tiff = binary.LittleEndian.AppendUint16(tiff, uint16(o))
+    tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+    tiff = append(tiff, "gps-secret"...)
+    seg := append([]byte("Exif\x00\x00"), tiff...)
+
+    out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+    out = binary.BigEndian.AppendUint16(out, uint16(len(seg) + 2))
+    out = append(out, seg...)
+    return append(out, buf.Bytes()[2:]...)
+}
+
+func TestProcessJPEG(t *testing.T) {
+    data := exifJPEG(t, 4, 2, 6)
+    if jpegOrientation(data) != 6 {t.Fatalf("expected orientation 6, got %d", jpegOrientation(data))}
+
+    img, err := Process(data, opts)
+    if err != nil {t.Fatal(err)}
+
+    if img.ContentType != JPEG {t.Errorf("expected jpeg, got %s", img.ContentType)}
+    if img.Width != 2 || img.Height != 4 {t.Errorf("expected rotated 2x4, got %dx%d", img.Width, img.Height)}
+    if bytes.Contains(img.Data, []byte("gps-secret")) || bytes.Contains(img.Data, []byte("Exif")) {t.Errorf("expected exif to be stripped")}
+    if img.ThumbnailType != JPEG {t.Errorf("expected jpeg thumbnail, got %s", img.ThumbnailType)}
+
+    thumb, err := jpeg.DecodeConfig(bytes.NewReader(img.Thumbnail))
+    if err != nil {t.Fatal(err)}
+    if thumb.Width != 1 || thumb.Height != 2 {t.Errorf("expected 1x2 thumbnail, got %dx%d", thumb.Width, thumb.Height)}
+}
+
+func TestProcessPNGAndGIF(t *testing.T) {
+    // a png with a text chunk right after the header
+    buf := bytes.Buffer{}
+    png.Encode(&buf, testImage(3, 3))
+    raw := buf.Bytes()
+    payload := []byte("tEXtComment\x00gps-secret")
+    text := binary.BigEndian.AppendUint32(nil, uint32(len(payload) - 4))
+    text = append(text, payload...)
+    text = binary.BigEndian.AppendUint32(text, crc32.ChecksumIEEE(payload))
+    withText := append(append(append([]byte{}, raw[:33]...), text...), raw[33:]...)
+
+    img, err := Process(withText, opts)
+    if err != nil {t.Fatal(err)}
+    if bytes.Contains(img.Data, []byte("gps-secret")) {t.Errorf("expected text chunk to be stripped")}
+    if img.ThumbnailType != PNG {t.Errorf("expected png thumbnail, got %s", img.ThumbnailType)}
+
+    // every gif frame is kept
+    g := &gif.GIF{}
+    for i := 0; i < 3; i++ {
+        g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 5, 5), color.Palette{color.Black, color.White}))
+        g.Delay = append(g.Delay, 10)
+    }
+    buf.Reset()
+    gif.EncodeAll(&buf, g)
+
+    img, err = Process(buf.Bytes(), opts)
+    if err != nil {t.Fatal(err)}
+    out, err := gif.DecodeAll(bytes.NewReader(img.Data))
+    if err != nil {t.Fatal(err)}
+    if len(out.Image) != 3 {t.Errorf("expected 3 frames, got %d", len(out.Image))}
+}
+
+func TestProcessRejects(t *testing.T) {
+    _, err := Process([]byte("<svg onload=alert(1)></svg>"), opts)
+    if !errors.Is(err, ErrUnsupported) {t.Errorf("expected ErrUnsupported, got %v", err)}
+
+    buf := bytes.Buffer{}
+    png.Encode(&buf, testImage(101, 1))
+    _, err = Process(buf.Bytes(), opts)
+    if !errors.Is(err, ErrTooBig) {t.Errorf("expected ErrTooBig, got %v", err)}
+
+    // too many frames, and frames that fit the frame limit but not the pixel limit
+    for _, tst := range []struct{frames, side int}{{4, 1}, {3, 6}} {
+        g := &gif.GIF{}
+        for i := 0; i < tst.frames; i++ {
+            g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, tst.side, tst.side), color.Palette{color.Black, color.White}))
+            g.Delay = append(g.Delay, 10)
+        }
+        buf.Reset()
+        gif.EncodeAll(&buf, g)
+
+        _, err = Process(buf.Bytes(), opts)
+        if !errors.Is(err, ErrTooManyFrames) {t.Errorf("%d frames of %dx%d: expected ErrTooManyFrames, got %v", tst.frames, tst.side, tst.side, err)}
+    }
+
+    // a truncated gif is refused before decoding
+    _, err = Process(buf.Bytes()[:buf.Len() - 20], opts)
+    if err == nil || errors.Is(err, ErrTooManyFrames) {t.Errorf("expected a read error, got %v", err)}
+}
+
+func TestStripWebP(t *testing.T) {
+    chunk := func(fourcc string, payload []byte) []byte {
+        c := append([]byte(fourcc), binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))...)
+        c = append(c, payload...)
+        if len(payload) % 2 == 1 {c = append(c, 0)}
+        return c
+    }
+
+    body := []byte("WEBP")
+    body = append(body, chunk("VP8X", []byte{0x0C, 0, 0, 0, 0, 0, 0, 0, 0, 0})...)
+    body = append(body, chunk("VP8L", []byte("pixels!"))...)
+    body = append(body, chunk("EXIF", []byte("gps-secret"))...)
+    body = append(body, chunk("XMP ", []byte("<x/>"))...)
+    data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+    data = append(data, body...)
+
+    out, err := stripWebP(data)
+    if err != nil {t.Fatal(err)}
+
+    if bytes.Contains(out, []byte("gps-secret")) || bytes.Contains(out, []byte("XMP ")) {t.Errorf("expected metadata chunks to be stripped")}
+    if !bytes.Contains(out, []byte("pixels!")) {t.Errorf("expected image chunk to be kept")}
+    if out[20] != 0 {t.Errorf("expected exif and xmp flags to be cleared, got %#x", out[20])}
+    if int(binary.LittleEndian.Uint32(out[4:])) != len(out) - 8 {t.Errorf("expected riff size to match")}
+}
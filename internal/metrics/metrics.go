@@ -0,0 +1,101 @@
+package metrics
+
+import (
+    "database/sql"
+    "net/http"
+    "strconv"
+    "time"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/collectors"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds every collector chirpy exports on /metrics
+type Metrics struct {
+    reg      *prometheus.Registry
+    requests *prometheus.CounterVec
+    duration *prometheus.HistogramVec
+    InFlight prometheus.Gauge
+
+    ChirpsCreated prometheus.Counter
+    ChirpsDeleted prometheus.Counter
+    // by result: success, unknown_email, wrong_password, error
+    Logins   *prometheus.CounterVec
+    // polka webhooks by outcome: upgraded, ignored, unauthorized, invalid, failed
+    Webhooks *prometheus.CounterVec
+}
+
+func New(db *sql.DB) *Metrics {
+    m := &Metrics{
+        reg: prometheus.NewRegistry(),
+        requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Name: "chirpy_http_requests_total",
+            Help: "HTTP requests by route pattern, method and status code.",
+        }, []string{"route", "method", "code"}),
+        duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Name: "chirpy_http_request_duration_seconds",
+            Help: "HTTP request latency by route pattern, method and status code.",
+            Buckets: prometheus.DefBuckets,
+        }, []string{"route", "method", "code"}),
+        InFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+            Name: "chirpy_http_requests_in_flight",
+            Help: "HTTP requests currently being served.",
+        }),
+        ChirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+            Name: "chirpy_chirps_created_total",
+            Help: "Chirps created.",
+        }),
+        ChirpsDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+            Name: "chirpy_chirps_deleted_total",
+            Help: "Chirps deleted.",
+        }),
+        Logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Name: "chirpy_logins_total",
+            Help: "Login attempts by result.",
+        }, []string{"result"}),
+        Webhooks: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Name: "chirpy_webhooks_total",
+            Help: "Incoming polka webhooks by outcome.",
+        }, []string{"outcome"}),
+    }
+
+    m.reg.MustRegister(
+        m.requests, m.duration, m.InFlight,
+        m.ChirpsCreated, m.ChirpsDeleted, m.Logins, m.Webhooks,
+        collectors.NewGoCollector(),
+        collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+    )
+    if db != nil {m.reg.MustRegister(collectors.NewDBStatsCollector(db, "chirpy"))}
+
+    return m
+}
+
+// Register adds extra collectors such as gauges backed by existing counters
+func (m *Metrics) Register(cs ...prometheus.Collector) {
+    m.reg.MustRegister(cs...)
+}
+
+// Handler serves the registry in prometheus text format
+func (m *Metrics) Handler() http.Handler {
+    return promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records one finished request, route must be the mux pattern
+// and never the raw path so label cardinality stays bounded
+func (m *Metrics) ObserveRequest(route, method string, code int, took time.Duration) {
+    if route == "" {route = "unmatched"}
+
+    method = normalizeMethod(method)
+    status := strconv.Itoa(code)
+    m.requests.WithLabelValues(route, method, status).Inc()
+    m.duration.WithLabelValues(route, method, status).Observe(took.Seconds())
+}
+
+// unknown methods would be unbounded label values
+func normalizeMethod(method string) string {
+    switch method {
+    case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+        return method
+    }
+    return "OTHER"
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+    "io"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestObserveRequest(t *testing.T) {
+    m := New(nil)
+    m.ObserveRequest("GET /api/chirps/{chirpID}", "GET", 200, 5*time.Millisecond)
+    m.ObserveRequest("", "BREW", 404, time.Millisecond)
+    m.Logins.WithLabelValues("success").Inc()
+
+    rec := httptest.NewRecorder()
+    m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+    body, _ := io.ReadAll(rec.Body)
+
+    for _, want := range []string{
+        `chirpy_http_requests_total{code="200",method="GET",route="GET /api/chirps/{chirpID}"} 1`,
+        `chirpy_http_requests_total{code="404",method="OTHER",route="unmatched"} 1`,
+        `chirpy_http_request_duration_seconds_count{code="200",method="GET",route="GET /api/chirps/{chirpID}"} 1`,
+        `chirpy_logins_total{result="success"} 1`,
+    } {
+        if !strings.Contains(string(body), want) {t.Errorf("expected %q in output", want)}
+    }
+}
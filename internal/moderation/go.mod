@@ -0,0 +1,3 @@
+module github.com/sudonetizen/moderation
+
+go 1.24.2
@@ -0,0 +1,56 @@
+package moderation
+
+import (
+    "context"
+    "errors"
+    "strings"
+)
+
+// ErrRejected is returned by a hook that refuses a body outright
+var ErrRejected = errors.New("body was rejected by moderation")
+
+// Hook inspects a body before it is stored, it returns the body to keep,
+// possibly rewritten, or an error wrapping ErrRejected
+type Hook interface {
+    Moderate(ctx context.Context, body string) (string, error)
+}
+
+// HookFunc lets a plain function be a Hook
+type HookFunc func(ctx context.Context, body string) (string, error)
+
+func (f HookFunc) Moderate(ctx context.Context, body string) (string, error) {
+    return f(ctx, body)
+}
+
+// Chain runs hooks in order, each one sees the body the previous one kept
+type Chain []Hook
+
+func (c Chain) Moderate(ctx context.Context, body string) (string, error) {
+    for _, hook := range c {
+        b, err := hook.Moderate(ctx, body)
+        if err != nil {return "", err}
+        body = b
+    }
+    return body, nil
+}
+
+// Profanity replaces every listed word with ****, words are matched ignoring
+// case and only when they stand alone
+func Profanity(words ...string) Hook {
+    profane := map[string]struct{}{}
+    for _, word := range words {profane[strings.ToLower(word)] = struct{}{}}
+
+    return HookFunc(func(_ context.Context, body string) (string, error) {
+        res := body
+        for _, word := range strings.Fields(body) {
+            _, ok := profane[strings.ToLower(word)]
+            if ok {res = strings.ReplaceAll(res, word, "****")}
+        }
+        return res, nil
+    })
+}
+
+// Default is the moderation every chirp and message goes through
+func Default() Chain {
+    return Chain{Profanity("kerfuffle", "sharbert", "fornax")}
+}
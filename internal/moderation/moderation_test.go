@@ -0,0 +1,43 @@
+package moderation
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "testing"
+)
+
+func TestProfanity(t *testing.T) {
+    tests := []struct {
+        in   string
+        want string
+    }{
+        {"I had something interesting for breakfast", "I had something interesting for breakfast"},
+        {"I hear Mastodon is better than Chirpy. sharbert I need to migrate", "I hear Mastodon is better than Chirpy. **** I need to migrate"},
+        {"I really need a kerfuffle to go to bed sooner, Fornax !", "I really need a **** to go to bed sooner, **** !"},
+        {"a sharbert! is not a word on its own", "a sharbert! is not a word on its own"},
+    }
+
+    hook := Default()
+    for _, tt := range tests {
+        got, err := hook.Moderate(context.Background(), tt.in)
+        if err != nil {t.Fatalf("%q: %v", tt.in, err)}
+        if got != tt.want {t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)}
+    }
+}
+
+func TestChain(t *testing.T) {
+    upper := HookFunc(func(_ context.Context, body string) (string, error) {return strings.ToUpper(body), nil})
+    reject := HookFunc(func(_ context.Context, body string) (string, error) {
+        if strings.Contains(body, "SPAM") {return "", fmt.Errorf("%w: spam", ErrRejected)}
+        return body, nil
+    })
+    chain := Chain{Profanity("fornax"), upper, reject}
+
+    got, err := chain.Moderate(context.Background(), "hello fornax")
+    if err != nil || got != "HELLO ****" {t.Errorf("got %q, %v", got, err)}
+
+    _, err = chain.Moderate(context.Background(), "buy spam")
+    if !errors.Is(err, ErrRejected) {t.Errorf("want ErrRejected, got %v", err)}
+}
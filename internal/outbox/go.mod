@@ -0,0 +1,12 @@
+module github.com/sudonetizen/outbox
+
+go 1.24.2
+
+require github.com/sudonetizen/database v0.0.0
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/lib/pq v1.10.9 // indirect
+)
+
+replace github.com/sudonetizen/database v0.0.0 => ../database/
@@ -0,0 +1,38 @@
+package outbox
+
+import (
+    "context"
+    "encoding/json"
+    "time"
+    "github.com/sudonetizen/database"
+)
+
+// topics written by chirpy handlers
+const (
+    TopicChirpCreated = "chirp.created"
+    TopicChirpDeleted = "chirp.deleted"
+)
+
+// Event is one row of the outbox table as seen by sinks
+type Event struct {
+    ID        int64           `json:"id"`
+    CreatedAt time.Time       `json:"created_at"`
+    Topic     string          `json:"topic"`
+    Payload   json.RawMessage `json:"payload"`
+}
+
+// Write stores an event in the outbox, q should be bound to the same
+// transaction as the domain change so both commit or roll back together
+func Write(ctx context.Context, q *database.Queries, topic string, payload any) (Event, error) {
+    data, err := json.Marshal(payload)
+    if err != nil {return Event{}, err}
+
+    row, err := q.CreateOutboxEvent(ctx, database.CreateOutboxEventParams{Topic: topic, Payload: data})
+    if err != nil {return Event{}, err}
+
+    return fromRow(row), nil
+}
+
+func fromRow(row database.Outbox) Event {
+    return Event{ID: row.ID, CreatedAt: row.CreatedAt, Topic: row.Topic, Payload: row.Payload}
+}
@@ -0,0 +1,58 @@
+package outbox
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestBusPublishSubscribe(t *testing.T) {
+    bus := NewBus()
+    created, cancelCreated := bus.Subscribe(TopicChirpCreated, 1)
+    all, cancelAll := bus.Subscribe("", 2)
+    defer cancelAll()
+
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+
+    err := bus.Publish(ctx, Event{ID: 1, Topic: TopicChirpCreated})
+    if err != nil {t.Fatalf("error with Publish: %v\n", err)}
+
+    err = bus.Publish(ctx, Event{ID: 2, Topic: TopicChirpDeleted})
+    if err != nil {t.Fatalf("error with Publish: %v\n", err)}
+
+    if ev := <-created; ev.ID != 1 {t.Errorf("expected event 1, got %d", ev.ID)}
+    if ev := <-all; ev.ID != 1 {t.Errorf("expected event 1, got %d", ev.ID)}
+    if ev := <-all; ev.ID != 2 {t.Errorf("expected event 2, got %d", ev.ID)}
+
+    // a cancelled subscriber must not block publishing
+    cancelCreated()
+    err = bus.Publish(ctx, Event{ID: 3, Topic: TopicChirpCreated})
+    if err != nil {t.Errorf("error with Publish after cancel: %v\n", err)}
+}
+
+func TestWebhookSink(t *testing.T) {
+    tests := []struct {
+        status  int
+        wantErr bool
+    }{
+        {status: 204, wantErr: false},
+        {status: 500, wantErr: true},
+    }
+
+    for _, tst := range tests {
+        delivery := ""
+        srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            delivery = r.Header.Get("X-Chirpy-Delivery")
+            w.WriteHeader(tst.status)
+        }))
+
+        err := NewWebhookSink(srv.URL).Publish(context.Background(), Event{ID: 42, Topic: TopicChirpCreated, Payload: []byte(`{}`)})
+        srv.Close()
+
+        if (err != nil) != tst.wantErr {t.Errorf("status %d: unexpected error %v", tst.status, err)}
+        if delivery != "42" {t.Errorf("expected delivery id 42, got %q", delivery)}
+    }
+}
@@ -0,0 +1,68 @@
+package outbox
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "log/slog"
+    "time"
+    "github.com/sudonetizen/database"
+)
+
+// Relay publishes outbox events to sinks, every sink has its own checkpoint
+// which only advances after the sink accepted an event (at-least-once)
+type Relay struct {
+    db       *database.Queries
+    sinks    []Sink
+    Interval time.Duration
+    Batch    int32
+}
+
+func NewRelay(db *database.Queries, sinks ...Sink) *Relay {
+    return &Relay{db: db, sinks: sinks, Interval: time.Second, Batch: 100}
+}
+
+// Run polls the outbox until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+    ticker := time.NewTicker(r.Interval)
+    defer ticker.Stop()
+
+    for {
+        for _, s := range r.sinks {
+            err := r.relay(ctx, s)
+            if err != nil && ctx.Err() == nil {
+                slog.ErrorContext(ctx, "error with relaying outbox", "sink", s.Name(), "error", err)
+            }
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// relays one batch to sink, stops at the first failed event so it is retried
+func (r *Relay) relay(ctx context.Context, s Sink) error {
+    // a sink without a checkpoint starts at the beginning
+    last, err := r.db.GetOutboxCheckpoint(ctx, s.Name())
+    if err != nil && !errors.Is(err, sql.ErrNoRows) {return err}
+
+    rows, err := r.db.GetOutboxEvents(ctx, database.GetOutboxEventsParams{
+        AfterXid: last.LastXid,
+        AfterID: last.LastID,
+        MaxEvents: r.Batch,
+    })
+    if err != nil {return err}
+
+    for _, row := range rows {
+        err = s.Publish(ctx, fromRow(row))
+        if err != nil {return err}
+
+        err = r.db.SaveOutboxCheckpoint(ctx, database.SaveOutboxCheckpointParams{Sink: s.Name(), LastXid: row.Xid, LastID: row.ID})
+        if err != nil {return err}
+    }
+
+    return nil
+}
@@ -0,0 +1,127 @@
+package outbox
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// Sink receives outbox events from the relay, an event may be published more
+// than once so sinks and their consumers must tolerate duplicates
+type Sink interface {
+    Name() string
+    Publish(ctx context.Context, ev Event) error
+}
+
+// LogSink writes every event to the standard logger
+type LogSink struct{}
+
+func (LogSink) Name() string {return "log"}
+
+func (LogSink) Publish(ctx context.Context, ev Event) error {
+    slog.InfoContext(ctx, "outbox event", "id", ev.ID, "topic", ev.Topic, "payload", string(ev.Payload))
+    return nil
+}
+
+// WebhookSink posts every event as json to an outbound url
+type WebhookSink struct {
+    URL    string
+    Client *http.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+    return &WebhookSink{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *WebhookSink) Name() string {return "webhook"}
+
+func (s *WebhookSink) Publish(ctx context.Context, ev Event) error {
+    data, err := json.Marshal(ev)
+    if err != nil {return err}
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(data))
+    if err != nil {return err}
+
+    // receivers dedupe redeliveries by this id
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-Chirpy-Event", ev.Topic)
+    req.Header.Set("X-Chirpy-Delivery", strconv.FormatInt(ev.ID, 10))
+
+    res, err := s.Client.Do(req)
+    if err != nil {return err}
+    defer res.Body.Close()
+
+    if res.StatusCode < 200 || res.StatusCode > 299 {
+        return fmt.Errorf("webhook responded with status %d", res.StatusCode)
+    }
+
+    return nil
+}
+
+// Bus is an in-process pub/sub sink, subscribers get events by topic
+type Bus struct {
+    mu   sync.Mutex
+    subs map[string]map[*subscription]struct{}
+}
+
+type subscription struct {
+    ch   chan Event
+    done chan struct{}
+}
+
+func NewBus() *Bus {
+    return &Bus{subs: map[string]map[*subscription]struct{}{}}
+}
+
+func (b *Bus) Name() string {return "bus"}
+
+// Subscribe returns a channel of events for topic and a func that cancels
+// the subscription, an empty topic subscribes to every topic
+func (b *Bus) Subscribe(topic string, buffer int) (<-chan Event, func()) {
+    sub := &subscription{ch: make(chan Event, buffer), done: make(chan struct{})}
+
+    b.mu.Lock()
+    if b.subs[topic] == nil {b.subs[topic] = map[*subscription]struct{}{}}
+    b.subs[topic][sub] = struct{}{}
+    b.mu.Unlock()
+
+    var once sync.Once
+    cancel := func() {
+        once.Do(func() {
+            b.mu.Lock()
+            delete(b.subs[topic], sub)
+            b.mu.Unlock()
+            close(sub.done)
+        })
+    }
+
+    return sub.ch, cancel
+}
+
+// Publish hands the event to every subscriber, it waits for slow subscribers
+// so the relay does not advance its checkpoint past undelivered events
+func (b *Bus) Publish(ctx context.Context, ev Event) error {
+    b.mu.Lock()
+    subs := []*subscription{}
+    for _, topic := range []string{ev.Topic, ""} {
+        for sub := range b.subs[topic] {subs = append(subs, sub)}
+    }
+    b.mu.Unlock()
+
+    for _, sub := range subs {
+        select {
+        case sub.ch <- ev:
+        case <-sub.done:
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,7 @@
+module github.com/sudonetizen/problem
+
+go 1.24.2
+
+require github.com/sudonetizen/logging v0.0.0
+
+replace github.com/sudonetizen/logging v0.0.0 => ../logging/
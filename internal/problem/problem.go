@@ -0,0 +1,94 @@
+package problem
+
+import (
+    "encoding/json"
+    "log/slog"
+    "net/http"
+    "github.com/sudonetizen/logging"
+)
+
+// ContentType of every error response, rfc 9457
+const ContentType = "application/problem+json"
+
+// Code is a stable machine readable error code, clients match on it instead
+// of on titles or details
+type Code string
+
+const (
+    InvalidJSON        Code = "invalid_json"
+    BodyTooLarge       Code = "body_too_large"
+    UnsupportedMedia   Code = "unsupported_media_type"
+    InvalidUpload      Code = "invalid_upload"
+    ValidationFailed   Code = "validation_failed"
+    InvalidID          Code = "invalid_id"
+    InvalidQuery       Code = "invalid_query"
+    MissingToken       Code = "missing_token"
+    InvalidToken       Code = "invalid_token"
+    InvalidCredentials Code = "invalid_credentials"
+    InvalidAPIKey      Code = "invalid_api_key"
+    Forbidden          Code = "forbidden"
+    NotFound           Code = "not_found"
+    Conflict           Code = "conflict"
+    RateLimited        Code = "rate_limited"
+    Internal           Code = "internal"
+)
+
+// FieldError points at one invalid field of a payload or query
+type FieldError struct {
+    Field   string `json:"field"`
+    Code    string `json:"code"`
+    Message string `json:"message"`
+}
+
+// Problem is the body of an error response
+type Problem struct {
+    Type      string       `json:"type"`
+    Title     string       `json:"title"`
+    Status    int          `json:"status"`
+    Detail    string       `json:"detail,omitempty"`
+    Instance  string       `json:"instance,omitempty"`
+    Code      Code         `json:"code"`
+    RequestID string       `json:"request_id,omitempty"`
+    Errors    []FieldError `json:"errors,omitempty"`
+}
+
+func New(status int, code Code, detail string) *Problem {
+    return &Problem{
+        Type: "urn:chirpy:problem:" + string(code),
+        Title: http.StatusText(status),
+        Status: status,
+        Detail: detail,
+        Code: code,
+    }
+}
+
+// Validation is a 400 listing every invalid field
+func Validation(errs ...FieldError) *Problem {
+    p := New(400, ValidationFailed, "request has invalid fields")
+    p.Errors = errs
+    return p
+}
+
+func (p *Problem) Error() string {
+    if p.Detail == "" {return string(p.Code)}
+    return string(p.Code) + ": " + p.Detail
+}
+
+// Write sends p with the request's path and id filled in
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+    res := *p
+    res.Instance = r.URL.Path
+    res.RequestID = logging.RequestID(r.Context())
+
+    data, err := json.Marshal(res)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with marshalling problem", "error", err)
+        w.WriteHeader(res.Status)
+        return
+    }
+
+    w.Header().Set("Content-Type", ContentType)
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.WriteHeader(res.Status)
+    w.Write(data)
+}
@@ -0,0 +1,29 @@
+package problem
+
+import (
+    "encoding/json"
+    "net/http/httptest"
+    "testing"
+    "github.com/sudonetizen/logging"
+)
+
+func TestWrite(t *testing.T) {
+    r := logging.WithRequest(httptest.NewRequest("POST", "/api/chirps", nil), "req-1")
+    rec := httptest.NewRecorder()
+
+    Write(rec, r, Validation(FieldError{Field: "body", Code: "too_long", Message: "at most 140 characters"}))
+
+    if rec.Code != 400 {t.Errorf("expected code 400, got %d", rec.Code)}
+    if ct := rec.Header().Get("Content-Type"); ct != ContentType {t.Errorf("expected %s, got %s", ContentType, ct)}
+
+    p := Problem{}
+    err := json.Unmarshal(rec.Body.Bytes(), &p)
+    if err != nil {t.Fatal(err)}
+
+    if p.Code != ValidationFailed {t.Errorf("expected code %s, got %s", ValidationFailed, p.Code)}
+    if p.Type != "urn:chirpy:problem:validation_failed" {t.Errorf("unexpected type %s", p.Type)}
+    if p.Title != "Bad Request" {t.Errorf("unexpected title %s", p.Title)}
+    if p.Instance != "/api/chirps" {t.Errorf("unexpected instance %s", p.Instance)}
+    if p.RequestID != "req-1" {t.Errorf("expected request id req-1, got %s", p.RequestID)}
+    if len(p.Errors) != 1 || p.Errors[0].Field != "body" {t.Errorf("unexpected field errors %+v", p.Errors)}
+}
@@ -0,0 +1,3 @@
+module github.com/sudonetizen/storage
+
+go 1.24.2
@@ -0,0 +1,170 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+)
+
+// S3 stores objects in a bucket of any s3 compatible service, requests are
+// path style (endpoint/bucket/key) and signed with aws signature v4
+type S3 struct {
+    Endpoint  string
+    Bucket    string
+    Region    string
+    AccessKey string
+    SecretKey string
+    Client    *http.Client
+
+    // for tests, time.Now otherwise
+    now func() time.Time
+}
+
+func NewS3(endpoint, bucket, region, accessKey, secretKey string) *S3 {
+    return &S3{
+        Endpoint: strings.TrimSuffix(endpoint, "/"),
+        Bucket: bucket,
+        Region: region,
+        AccessKey: accessKey,
+        SecretKey: secretKey,
+        Client: &http.Client{Timeout: 30 * time.Second},
+        now: time.Now,
+    }
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+    res, err := s.do(ctx, http.MethodPut, key, data, contentType)
+    if err != nil {return err}
+    defer res.Body.Close()
+
+    if res.StatusCode != 200 {return s3Error(res)}
+    return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+    res, err := s.do(ctx, http.MethodGet, key, nil, "")
+    if err != nil {return nil, err}
+
+    switch res.StatusCode {
+    case 200:
+        return res.Body, nil
+    case 404:
+        res.Body.Close()
+        return nil, ErrNotFound
+    default:
+        defer res.Body.Close()
+        return nil, s3Error(res)
+    }
+}
+
+// Delete succeeds for missing keys too, s3 answers 204 either way
+func (s *S3) Delete(ctx context.Context, key string) error {
+    res, err := s.do(ctx, http.MethodDelete, key, nil, "")
+    if err != nil {return err}
+    defer res.Body.Close()
+
+    if res.StatusCode != 204 && res.StatusCode != 200 && res.StatusCode != 404 {return s3Error(res)}
+    return nil
+}
+
+func s3Error(res *http.Response) error {
+    body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+    return fmt.Errorf("s3 responded with status %d: %s", res.StatusCode, bytes.TrimSpace(body))
+}
+
+func (s *S3) do(ctx context.Context, method, key string, data []byte, contentType string) (*http.Response, error) {
+    err := checkKey(key)
+    if err != nil {return nil, err}
+
+    // every segment escaped once, slashes kept
+    path := "/" + uriEncode(s.Bucket)
+    for _, part := range strings.Split(key, "/") {path += "/" + uriEncode(part)}
+
+    req, err := http.NewRequestWithContext(ctx, method, s.Endpoint + path, bytes.NewReader(data))
+    if err != nil {return nil, err}
+    req.URL.RawPath = path
+    if contentType != "" {req.Header.Set("Content-Type", contentType)}
+
+    s.sign(req, data)
+    return s.Client.Do(req)
+}
+
+// sign adds the sigv4 headers, the payload hash is always sent since the
+// objects are in memory anyway
+func (s *S3) sign(req *http.Request, data []byte) {
+    now := s.now().UTC()
+    amzDate := now.Format("20060102T150405Z")
+    date := now.Format("20060102")
+    payloadHash := hexSHA256(data)
+
+    req.Header.Set("X-Amz-Date", amzDate)
+    req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+    headers := map[string]string{
+        "host": req.URL.Host,
+        "x-amz-content-sha256": payloadHash,
+        "x-amz-date": amzDate,
+    }
+    if ct := req.Header.Get("Content-Type"); ct != "" {headers["content-type"] = ct}
+
+    names := []string{}
+    for n := range headers {names = append(names, n)}
+    sort.Strings(names)
+
+    canonHeaders := ""
+    for _, n := range names {canonHeaders += n + ":" + strings.TrimSpace(headers[n]) + "\n"}
+    signed := strings.Join(names, ";")
+
+    canonRequest := strings.Join([]string{
+        req.Method,
+        req.URL.EscapedPath(),
+        req.URL.RawQuery,
+        canonHeaders,
+        signed,
+        payloadHash,
+    }, "\n")
+
+    scope := date + "/" + s.Region + "/s3/aws4_request"
+    toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonRequest))
+
+    key := hmacSHA256([]byte("AWS4" + s.SecretKey), date)
+    key = hmacSHA256(key, s.Region)
+    key = hmacSHA256(key, "s3")
+    key = hmacSHA256(key, "aws4_request")
+    sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+    req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.AccessKey, scope, signed, sig))
+}
+
+func hexSHA256(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    h := hmac.New(sha256.New, key)
+    h.Write([]byte(data))
+    return h.Sum(nil)
+}
+
+// rfc 3986 escaping as sigv4 wants it, url.PathEscape leaves some reserved
+// characters like + and = alone
+func uriEncode(s string) string {
+    out := strings.Builder{}
+    for _, b := range []byte(s) {
+        if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' {
+            out.WriteByte(b)
+        } else {
+            fmt.Fprintf(&out, "%%%02X", b)
+        }
+    }
+    return out.String()
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// ErrNotFound is returned by Get for keys that were never stored or deleted
+var ErrNotFound = errors.New("object not found")
+
+// Store keeps objects by key, keys are slash separated like media/<id>
+type Store interface {
+    Put(ctx context.Context, key string, data []byte, contentType string) error
+    Get(ctx context.Context, key string) (io.ReadCloser, error)
+    Delete(ctx context.Context, key string) error
+}
+
+// keys come from the app but are still checked so they never leave the store
+func checkKey(key string) error {
+    if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+        return fmt.Errorf("invalid key %q", key)
+    }
+    for _, part := range strings.Split(key, "/") {
+        if part == "" || part == "." || part == ".." {return fmt.Errorf("invalid key %q", key)}
+    }
+    return nil
+}
+
+// FS stores objects as files below a directory
+type FS struct {
+    Dir string
+}
+
+func NewFS(dir string) (*FS, error) {
+    err := os.MkdirAll(dir, 0o755)
+    if err != nil {return nil, err}
+    return &FS{Dir: dir}, nil
+}
+
+func (s *FS) path(key string) (string, error) {
+    err := checkKey(key)
+    if err != nil {return "", err}
+    return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temp file first so readers never see half an object
+func (s *FS) Put(ctx context.Context, key string, data []byte, contentType string) error {
+    p, err := s.path(key)
+    if err != nil {return err}
+
+    err = os.MkdirAll(filepath.Dir(p), 0o755)
+    if err != nil {return err}
+
+    tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+    if err != nil {return err}
+    defer os.Remove(tmp.Name())
+
+    _, err = tmp.Write(data)
+    if err == nil {err = tmp.Sync()}
+    if cerr := tmp.Close(); err == nil {err = cerr}
+    if err != nil {return err}
+
+    return os.Rename(tmp.Name(), p)
+}
+
+func (s *FS) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+    p, err := s.path(key)
+    if err != nil {return nil, err}
+
+    f, err := os.Open(p)
+    if errors.Is(err, os.ErrNotExist) {return nil, ErrNotFound}
+    return f, err
+}
+
+func (s *FS) Delete(ctx context.Context, key string) error {
+    p, err := s.path(key)
+    if err != nil {return err}
+
+    err = os.Remove(p)
+    if errors.Is(err, os.ErrNotExist) {return nil}
+    return err
+}
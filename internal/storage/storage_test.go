@@ -0,0 +1,109 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// fakeS3 is a local stand-in for an s3 bucket that checks every signature
+type fakeS3 struct {
+    signer   *S3
+    mu       sync.Mutex
+    objects  map[string][]byte
+    rejected int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    body, _ := io.ReadAll(r.Body)
+
+    // signing the received request again must give the same header
+    check := r.Clone(context.Background())
+    check.URL.Host = r.Host
+    f.signer.sign(check, body)
+
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    if r.Header.Get("Authorization") != check.Header.Get("Authorization") {
+        f.rejected++
+        w.WriteHeader(403)
+        return
+    }
+
+    switch r.Method {
+    case http.MethodPut:
+        f.objects[r.URL.EscapedPath()] = body
+        w.WriteHeader(200)
+    case http.MethodGet:
+        data, ok := f.objects[r.URL.EscapedPath()]
+        if !ok {
+            w.WriteHeader(404)
+            return
+        }
+        w.Write(data)
+    case http.MethodDelete:
+        delete(f.objects, r.URL.EscapedPath())
+        w.WriteHeader(204)
+    }
+}
+
+func testStore(t *testing.T, name string, s Store) {
+    ctx := context.Background()
+
+    err := s.Put(ctx, "media/a b+c.png", []byte("image"), "image/png")
+    if err != nil {t.Fatalf("%s: put: %v", name, err)}
+
+    rc, err := s.Get(ctx, "media/a b+c.png")
+    if err != nil {t.Fatalf("%s: get: %v", name, err)}
+    data, _ := io.ReadAll(rc)
+    rc.Close()
+    if string(data) != "image" {t.Errorf("%s: expected image, got %q", name, data)}
+
+    err = s.Delete(ctx, "media/a b+c.png")
+    if err != nil {t.Errorf("%s: delete: %v", name, err)}
+
+    _, err = s.Get(ctx, "media/a b+c.png")
+    if !errors.Is(err, ErrNotFound) {t.Errorf("%s: expected ErrNotFound after delete, got %v", name, err)}
+
+    err = s.Put(ctx, "media/../../etc/passwd", []byte("x"), "")
+    if err == nil {t.Errorf("%s: expected traversal key to be refused", name)}
+}
+
+func TestFS(t *testing.T) {
+    s, err := NewFS(t.TempDir())
+    if err != nil {t.Fatal(err)}
+    testStore(t, "fs", s)
+}
+
+func TestS3(t *testing.T) {
+    fake := &fakeS3{objects: map[string][]byte{}}
+    srv := httptest.NewServer(fake)
+    defer srv.Close()
+
+    fixed := func() time.Time {return time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+    s := NewS3(srv.URL, "chirpy", "us-east-1", "AKID", "secret")
+    s.now = fixed
+    fake.signer = NewS3(srv.URL, "chirpy", "us-east-1", "AKID", "secret")
+    fake.signer.now = fixed
+
+    testStore(t, "s3", s)
+    if fake.rejected > 0 {t.Errorf("expected every signature to match, %d rejected", fake.rejected)}
+
+    // keys are escaped once per segment
+    for k := range fake.objects {t.Errorf("expected bucket to be empty, has %s", k)}
+    s.Put(context.Background(), "media/a b", []byte("x"), "")
+    if _, ok := fake.objects["/chirpy/media/a%20b"]; !ok {t.Errorf("expected path style key, got %v", fake.objects)}
+
+    // a wrong secret is refused by the signature check
+    bad := NewS3(srv.URL, "chirpy", "us-east-1", "AKID", "wrong")
+    bad.now = fixed
+    err := bad.Put(context.Background(), "media/x", []byte("x"), "")
+    if err == nil || !strings.Contains(err.Error(), "403") {t.Errorf("expected 403 for a bad signature, got %v", err)}
+}
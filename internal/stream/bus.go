@@ -0,0 +1,121 @@
+package stream
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "log/slog"
+    "sync"
+    "time"
+    "github.com/lib/pq"
+)
+
+// Bus carries events between instances, every subscriber gets every event
+type Bus interface {
+    Publish(ctx context.Context, ev Event) error
+    Subscribe(ctx context.Context) (<-chan Event, error)
+}
+
+// LocalBus only reaches subscribers in this process
+type LocalBus struct {
+    mu   sync.Mutex
+    subs map[chan Event]struct{}
+}
+
+func NewLocalBus() *LocalBus {
+    return &LocalBus{subs: map[chan Event]struct{}{}}
+}
+
+func (l *LocalBus) Publish(ctx context.Context, ev Event) error {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    for ch := range l.subs {
+        select {
+        case ch <- ev:
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    }
+    return nil
+}
+
+func (l *LocalBus) Subscribe(ctx context.Context) (<-chan Event, error) {
+    ch := make(chan Event, 64)
+
+    l.mu.Lock()
+    l.subs[ch] = struct{}{}
+    l.mu.Unlock()
+
+    go func() {
+        <-ctx.Done()
+        l.mu.Lock()
+        delete(l.subs, ch)
+        l.mu.Unlock()
+        close(ch)
+    }()
+
+    return ch, nil
+}
+
+// PGBus shares events between instances with postgres LISTEN/NOTIFY
+type PGBus struct {
+    db      *sql.DB
+    dsn     string
+    channel string
+}
+
+func NewPGBus(db *sql.DB, dsn string) *PGBus {
+    return &PGBus{db: db, dsn: dsn, channel: "chirpy_stream"}
+}
+
+func (p *PGBus) Publish(ctx context.Context, ev Event) error {
+    data, err := json.Marshal(ev)
+    if err != nil {return err}
+
+    _, err = p.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", p.channel, string(data))
+    return err
+}
+
+func (p *PGBus) Subscribe(ctx context.Context) (<-chan Event, error) {
+    listener := pq.NewListener(p.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+        if err != nil {slog.Error("error with stream listener", "error", err)}
+    })
+
+    err := listener.Listen(p.channel)
+    if err != nil {
+        listener.Close()
+        return nil, err
+    }
+
+    ch := make(chan Event, 64)
+    go func() {
+        defer close(ch)
+        defer listener.Close()
+
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case n := <-listener.Notify:
+                // nil after a reconnect, events sent meanwhile are lost
+                if n == nil {continue}
+
+                ev := Event{}
+                err := json.Unmarshal([]byte(n.Extra), &ev)
+                if err != nil {
+                    slog.ErrorContext(ctx, "error with decoding stream event", "error", err)
+                    continue
+                }
+
+                select {
+                case ch <- ev:
+                case <-ctx.Done():
+                    return
+                }
+            }
+        }
+    }()
+
+    return ch, nil
+}
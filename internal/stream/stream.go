@@ -0,0 +1,204 @@
+package stream
+
+import (
+    "context"
+    "encoding/json"
+    "log/slog"
+    "strings"
+    "sync"
+    "unicode"
+    "github.com/google/uuid"
+)
+
+// Event is a change pushed to streaming clients, ID is the outbox id so it is
+// the same on every instance, ids are not ordered because transactions commit
+// out of order, the order events arrive in is the commit order
+type Event struct {
+    ID     int64           `json:"id"`
+    Type   string          `json:"type"`
+    Author uuid.UUID       `json:"author"`
+    Body   string          `json:"body"`
+    Data   json.RawMessage `json:"data"`
+    // set for events addressed to one user such as notifications
+    Recipient uuid.UUID    `json:"recipient"`
+}
+
+// Resumable reports whether the event has an outbox id, events without one
+// are only pushed live and are never replayed
+func (ev Event) Resumable() bool {
+    return ev.ID != 0
+}
+
+// Filter narrows a subscription, zero values match everything public
+type Filter struct {
+    Author uuid.UUID
+    Tag    string
+    // only events addressed to this user, public events never match it
+    Recipient uuid.UUID
+    // only events whose type starts with Kind, e.g. "message."
+    Kind string
+    // only events by these authors, nil matches every author
+    Authors map[uuid.UUID]bool
+    // events by these authors never match, e.g. muted or blocked ones
+    Hidden map[uuid.UUID]bool
+}
+
+func (f Filter) Match(ev Event) bool {
+    if f.Recipient != ev.Recipient {return false}
+    if !strings.HasPrefix(ev.Type, f.Kind) {return false}
+    if f.Author != uuid.Nil && f.Author != ev.Author {return false}
+    if f.Authors != nil && !f.Authors[ev.Author] {return false}
+    if f.Hidden[ev.Author] {return false}
+    if f.Tag == "" {return true}
+
+    for _, tag := range Tags(ev.Body) {
+        if strings.EqualFold(tag, f.Tag) {return true}
+    }
+    return false
+}
+
+// Tags returns the #hashtags of a chirp body without the leading #
+func Tags(body string) []string {
+    tags := []string{}
+    for _, word := range strings.Fields(body) {
+        if !strings.HasPrefix(word, "#") {continue}
+
+        tag := strings.TrimRightFunc(word[1:], func(r rune) bool {return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'})
+        if tag != "" {tags = append(tags, tag)}
+    }
+    return tags
+}
+
+// Client is one subscriber, its channel is closed when the subscriber is
+// too slow to keep up or the broadcaster stops
+type Client struct {
+    ch     chan Event
+    filter Filter
+    b      *Broadcaster
+}
+
+func (c *Client) Events() <-chan Event {return c.ch}
+
+// Close unsubscribes the client
+func (c *Client) Close() {
+    c.b.mu.Lock()
+    defer c.b.mu.Unlock()
+    c.b.drop(c)
+}
+
+// Broadcaster fans events from a bus out to local clients and keeps a short
+// history so reconnecting clients can resume with Last-Event-ID
+type Broadcaster struct {
+    bus     Bus
+    buffer  int
+    mu      sync.Mutex
+    clients map[*Client]struct{}
+    history []Event
+    size    int
+    closed  bool
+}
+
+func New(bus Bus, history, buffer int) *Broadcaster {
+    return &Broadcaster{bus: bus, buffer: buffer, clients: map[*Client]struct{}{}, size: history}
+}
+
+// Publish sends ev to every instance sharing the bus
+func (b *Broadcaster) Publish(ctx context.Context, ev Event) error {
+    return b.bus.Publish(ctx, ev)
+}
+
+// Subscribe registers a client, events that arrived after lastID are replayed
+// first, a lastID no longer in the history replays the events with a greater id
+func (b *Broadcaster) Subscribe(filter Filter, lastID int64) *Client {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    replay := []Event{}
+    if lastID > 0 {
+        after := b.position(lastID)
+        for i, ev := range b.history {
+            if after >= 0 && i <= after {continue}
+            if after < 0 && ev.ID <= lastID {continue}
+            if filter.Match(ev) {replay = append(replay, ev)}
+        }
+    }
+
+    c := &Client{ch: make(chan Event, b.buffer+len(replay)), filter: filter, b: b}
+    for _, ev := range replay {c.ch <- ev}
+
+    if b.closed {
+        close(c.ch)
+        return c
+    }
+
+    b.clients[c] = struct{}{}
+    return c
+}
+
+// Run consumes the bus until ctx is cancelled, then disconnects every client
+func (b *Broadcaster) Run(ctx context.Context) error {
+    events, err := b.bus.Subscribe(ctx)
+    if err != nil {return err}
+
+    defer b.shutdown()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return nil
+        case ev, ok := <-events:
+            if !ok {return nil}
+            b.fanout(ev)
+        }
+    }
+}
+
+// position returns the index of the event with id in the history or -1,
+// must be called with mu held
+func (b *Broadcaster) position(id int64) int {
+    for i := len(b.history) - 1; i >= 0; i-- {
+        if b.history[i].ID == id {return i}
+    }
+    return -1
+}
+
+func (b *Broadcaster) fanout(ev Event) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    // the relay delivers at least once, a redelivered event was already sent
+    if ev.Resumable() {
+        if b.position(ev.ID) >= 0 {return}
+
+        b.history = append(b.history, ev)
+        if len(b.history) > b.size {b.history = b.history[len(b.history)-b.size:]}
+    }
+
+    for c := range b.clients {
+        if !c.filter.Match(ev) {continue}
+
+        // a slow client is dropped instead of stalling everyone, it can
+        // reconnect and resume from its last event id
+        select {
+        case c.ch <- ev:
+        default:
+            slog.Warn("dropping slow stream client")
+            b.drop(c)
+        }
+    }
+}
+
+// drop must be called with mu held
+func (b *Broadcaster) drop(c *Client) {
+    if _, ok := b.clients[c]; !ok {return}
+    delete(b.clients, c)
+    close(c.ch)
+}
+
+func (b *Broadcaster) shutdown() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    b.closed = true
+    for c := range b.clients {b.drop(c)}
+}
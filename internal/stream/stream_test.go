@@ -0,0 +1,121 @@
+package stream
+
+import (
+    "context"
+    "testing"
+    "time"
+    "github.com/google/uuid"
+)
+
+func TestFilterMatch(t *testing.T) {
+    author := uuid.New()
+
+    tests := []struct {
+        filter Filter
+        ev     Event
+        want   bool
+    }{
+        {filter: Filter{}, ev: Event{Author: author}, want: true},
+        {filter: Filter{Author: author}, ev: Event{Author: author}, want: true},
+        {filter: Filter{Author: author}, ev: Event{Author: uuid.New()}, want: false},
+        {filter: Filter{Tag: "go"}, ev: Event{Body: "learning #Go today!"}, want: true},
+        {filter: Filter{Tag: "go"}, ev: Event{Body: "learning #golang"}, want: false},
+        {filter: Filter{Tag: "go"}, ev: Event{Body: "no tags here"}, want: false},
+        {filter: Filter{}, ev: Event{Recipient: author}, want: false},
+        {filter: Filter{Recipient: author}, ev: Event{Recipient: author}, want: true},
+        {filter: Filter{Recipient: author}, ev: Event{Author: author}, want: false},
+        {filter: Filter{Recipient: author, Kind: "message."}, ev: Event{Type: "message.created", Recipient: author}, want: true},
+        {filter: Filter{Recipient: author, Kind: "message."}, ev: Event{Type: "notification.like", Recipient: author}, want: false},
+        {filter: Filter{Authors: map[uuid.UUID]bool{author: true}}, ev: Event{Author: author}, want: true},
+        {filter: Filter{Authors: map[uuid.UUID]bool{author: true}}, ev: Event{Author: uuid.New()}, want: false},
+        {filter: Filter{Authors: map[uuid.UUID]bool{}}, ev: Event{Author: author}, want: false},
+        {filter: Filter{Hidden: map[uuid.UUID]bool{author: true}}, ev: Event{Author: author}, want: false},
+        {filter: Filter{Authors: map[uuid.UUID]bool{author: true}, Hidden: map[uuid.UUID]bool{author: true}}, ev: Event{Author: author}, want: false},
+    }
+
+    for i, tst := range tests {
+        if got := tst.filter.Match(tst.ev); got != tst.want {t.Errorf("case %d: expected %v, got %v", i, tst.want, got)}
+    }
+}
+
+func TestBroadcasterReplayAndFanout(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    b := New(NewLocalBus(), 10, 4)
+    go b.Run(ctx)
+    time.Sleep(10 * time.Millisecond)
+
+    first := b.Subscribe(Filter{}, 0)
+    for i := int64(1); i <= 3; i++ {
+        err := b.Publish(ctx, Event{ID: i})
+        if err != nil {t.Fatalf("error with Publish: %v\n", err)}
+    }
+    for i := int64(1); i <= 3; i++ {
+        if ev := <-first.Events(); ev.ID != i {t.Errorf("expected event %d, got %d", i, ev.ID)}
+    }
+
+    // a reconnecting client gets what it missed
+    resumed := b.Subscribe(Filter{}, 1)
+    if ev := <-resumed.Events(); ev.ID != 2 {t.Errorf("expected replayed event 2, got %d", ev.ID)}
+    if ev := <-resumed.Events(); ev.ID != 3 {t.Errorf("expected replayed event 3, got %d", ev.ID)}
+
+    // ids follow commit order, not their numbers
+    err := b.Publish(ctx, Event{ID: 7})
+    if err != nil {t.Fatalf("error with Publish: %v\n", err)}
+    err = b.Publish(ctx, Event{ID: 5})
+    if err != nil {t.Fatalf("error with Publish: %v\n", err)}
+    if ev := <-first.Events(); ev.ID != 7 {t.Errorf("expected event 7, got %d", ev.ID)}
+    if ev := <-first.Events(); ev.ID != 5 {t.Errorf("expected event 5, got %d", ev.ID)}
+
+    resumed = b.Subscribe(Filter{}, 7)
+    if ev := <-resumed.Events(); ev.ID != 5 {t.Errorf("expected replayed event 5, got %d", ev.ID)}
+
+    // stopping the broadcaster disconnects clients
+    cancel()
+    select {
+    case _, ok := <-first.Events():
+        if ok {t.Errorf("expected closed channel")}
+    case <-time.After(time.Second):
+        t.Errorf("client was not disconnected")
+    }
+}
+
+func TestBroadcasterDropsSlowClient(t *testing.T) {
+    b := New(NewLocalBus(), 10, 1)
+    slow := b.Subscribe(Filter{}, 0)
+
+    b.fanout(Event{ID: 1})
+    b.fanout(Event{ID: 2})
+
+    if ev := <-slow.Events(); ev.ID != 1 {t.Errorf("expected event 1, got %d", ev.ID)}
+    if _, ok := <-slow.Events(); ok {t.Errorf("expected slow client to be dropped")}
+}
+
+func TestBroadcasterSkipsRedelivery(t *testing.T) {
+    b := New(NewLocalBus(), 10, 4)
+    c := b.Subscribe(Filter{}, 0)
+
+    b.fanout(Event{ID: 1})
+    b.fanout(Event{ID: 2})
+    b.fanout(Event{ID: 1})
+    c.Close()
+
+    got := []int64{}
+    for ev := range c.Events() {got = append(got, ev.ID)}
+    if len(got) != 2 || got[0] != 1 || got[1] != 2 {t.Errorf("expected events [1 2], got %v", got)}
+}
+
+func TestBroadcasterKeepsLiveEventsOutOfHistory(t *testing.T) {
+    recipient := uuid.New()
+    b := New(NewLocalBus(), 10, 4)
+    live := b.Subscribe(Filter{Recipient: recipient}, 0)
+
+    b.fanout(Event{ID: 1})
+    b.fanout(Event{Type: "message.created", Recipient: recipient})
+    b.fanout(Event{Type: "message.created", Recipient: recipient})
+
+    if ev := <-live.Events(); ev.Type != "message.created" {t.Errorf("expected live message, got %q", ev.Type)}
+    if ev := <-live.Events(); ev.Type != "message.created" {t.Errorf("expected second live message, got %q", ev.Type)}
+    if len(b.history) != 1 {t.Errorf("expected only the outbox event in history, got %d events", len(b.history))}
+}
@@ -0,0 +1,77 @@
+package tracing
+
+import (
+    "context"
+    "database/sql"
+    "strings"
+    "go.opentelemetry.io/otel/attribute"
+    semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// DBTX matches the interface sqlc generates for database.Queries
+type DBTX interface {
+    ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+    PrepareContext(context.Context, string) (*sql.Stmt, error)
+    QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+    QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// DB opens a span per query, named after the sqlc query
+type DB struct {
+    db DBTX
+}
+
+// WrapDB traces queries run through db, pass the result to database.New
+func WrapDB(db DBTX) *DB {
+    return &DB{db: db}
+}
+
+// queries without a parent span, e.g. background pollers, are not traced so
+// idle loops do not flood the exporter
+func (d *DB) start(ctx context.Context, query string) (context.Context, trace.Span, bool) {
+    if !trace.SpanFromContext(ctx).SpanContext().IsValid() {return ctx, nil, false}
+
+    ctx, span := Start(ctx, "db."+queryName(query),
+        semconv.DBSystemPostgreSQL,
+        attribute.String("db.statement", query),
+    )
+    return ctx, span, true
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+    ctx, span, ok := d.start(ctx, query)
+    res, err := d.db.ExecContext(ctx, query, args...)
+    if ok {End(span, err)}
+    return res, err
+}
+
+func (d *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+    ctx, span, ok := d.start(ctx, query)
+    stmt, err := d.db.PrepareContext(ctx, query)
+    if ok {End(span, err)}
+    return stmt, err
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+    ctx, span, ok := d.start(ctx, query)
+    rows, err := d.db.QueryContext(ctx, query, args...)
+    if ok {End(span, err)}
+    return rows, err
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+    ctx, span, ok := d.start(ctx, query)
+    row := d.db.QueryRowContext(ctx, query, args...)
+    if ok {End(span, row.Err())}
+    return row
+}
+
+// sqlc queries start with "-- name: GetChirps :many"
+func queryName(query string) string {
+    line, _, _ := strings.Cut(query, "\n")
+    fields := strings.Fields(line)
+
+    if len(fields) >= 3 && fields[0] == "--" && fields[1] == "name:" {return fields[2]}
+    return "query"
+}
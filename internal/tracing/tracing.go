@@ -0,0 +1,64 @@
+package tracing
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+    "go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/sudonetizen/chirpy")
+
+// Setup installs the global tracer provider and W3C propagators, exporter is
+// "none" (or empty), "stdout" or "otlp" as in OTEL_TRACES_EXPORTER, the otlp
+// exporter reads the standard OTEL_EXPORTER_OTLP_* variables, the returned
+// func flushes pending spans
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+    otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+    var exp sdktrace.SpanExporter
+    var err error
+
+    switch exporter {
+    case "", "none":
+        return func(context.Context) error {return nil}, nil
+    case "stdout", "console":
+        exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+    case "otlp":
+        exp, err = otlptracehttp.New(ctx)
+    default:
+        return nil, fmt.Errorf("unknown trace exporter %q, use none, stdout or otlp", exporter)
+    }
+    if err != nil {return nil, err}
+
+    res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("chirpy")))
+    if err != nil {return nil, err}
+
+    tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+    otel.SetTracerProvider(tp)
+
+    return tp.Shutdown, nil
+}
+
+// Start opens a child span of whatever span is in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+    return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on span and ends it
+func End(span trace.Span, err error) {
+    if err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+    }
+    span.End()
+}
@@ -0,0 +1,20 @@
+package tracing
+
+import (
+    "testing"
+)
+
+func TestQueryName(t *testing.T) {
+    tests := []struct {
+        query string
+        want  string
+    }{
+        {query: "-- name: GetChirps :many\nSELECT * FROM chirps", want: "GetChirps"},
+        {query: "-- name: DelChirp :exec\nDELETE FROM chirps WHERE id = $1", want: "DelChirp"},
+        {query: "SELECT pg_notify($1, $2)", want: "query"},
+    }
+
+    for _, tst := range tests {
+        if got := queryName(tst.query); got != tst.want {t.Errorf("expected %q, got %q", tst.want, got)}
+    }
+}
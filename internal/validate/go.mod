@@ -0,0 +1,5 @@
+module github.com/sudonetizen/validate
+
+go 1.24.2
+
+require github.com/rivo/uniseg v0.4.7
@@ -0,0 +1,171 @@
+package validate
+
+import (
+    "fmt"
+    "net/mail"
+    "net/url"
+    "regexp"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+    "github.com/rivo/uniseg"
+)
+
+// bcrypt ignores everything after 72 bytes
+const maxPasswordBytes = 72
+
+// MinPasswordLength in characters
+const MinPasswordLength = 8
+
+var usernameRe = regexp.MustCompile(`^[A-Za-z0-9_]{3,15}$`)
+
+// names that look official or clash with routes, compared lowercased
+var reservedUsernames = map[string]struct{}{
+    "admin": {}, "administrator": {}, "api": {}, "app": {}, "chirpy": {},
+    "help": {}, "support": {}, "root": {}, "system": {}, "staff": {},
+    "moderator": {}, "official": {}, "security": {}, "me": {}, "settings": {},
+    "login": {}, "logout": {}, "signup": {}, "profile": {}, "username": {},
+    "null": {}, "undefined": {}, "about": {}, "metrics": {},
+}
+
+// FieldError is one invalid field, code is stable for clients to match on
+type FieldError struct {
+    Field   string
+    Code    string
+    Message string
+}
+
+// Errors of a payload, every invalid field is listed
+type Errors []FieldError
+
+func (e Errors) Error() string {
+    msgs := make([]string, 0, len(e))
+    for _, fe := range e {msgs = append(msgs, fe.Field + ": " + fe.Message)}
+    return strings.Join(msgs, ", ")
+}
+
+// Validator collects field errors so a payload reports all of them at once
+type Validator struct {
+    errs Errors
+}
+
+func (v *Validator) Add(field, code, message string) {
+    v.errs = append(v.errs, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Err returns the collected Errors or nil
+func (v *Validator) Err() error {
+    if len(v.errs) == 0 {return nil}
+    return v.errs
+}
+
+// Email checks the syntax and returns the address trimmed and lowercased
+func (v *Validator) Email(field, email string) string {
+    email = strings.ToLower(strings.TrimSpace(email))
+    if email == "" {
+        v.Add(field, "required", "email is required")
+        return email
+    }
+
+    // a bare address only, no display names like "a <a@b.c>"
+    addr, err := mail.ParseAddress(email)
+    if err != nil || addr.Address != email || addr.Name != "" {
+        v.Add(field, "invalid_email", "email is not a valid address")
+        return email
+    }
+
+    domain := email[strings.LastIndex(email, "@") + 1:]
+    if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+        v.Add(field, "invalid_email", "email domain is not valid")
+    }
+
+    return email
+}
+
+// Password enforces the strength policy: at least MinPasswordLength
+// characters, at most 72 bytes, letters mixed with digits or symbols and
+// not containing the email's name
+func (v *Validator) Password(field, password, email string) {
+    if password == "" {
+        v.Add(field, "required", "password is required")
+        return
+    }
+    if utf8.RuneCountInString(password) < MinPasswordLength {
+        v.Add(field, "too_short", fmt.Sprintf("password needs at least %d characters", MinPasswordLength))
+    }
+    if len(password) > maxPasswordBytes {
+        v.Add(field, "too_long", fmt.Sprintf("password can have at most %d bytes", maxPasswordBytes))
+    }
+
+    letters, others := false, false
+    for _, r := range password {
+        if unicode.IsLetter(r) {
+            letters = true
+        } else if !unicode.IsSpace(r) {
+            others = true
+        }
+    }
+    if !letters || !others {
+        v.Add(field, "too_weak", "password needs letters and digits or symbols")
+    }
+
+    name, _, _ := strings.Cut(strings.ToLower(email), "@")
+    if len(name) >= 4 && strings.Contains(strings.ToLower(password), name) {
+        v.Add(field, "too_weak", "password must not contain the email")
+    }
+}
+
+// Username checks 3 to 15 letters, digits or underscores that are not
+// reserved, the case is kept but uniqueness ignores it
+func (v *Validator) Username(field, username string) string {
+    username = strings.TrimSpace(username)
+    if username == "" {
+        v.Add(field, "required", "username is required")
+        return username
+    }
+    if !usernameRe.MatchString(username) {
+        v.Add(field, "invalid_username", "username needs 3 to 15 letters, digits or underscores")
+        return username
+    }
+    if _, ok := reservedUsernames[strings.ToLower(username)]; ok {
+        v.Add(field, "reserved", "username is reserved")
+    }
+
+    return username
+}
+
+// URL checks an optional absolute http or https url
+func (v *Validator) URL(field, s string) {
+    if s == "" {return}
+    if len(s) > 2048 {
+        v.Add(field, "too_long", "url can have at most 2048 characters")
+        return
+    }
+
+    u, err := url.Parse(s)
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        v.Add(field, "invalid_url", "url must be an absolute http or https url")
+    }
+}
+
+// Text checks s is valid utf-8 and between min and max characters, counted
+// as grapheme clusters so an emoji with modifiers is one character
+func (v *Validator) Text(field, s string, min, max int) {
+    if !utf8.ValidString(s) {
+        v.Add(field, "invalid_encoding", "text is not valid utf-8")
+        return
+    }
+
+    n := Length(s)
+    if min > 0 && strings.TrimSpace(s) == "" {
+        v.Add(field, "required", fmt.Sprintf("%s is required", field))
+        return
+    }
+    if n < min {v.Add(field, "too_short", fmt.Sprintf("%s needs at least %d characters", field, min))}
+    if n > max {v.Add(field, "too_long", fmt.Sprintf("%s can have at most %d characters", field, max))}
+}
+
+// Length of s in user perceived characters
+func Length(s string) int {
+    return uniseg.GraphemeClusterCount(s)
+}
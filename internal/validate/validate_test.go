@@ -0,0 +1,128 @@
+package validate
+
+import (
+    "errors"
+    "testing"
+)
+
+func codes(err error) []string {
+    errs := Errors{}
+    if !errors.As(err, &errs) {return nil}
+
+    res := []string{}
+    for _, fe := range errs {res = append(res, fe.Field + ":" + fe.Code)}
+    return res
+}
+
+func equal(a, b []string) bool {
+    if len(a) != len(b) {return false}
+    for i := range a {
+        if a[i] != b[i] {return false}
+    }
+    return true
+}
+
+func TestEmail(t *testing.T) {
+    tests := []struct {
+        in   string
+        out  string
+        want []string
+    }{
+        {in: "  Saul@Example.COM ", out: "saul@example.com"},
+        {in: "", out: "", want: []string{"email:required"}},
+        {in: "saul", out: "saul", want: []string{"email:invalid_email"}},
+        {in: "Saul <saul@example.com>", out: "saul <saul@example.com>", want: []string{"email:invalid_email"}},
+        {in: "saul@localhost", out: "saul@localhost", want: []string{"email:invalid_email"}},
+    }
+
+    for _, tst := range tests {
+        v := Validator{}
+        out := v.Email("email", tst.in)
+        if out != tst.out {t.Errorf("%q: expected %q, got %q", tst.in, tst.out, out)}
+        if got := codes(v.Err()); !equal(got, tst.want) {t.Errorf("%q: expected %v, got %v", tst.in, tst.want, got)}
+    }
+}
+
+func TestPassword(t *testing.T) {
+    tests := []struct {
+        in   string
+        want []string
+    }{
+        {in: "correct-horse-7"},
+        {in: "", want: []string{"password:required"}},
+        {in: "abc1", want: []string{"password:too_short"}},
+        {in: "onlyletters", want: []string{"password:too_weak"}},
+        {in: "saulgoodman1", want: []string{"password:too_weak"}},
+        {in: "a1" + string(make([]byte, 71)), want: []string{"password:too_long"}},
+    }
+
+    for _, tst := range tests {
+        v := Validator{}
+        v.Password("password", tst.in, "saulgoodman@example.com")
+        if got := codes(v.Err()); !equal(got, tst.want) {t.Errorf("%q: expected %v, got %v", tst.in, tst.want, got)}
+    }
+}
+
+func TestUsername(t *testing.T) {
+    tests := []struct {
+        in   string
+        want []string
+    }{
+        {in: "Saul_Goodman"},
+        {in: "", want: []string{"username:required"}},
+        {in: "ab", want: []string{"username:invalid_username"}},
+        {in: "saul goodman", want: []string{"username:invalid_username"}},
+        {in: "Admin", want: []string{"username:reserved"}},
+    }
+
+    for _, tst := range tests {
+        v := Validator{}
+        v.Username("username", tst.in)
+        if got := codes(v.Err()); !equal(got, tst.want) {t.Errorf("%q: expected %v, got %v", tst.in, tst.want, got)}
+    }
+}
+
+func TestURL(t *testing.T) {
+    tests := []struct {
+        in   string
+        want []string
+    }{
+        {in: ""},
+        {in: "https://example.com/saul.png"},
+        {in: "javascript:alert(1)", want: []string{"avatar_url:invalid_url"}},
+        {in: "/saul.png", want: []string{"avatar_url:invalid_url"}},
+    }
+
+    for _, tst := range tests {
+        v := Validator{}
+        v.URL("avatar_url", tst.in)
+        if got := codes(v.Err()); !equal(got, tst.want) {t.Errorf("%q: expected %v, got %v", tst.in, tst.want, got)}
+    }
+}
+
+func TestText(t *testing.T) {
+    tests := []struct {
+        in   string
+        want []string
+    }{
+        {in: "hello"},
+        // five family emojis are five characters, not 125 bytes
+        {in: "👨‍👩‍👧‍👦👨‍👩‍👧‍👦👨‍👩‍👧‍👦👨‍👩‍👧‍👦👨‍👩‍👧‍👦"},
+        {in: "   ", want: []string{"body:required"}},
+        {in: "hello!", want: []string{"body:too_long"}},
+        {in: "\xff", want: []string{"body:invalid_encoding"}},
+    }
+
+    for _, tst := range tests {
+        v := Validator{}
+        v.Text("body", tst.in, 1, 5)
+        if got := codes(v.Err()); !equal(got, tst.want) {t.Errorf("%q: expected %v, got %v", tst.in, tst.want, got)}
+    }
+
+    // every field error is reported at once
+    v := Validator{}
+    v.Email("email", "nope")
+    v.Password("password", "x", "nope")
+    v.Text("body", "", 1, 5)
+    if got := codes(v.Err()); len(got) != 4 {t.Errorf("expected 4 errors, got %v", got)}
+}
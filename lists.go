@@ -0,0 +1,307 @@
+package main
+
+import (
+    "database/sql"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "time"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+    "github.com/sudonetizen/problem"
+    "github.com/sudonetizen/validate"
+)
+
+const (
+    maxListName    = 50
+    maxListMembers = 500
+)
+
+type listReq struct {
+    Name    string `json:"name"`
+    Private bool   `json:"is_private"`
+}
+
+type list_res struct {
+    Id         uuid.UUID `json:"id"`
+    Owner_id   uuid.UUID `json:"owner_id"`
+    Name       string    `json:"name"`
+    Private    bool      `json:"is_private"`
+    Created_at time.Time `json:"created_at"`
+    Updated_at time.Time `json:"updated_at"`
+}
+
+func (l listReq) validate() error {
+    v := validate.Validator{}
+    v.Text("name", l.Name, 1, maxListName)
+    return v.Err()
+}
+
+func toListRes(l database.List) list_res {
+    return list_res{l.ID, l.OwnerID, l.Name, l.IsPrivate, l.CreatedAt, l.UpdatedAt}
+}
+
+// decodes and validates a list payload, on failure the problem is written
+// and ok is false
+func decodeList(w http.ResponseWriter, r *http.Request) (listReq, bool) {
+    req := listReq{}
+    err := decodeJSON(r, &req)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with decoding", "error", err)
+        problem.Write(w, r, decodeProblem(err))
+        return req, false
+    }
+
+    err = req.validate()
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with validating list", "error", err)
+        problem.Write(w, r, validationProblem(err))
+        return req, false
+    }
+
+    return req, true
+}
+
+// loads the list in the path if viewer may see it, private lists of others
+// are 404, on failure the problem is written and ok is false
+func (cfg *apiConfig) visibleList(w http.ResponseWriter, r *http.Request, viewer uuid.UUID) (database.List, bool) {
+    id, err := uuid.Parse(r.PathValue("listID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidID, "list id is invalid"))
+        return database.List{}, false
+    }
+
+    l, err := cfg.db.GetList(r.Context(), database.GetListParams{ID: id, ViewerID: viewer})
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with getting list", "error", err)
+        problem.Write(w, r, problem.New(404, problem.NotFound, "list does not exist"))
+        return database.List{}, false
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting list", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return database.List{}, false
+    }
+
+    return l, true
+}
+
+// authenticates the caller and loads the list in the path, only its owner
+// may change it, on failure the problem is written and ok is false
+func (cfg *apiConfig) ownList(w http.ResponseWriter, r *http.Request) (database.List, bool) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return database.List{}, false}
+
+    l, ok := cfg.visibleList(w, r, userid)
+    if !ok {return database.List{}, false}
+
+    if l.OwnerID != userid {
+        slog.WarnContext(r.Context(), "error with list owner match", "list_id", l.ID, "owner_id", l.OwnerID)
+        problem.Write(w, r, problem.New(403, problem.Forbidden, "only the owner can change a list"))
+        return database.List{}, false
+    }
+
+    return l, true
+}
+
+// writes a list after a create or update, a taken name is 409
+func writeList(w http.ResponseWriter, r *http.Request, code int, l database.List, err error) {
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with saving list: not found", "error", err)
+        problem.Write(w, r, problem.New(404, problem.NotFound, "list does not exist"))
+        return
+    }
+    if isUniqueViolation(err) {
+        slog.WarnContext(r.Context(), "error with saving list: name taken")
+        problem.Write(w, r, problem.New(409, problem.Conflict, "you already have a list with this name"))
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with saving list", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    writeJSON(w, r, code, toListRes(l))
+}
+
+// handles -> post /api/lists
+func (cfg *apiConfig) handlerCreateList(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    req, ok := decodeList(w, r)
+    if !ok {return}
+
+    l, err := cfg.db.CreateList(r.Context(), database.CreateListParams{OwnerID: userid, Name: req.Name, IsPrivate: req.Private})
+    writeList(w, r, 201, l, err)
+}
+
+// handles -> get /api/lists?owner_id=, the caller's own lists without owner_id
+func (cfg *apiConfig) handlerGetLists(w http.ResponseWriter, r *http.Request) {
+    viewer, ok := cfg.viewer(w, r)
+    if !ok {return}
+
+    owner := viewer
+    oVal := r.URL.Query().Get("owner_id")
+    if oVal != "" {
+        id, err := uuid.Parse(oVal)
+        if err != nil {
+            slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+            problem.Write(w, r, problem.New(400, problem.InvalidQuery, "owner_id is not a valid id"))
+            return
+        }
+        owner = id
+    }
+    if owner == uuid.Nil {
+        _, ok = cfg.authUser(w, r)
+        if !ok {return}
+    }
+
+    lists, err := cfg.db.GetLists(r.Context(), database.GetListsParams{OwnerID: owner, ViewerID: viewer})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting lists", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    list := []list_res{}
+    for _, l := range lists {list = append(list, toListRes(l))}
+    writeJSON(w, r, 200, list)
+}
+
+// handles -> get /api/lists/{listID}
+func (cfg *apiConfig) handlerGetList(w http.ResponseWriter, r *http.Request) {
+    viewer, ok := cfg.viewer(w, r)
+    if !ok {return}
+
+    l, ok := cfg.visibleList(w, r, viewer)
+    if !ok {return}
+
+    writeJSON(w, r, 200, toListRes(l))
+}
+
+// handles -> put /api/lists/{listID}, renames it or changes who can see it
+func (cfg *apiConfig) handlerUpdateList(w http.ResponseWriter, r *http.Request) {
+    l, ok := cfg.ownList(w, r)
+    if !ok {return}
+
+    req, ok := decodeList(w, r)
+    if !ok {return}
+
+    l, err := cfg.db.UpdateList(r.Context(), database.UpdateListParams{ID: l.ID, OwnerID: l.OwnerID, Name: req.Name, IsPrivate: req.Private})
+    writeList(w, r, 200, l, err)
+}
+
+// handles -> delete /api/lists/{listID}
+func (cfg *apiConfig) handlerDeleteList(w http.ResponseWriter, r *http.Request) {
+    l, ok := cfg.ownList(w, r)
+    if !ok {return}
+
+    _, err := cfg.db.DeleteList(r.Context(), database.DeleteListParams{ID: l.ID, OwnerID: l.OwnerID})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with deleting list", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    w.WriteHeader(204)
+}
+
+// handles -> get /api/lists/{listID}/members
+func (cfg *apiConfig) handlerGetListMembers(w http.ResponseWriter, r *http.Request) {
+    viewer, ok := cfg.viewer(w, r)
+    if !ok {return}
+
+    l, ok := cfg.visibleList(w, r, viewer)
+    if !ok {return}
+
+    rows, err := cfg.db.GetListMembers(r.Context(), l.ID)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting list members", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    list := []relation_res{}
+    for _, row := range rows {list = append(list, relation_res{row.ID, row.Username.String, row.CreatedAt})}
+    writeJSON(w, r, 200, list)
+}
+
+// parses the member in the path, on failure the problem is written and ok is false
+func listMember(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+    id, err := uuid.Parse(r.PathValue("userID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidID, "user id is invalid"))
+        return uuid.Nil, false
+    }
+    return id, true
+}
+
+// handles -> put /api/lists/{listID}/members/{userID}
+func (cfg *apiConfig) handlerAddListMember(w http.ResponseWriter, r *http.Request) {
+    l, ok := cfg.ownList(w, r)
+    if !ok {return}
+
+    member, ok := listMember(w, r)
+    if !ok {return}
+
+    // the list row is locked so concurrent adds see each other's members,
+    // no row when the list was deleted meanwhile
+    n := int64(0)
+    err := cfg.withTx(r.Context(), func(q *database.Queries) error {
+        _, err := q.LockList(r.Context(), database.LockListParams{ID: l.ID, OwnerID: l.OwnerID})
+        if err != nil {return err}
+
+        n, err = q.AddListMember(r.Context(), database.AddListMemberParams{ListID: l.ID, OwnerID: l.OwnerID, UserID: member, MaxMembers: maxListMembers})
+        return err
+    })
+    if err == nil && n == 0 {
+        slog.WarnContext(r.Context(), "error with adding list member: list full", "list_id", l.ID)
+        problem.Write(w, r, problem.Validation(problem.FieldError{Field: "userID", Code: "too_many", Message: fmt.Sprintf("a list can have at most %d members", maxListMembers)}))
+        return
+    }
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with adding list member: list not found")
+        problem.Write(w, r, problem.New(404, problem.NotFound, "list does not exist"))
+        return
+    }
+    writeRelation(w, r, err)
+}
+
+// handles -> delete /api/lists/{listID}/members/{userID}
+func (cfg *apiConfig) handlerRemoveListMember(w http.ResponseWriter, r *http.Request) {
+    l, ok := cfg.ownList(w, r)
+    if !ok {return}
+
+    member, ok := listMember(w, r)
+    if !ok {return}
+
+    _, err := cfg.db.RemoveListMember(r.Context(), database.RemoveListMemberParams{ListID: l.ID, OwnerID: l.OwnerID, UserID: member})
+    writeRelation(w, r, err)
+}
+
+// handles -> get /api/lists/{listID}/chirps, the members' chirps newest first
+func (cfg *apiConfig) handlerGetListChirps(w http.ResponseWriter, r *http.Request) {
+    viewer, ok := cfg.viewer(w, r)
+    if !ok {return}
+
+    l, ok := cfg.visibleList(w, r, viewer)
+    if !ok {return}
+
+    // paging with ?before=<last chirp id seen>&limit=
+    before, limit, ok := page(w, r, defaultChirpPage, maxChirpPage)
+    if !ok {return}
+
+    chirps, err := cfg.db.GetListChirps(r.Context(), database.GetListChirpsParams{ListID: l.ID, ViewerID: viewer, BeforeID: before, MaxRows: limit})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting list chirps", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    cfg.writeChirps(w, r, viewer, chirps)
+}
@@ -2,12 +2,18 @@ package main
 
 import (
     "os"
+    "context"
     "fmt"
     "log"
+    "log/slog"
     "time"
     "sort"
     "strings"
     "net/http"
+    "os/signal"
+    "syscall"
+    "errors"
+    "flag"
     "sync/atomic"
     "encoding/json"
     "database/sql"
@@ -16,36 +22,74 @@ import (
     "github.com/google/uuid"
     "github.com/sudonetizen/auth"
     "github.com/sudonetizen/database"
+    "github.com/sudonetizen/outbox"
+    "github.com/sudonetizen/jobs"
+    "github.com/sudonetizen/janitor"
+    "github.com/sudonetizen/stream"
+    "github.com/sudonetizen/metrics"
+    "github.com/sudonetizen/logging"
+    "github.com/sudonetizen/tracing"
+    "github.com/sudonetizen/health"
+    "github.com/sudonetizen/config"
+    "github.com/sudonetizen/problem"
+    "github.com/sudonetizen/validate"
+    "github.com/sudonetizen/storage"
+    "github.com/sudonetizen/moderation"
+    "github.com/sudonetizen/mailer"
+    "github.com/sudonetizen/digest"
+    "go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+    "go.opentelemetry.io/otel/attribute"
+    "github.com/prometheus/client_golang/prometheus"
 )
 
 // fileserverHits struct 
 type apiConfig struct {
     fileserverHits atomic.Int32
     db *database.Queries
+    conn *sql.DB
+    jobs *jobs.Queue
+    stream *stream.Broadcaster
+    metrics *metrics.Metrics
+    draining atomic.Bool
+    streamCtx context.Context
+    conf *config.Config
+    store storage.Store
+    moderator moderation.Hook
     tks string
     plk string
 }
 
 // chirp structs 
 type chirp struct {
-    Body    string `json:"body"`
-    User_id uuid.UUID `json:"user_id"`
+    Body      string      `json:"body"`
+    User_id   uuid.UUID   `json:"user_id"`
+    Media_ids []uuid.UUID `json:"media_ids"`
+    Quote_of  *uuid.UUID  `json:"quote_of"`
+    Poll      *pollReq    `json:"poll"`
 }
 
 type chirp_res struct {
-    Id         uuid.UUID `json:"id"`
-    Created_at time.Time `json:"created_at"`
-    Updated_at time.Time `json:"updated_at"`
-    Body       string    `json:"body"`
-    User_id    uuid.UUID `json:"user_id"`
+    Id          uuid.UUID   `json:"id"`
+    Created_at  time.Time   `json:"created_at"`
+    Updated_at  time.Time   `json:"updated_at"`
+    Body        string      `json:"body"`
+    User_id     uuid.UUID   `json:"user_id"`
+    Media       []media_res `json:"media,omitempty"`
+    Pinned      bool        `json:"pinned,omitempty"`
+    Quote_of    *uuid.UUID  `json:"quote_of,omitempty"`
+    Quote       *quote_res  `json:"quote,omitempty"`
+    Quote_count int32       `json:"quote_count"`
+    Poll        *poll_res   `json:"poll,omitempty"`
 }
 
-type ch_res struct {
-    BodyClean string `json:"cleaned_body"`
+func toChirpRes(ch database.Chirp) chirp_res {
+    res := chirp_res{Id: ch.ID, Created_at: ch.CreatedAt, Updated_at: ch.UpdatedAt, Body: ch.Body, User_id: ch.UserID, Quote_count: ch.QuoteCount}
+    if ch.QuoteOf.Valid {res.Quote_of = &ch.QuoteOf.UUID}
+    return res
 }
 
-type ch_err struct {
-    Error string `json:"error"`
+type ch_res struct {
+    BodyClean string `json:"cleaned_body"`
 }
 
 type ch_vld struct {
@@ -63,16 +107,68 @@ type email struct {
     Expires  time.Duration `json:"expires_in_seconds"`
 }
 
+type signup struct {
+    email
+    Username string `json:"username"`
+}
+
+// checks a signup or update payload, the email is normalized in place
+func (e *email) validate() error {
+    v := validate.Validator{}
+    e.Email = v.Email("email", e.Email)
+    v.Password("password", e.Password, e.Email)
+    return v.Err()
+}
+
+// checks a signup, the username is optional and can be set later
+func (s *signup) validate() error {
+    v := validate.Validator{}
+    s.Email = v.Email("email", s.Email)
+    v.Password("password", s.Password, s.Email)
+    if s.Username != "" {s.Username = v.Username("username", s.Username)}
+    return v.Err()
+}
+
+// checks the body is not empty and at most max characters long
+func (c chirp) validate(max int) error {
+    v := validate.Validator{}
+    v.Text("body", c.Body, 1, max)
+    if c.Poll != nil {c.Poll.validate(&v)}
+    return v.Err()
+}
+
 type user struct {
     Id         uuid.UUID `json:"id"`
     Created_at time.Time `json:"created_at"`
     Updated_at time.Time `json:"updated_at"`
     Email      string    `json:"email"`
+    Username   string    `json:"username,omitempty"`
     Token      string    `json:"token"`
     RToken     string    `json:"refresh_token"`
     Red        bool      `json:"is_chirpy_red"`
 }
 
+// admin job queue structs
+type jobStat struct {
+    Kind   string `json:"kind"`
+    Status string `json:"status"`
+    Count  int64  `json:"count"`
+}
+
+type jobFailure struct {
+    Id         uuid.UUID `json:"id"`
+    Kind       string    `json:"kind"`
+    Status     string    `json:"status"`
+    Attempts   int32     `json:"attempts"`
+    LastError  string    `json:"last_error"`
+    Updated_at time.Time `json:"updated_at"`
+}
+
+type jobsRes struct {
+    Depth    []jobStat    `json:"depth"`
+    Failures []jobFailure `json:"failures"`
+}
+
 // token struct
 type tokenStruct struct {
     Token string `json:"token"`
@@ -88,6 +184,54 @@ type pWebhook struct {
     Data  pData  `json:"data"`
 }
 
+// runs fn in a transaction, commits when fn returns nil and rolls back otherwise
+func (cfg *apiConfig) withTx(ctx context.Context, fn func(q *database.Queries) error) error {
+    tx, err := cfg.conn.BeginTx(ctx, nil)
+    if err != nil {return err}
+    defer tx.Rollback()
+
+    err = fn(database.New(tracing.WrapDB(tx)))
+    if err != nil {return err}
+
+    return tx.Commit()
+}
+
+// authenticates the bearer token, on failure the problem is written and ok is false
+func (cfg *apiConfig) authUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+    tkn, err := auth.GetBearerToken(r.Header)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with getting token", "error", err)
+        problem.Write(w, r, problem.New(401, problem.MissingToken, "bearer token is required"))
+        return uuid.Nil, false
+    }
+
+    userid, err := auth.ValidateJWT(tkn, cfg.tks)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with validating jwt", "error", err)
+        problem.Write(w, r, problem.New(401, problem.InvalidToken, "token is invalid or expired"))
+        return uuid.Nil, false
+    }
+    logging.SetUser(r.Context(), userid.String())
+
+    return userid, true
+}
+
+// bcrypt is slow on purpose, these spans show how much of a request it takes
+func hashPassword(ctx context.Context, p string) (string, error) {
+    _, span := tracing.Start(ctx, "auth.HashPassword")
+    hash, err := auth.HashPassword(p)
+    tracing.End(span, err)
+    return hash, err
+}
+
+func checkPasswordHash(ctx context.Context, p, h string) error {
+    _, span := tracing.Start(ctx, "auth.CheckPasswordHash")
+    err := auth.CheckPasswordHash(p, h)
+    // a wrong password is not a failed span
+    tracing.End(span, nil)
+    return err
+}
+
 // middleware that count fileserver hits by using on handler function 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
     return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
@@ -106,17 +250,73 @@ func (cfg *apiConfig) handlerHits(w http.ResponseWriter, r *http.Request) {
 // handles -> post /admin/reset 
 func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
     cfg.fileserverHits.Store(0)
+
+    err := cfg.db.DeleteUsers(r.Context())
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with deleting users", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    slog.InfoContext(r.Context(), "deleted users")
     w.WriteHeader(http.StatusOK)
     w.Write([]byte(fmt.Sprintln("reset done, hits now 0")))
+}
 
-    err := cfg.db.DeleteUsers(r.Context())
+// handles -> get /admin/jobs
+func (cfg *apiConfig) handlerJobs(w http.ResponseWriter, r *http.Request) {
+    // getting queue depth per kind and status
+    stats, err := cfg.db.GetJobStats(r.Context())
     if err != nil {
-        log.Printf("error with deleting users: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with getting job stats", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
     }
 
-    log.Printf("deleted users")
-    
+    // getting recent failures
+    failed, err := cfg.db.GetFailedJobs(r.Context(), 50)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting failed jobs", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    // encoding response
+    res := jobsRes{Depth: []jobStat{}, Failures: []jobFailure{}}
+    for _, st := range stats {
+        res.Depth = append(res.Depth, jobStat{Kind: st.Kind, Status: st.Status, Count: st.Total})
+    }
+    for _, j := range failed {
+        res.Failures = append(res.Failures, jobFailure{j.ID, j.Kind, j.Status, j.Attempts, j.LastError.String, j.UpdatedAt})
+    }
+
+    data, err := json.Marshal(res)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with marshalling jobs", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    // sending response
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(200)
+    w.Write(data)
+}
+
+// handles -> get /admin/config
+func (cfg *apiConfig) handlerConfig(w http.ResponseWriter, r *http.Request) {
+    // resolved settings with their source, secrets are redacted
+    data, err := json.Marshal(cfg.conf.Redacted())
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with marshalling config", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    // sending response
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(200)
+    w.Write(data)
 }
 
 // for checking health of web app
@@ -130,82 +330,165 @@ func handlerHealthz(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) handlerChirps(w http.ResponseWriter, r *http.Request) {
     // decoding chirp message
     msg := chirp{}
-    decoder := json.NewDecoder(r.Body)
-    err := decoder.Decode(&msg)
+    err := decodeJSON(r, &msg)
 
     if err != nil {
-        log.Printf("error with decoding: %v\n", err)
-        w.WriteHeader(400)
+        slog.WarnContext(r.Context(), "error with decoding", "error", err)
+        problem.Write(w, r, decodeProblem(err))
         return
     } 
 
     // getting token from header
     ss, err := auth.GetBearerToken(r.Header)
     if err != nil {
-        log.Printf("error with getting token: %v\n", err)
-        w.WriteHeader(500)
+        slog.WarnContext(r.Context(), "error with getting token", "error", err)
+        problem.Write(w, r, problem.New(401, problem.MissingToken, "bearer token is required"))
         return
     }
 
     // validating JWT 
     userid, err := auth.ValidateJWT(ss, cfg.tks)
     if err != nil {
-        log.Printf("error with validating jwt: %v\n", err)
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "error with validating jwt", "error", err)
+        problem.Write(w, r, problem.New(401, problem.InvalidToken, "token is invalid or expired"))
         return
     }
+    logging.SetUser(r.Context(), userid.String())
 
     msg.User_id = userid
 
     // checking user_id 
     _, err = cfg.db.GetUser(r.Context(), msg.User_id)
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with checking user_id", "user_id", msg.User_id, "error", err)
+        problem.Write(w, r, problem.New(401, problem.InvalidToken, "user of the token does not exist"))
+        return 
+    }
     if err != nil {
-        log.Printf("smth: %v\n", msg.User_id)
-        log.Printf("error with 1111 checking user_id: %v\n", err)
-        w.WriteHeader(400)
+        slog.ErrorContext(r.Context(), "error with checking user_id", "user_id", msg.User_id, "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return 
-        }
+    }
 
-    // checking for length
-    if len(msg.Body) > 140 {
-        w.Header().Set("Content-Type", "application/json")
-        w.WriteHeader(400)
+    // checking body, length is counted in characters not bytes
+    err = msg.validate(cfg.conf.Chirps.MaxLength)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with validating chirp", "error", err)
+        problem.Write(w, r, validationProblem(err))
+        return
+    }
 
-        err_msg := ch_err{Error: "Chirp is too long"}
-        data, err := json.Marshal(err_msg)
-        if err != nil {
-            log.Printf("error with marshalling ch_err: %v\n", err)
-            w.WriteHeader(500)
-            return 
+    // cleaning chirp message
+    msgString, err := cfg.moderator.Moderate(r.Context(), msg.Body)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with moderating chirp", "error", err)
+        problem.Write(w, r, moderationProblem(err))
+        return
+    }
+
+    // poll options are moderated like the body
+    if msg.Poll != nil {
+        for i, o := range msg.Poll.Options {
+            msg.Poll.Options[i], err = cfg.moderator.Moderate(r.Context(), o)
+            if err != nil {
+                slog.WarnContext(r.Context(), "error with moderating poll option", "error", err)
+                problem.Write(w, r, moderationProblem(err))
+                return
+            }
         }
+    }
 
-        w.Write(data) 
+    // attachments must be the author's own uploads
+    prob, err := cfg.checkOwnedMedia(r.Context(), msg.User_id, "media_ids", msg.Media_ids, maxChirpMedia)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with checking media", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+    if prob != nil {
+        slog.WarnContext(r.Context(), "error with validating chirp media", "media_ids", msg.Media_ids)
+        problem.Write(w, r, prob)
         return
     }
 
-    // cleaning chirp message
-    msgString := msg.Body
-    profane_words := map[string]struct{}{"kerfuffle": {}, "sharbert": {}, "fornax": {}}
-
-    for _, word := range strings.Fields(msgString) {
-        _, ok := profane_words[strings.ToLower(word)]
-        if ok { msgString = strings.ReplaceAll(msgString, word, "****") }
+    // a quoted chirp must be one the author can see
+    quoteOf := uuid.NullUUID{}
+    if msg.Quote_of != nil {
+        _, err = cfg.db.GetChirpForViewer(r.Context(), database.GetChirpForViewerParams{ID: *msg.Quote_of, ViewerID: msg.User_id})
+        if errors.Is(err, sql.ErrNoRows) {
+            slog.WarnContext(r.Context(), "error with validating quoted chirp", "quote_of", *msg.Quote_of)
+            problem.Write(w, r, problem.Validation(problem.FieldError{Field: "quote_of", Code: "not_found", Message: "quoted chirp does not exist"}))
+            return
+        }
+        if err != nil {
+            slog.ErrorContext(r.Context(), "error with getting quoted chirp", "error", err)
+            problem.Write(w, r, problem.New(500, problem.Internal, ""))
+            return
+        }
+        quoteOf = uuid.NullUUID{UUID: *msg.Quote_of, Valid: true}
     }
 
-    // creating a chirp response 
-    chrp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{msgString, msg.User_id})
+    // creating a chirp, its attachments and its outbox event in one transaction
+    chirpRes := chirp_res{}
+    err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+        chrp, err := q.CreateChirp(r.Context(), database.CreateChirpParams{Body: msgString, UserID: msg.User_id, QuoteOf: quoteOf})
+        if err != nil {return err}
+
+        if quoteOf.Valid {
+            err = q.IncrementQuoteCount(r.Context(), quoteOf.UUID)
+            if err != nil {return err}
+        }
+
+        for i, id := range msg.Media_ids {
+            err = q.AttachMedia(r.Context(), database.AttachMediaParams{ChirpID: chrp.ID, MediaID: id, Position: int32(i)})
+            if err != nil {return err}
+        }
+
+        if msg.Poll != nil {
+            err = q.CreatePoll(r.Context(), database.CreatePollParams{ChirpID: chrp.ID, Minutes: int32(msg.Poll.Duration_minutes)})
+            if err != nil {return err}
+            for i, o := range msg.Poll.Options {
+                err = q.CreatePollOption(r.Context(), database.CreatePollOptionParams{ChirpID: chrp.ID, Position: int32(i), Text: o})
+                if err != nil {return err}
+            }
+        }
+
+        list := []chirp_res{toChirpRes(chrp)}
+        err = cfg.withMedia(r.Context(), q, list)
+        if err != nil {return err}
+
+        // events carry the poll without votes, as anyone who did not vote sees it
+        err = cfg.withPolls(r.Context(), q, uuid.Nil, list)
+        if err != nil {return err}
+
+        chirpRes = list[0]
+        _, err = outbox.Write(r.Context(), q, outbox.TopicChirpCreated, chirpRes)
+        return err
+    })
     if err != nil {
-        log.Printf("error with creating chirp: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with creating chirp", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return 
     }
 
+    cfg.metrics.ChirpsCreated.Inc()
+
+    cfg.notifyMentions(r.Context(), chirpRes)
+
+    // events only carry quote_of, the embedded quote depends on who looks
+    list := []chirp_res{chirpRes}
+    err = cfg.withQuotes(r.Context(), msg.User_id, list)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting quoted chirp", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
     // encoding response 
-    chirpRes := chirp_res{Id: chrp.ID, Created_at: chrp.CreatedAt, Updated_at: chrp.UpdatedAt, Body: chrp.Body, User_id: chrp.UserID}
-    data, err := json.Marshal(chirpRes)
+    data, err := json.Marshal(list[0])
     if err != nil {
-        log.Printf("error with creating res json: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with creating res json", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return 
     }
     
@@ -217,42 +500,55 @@ func (cfg *apiConfig) handlerChirps(w http.ResponseWriter, r *http.Request) {
 
 // handles -> post /api/users
 func (cfg *apiConfig) handlerUsers(w http.ResponseWriter, r *http.Request) {
-    // decoding email and password into struct 
-    eml := email{}
-    decoder := json.NewDecoder(r.Body)
-    err := decoder.Decode(&eml)
+    // decoding email, password and username into struct 
+    eml := signup{}
+    err := decodeJSON(r, &eml)
 
     if err != nil {
-        log.Printf("error with decoding: %v\n", err)
-        w.WriteHeader(400)
+        slog.WarnContext(r.Context(), "error with decoding", "error", err)
+        problem.Write(w, r, decodeProblem(err))
         return
     } 
 
+    // validating email and password
+    err = eml.validate()
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with validating user", "error", err)
+        problem.Write(w, r, validationProblem(err))
+        return
+    }
+
     // hashing password 
-    hash, err := auth.HashPassword(eml.Password)
+    hash, err := hashPassword(r.Context(), eml.Password)
     
     if err != nil {
-        log.Printf("error with hashing: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with hashing", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return 
     }
     
     // creating user
-    usr, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{eml.Email, hash})
-      
+    uname := sql.NullString{String: eml.Username, Valid: eml.Username != ""}
+    usr, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{Email: eml.Email, HashedPassword: hash, Username: uname})
+
+    if isUniqueViolation(err) {
+        slog.WarnContext(r.Context(), "error with creating user: email or username is taken", "error", err)
+        problem.Write(w, r, problem.New(409, problem.Conflict, "email or username is already registered"))
+        return
+    }
     if err != nil {
-        log.Printf("error with creating user: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with creating user", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     } 
 
     // encoding response 
-    res := user{Id: usr.ID, Created_at: usr.CreatedAt, Updated_at: usr.UpdatedAt, Email: usr.Email, Red: usr.IsChirpyRed.Bool}
+    res := user{Id: usr.ID, Created_at: usr.CreatedAt, Updated_at: usr.UpdatedAt, Email: usr.Email, Username: usr.Username.String, Red: usr.IsChirpyRed.Bool}
     data, err := json.Marshal(res)
     
     if err != nil {
-        log.Printf("error with creating json: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with creating json", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     } 
 
@@ -264,6 +560,10 @@ func (cfg *apiConfig) handlerUsers(w http.ResponseWriter, r *http.Request) {
 
 // handles -> get /api/chirps
 func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
+    // signed in callers do not see muted or blocked authors
+    viewer, ok := cfg.viewer(w, r)
+    if !ok {return}
+
     // getting for a author query 
     author_id := uuid.Nil
     qVal := r.URL.Query().Get("author_id")
@@ -272,8 +572,8 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
         aid, err := uuid.Parse(qVal)
 
         if err != nil {
-            log.Printf("error with parsing uuid: %v\n", err)
-            w.WriteHeader(401)
+            slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+            problem.Write(w, r, problem.New(400, problem.InvalidQuery, "author_id is not a valid id"))
             return
         }
         
@@ -286,18 +586,18 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
     if sVal == "desc" {ascFlag = false}
      
     // getting chirps
-    chirps, err := cfg.db.GetChirps(r.Context())
+    chirps, err := cfg.db.GetChirpsForViewer(r.Context(), viewer)
 
     if err != nil {
-        log.Printf("error with getting chirps: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with getting chirps", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     } 
     
     // encoding chirps 
     chirps_list := []chirp_res{} 
     for _, ch := range chirps {
-        chch := chirp_res{ch.ID, ch.CreatedAt, ch.UpdatedAt, ch.Body, ch.UserID}
+        chch := toChirpRes(ch)
         if author_id == uuid.Nil {
             chirps_list = append(chirps_list, chch)
         } else if author_id == ch.UserID {
@@ -306,17 +606,44 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
     }    
 
     // sorting asc (default) or desc 
+    _, span := tracing.Start(r.Context(), "sort chirps", attribute.Int("chirps", len(chirps_list)))
     if ascFlag == true {
         sort.Slice(chirps_list, func(i, j int) bool {return chirps_list[i].Created_at.Before(chirps_list[j].Created_at)})
     } else {
         sort.Slice(chirps_list, func(i, j int) bool {return chirps_list[i].Created_at.After(chirps_list[j].Created_at)})
     }
+    span.End()
+
+    // a profile feed marks pinned chirps, ?pinned=first puts them on top
+    if author_id != uuid.Nil {
+        pinned, err := cfg.db.GetPinnedChirpIDs(r.Context(), author_id)
+        if err != nil {
+            slog.ErrorContext(r.Context(), "error with getting pinned chirps", "error", err)
+            problem.Write(w, r, problem.New(500, problem.Internal, ""))
+            return
+        }
+        chirps_list = withPins(chirps_list, pinned, r.URL.Query().Get("pinned") == "first")
+    }
+
+    err = cfg.withMedia(r.Context(), cfg.db, chirps_list)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting chirp media", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    err = cfg.withViewer(r.Context(), viewer, chirps_list)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting quotes and polls", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
 
     data, err := json.Marshal(chirps_list)
     
     if err != nil {
-        log.Printf("error with marshalling chirps: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with marshalling chirps", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     } 
 
@@ -331,27 +658,49 @@ func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
     // getting chirp 
     id, err := uuid.Parse(r.PathValue("chirpID"))
     if err != nil {
-        log.Printf("error with parsing uuid: %v\n", err) 
-        w.WriteHeader(400)
-        w.Write([]byte("chirp id is invalid"))
+        slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidID, "chirp id is invalid"))
         return
     }
 
-    chp, err := cfg.db.GetChirp(r.Context(), id)
+    // a block either way hides the chirp
+    viewer, ok := cfg.viewer(w, r)
+    if !ok {return}
+
+    chp, err := cfg.db.GetChirpForViewer(r.Context(), database.GetChirpForViewerParams{ID: id, ViewerID: viewer})
 
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with getting chirp", "error", err)
+        problem.Write(w, r, problem.New(404, problem.NotFound, "chirp does not exist"))
+        return
+    }
     if err != nil {
-        log.Printf("error with getting chirp: %v\n", err)
-        w.WriteHeader(404)
+        slog.ErrorContext(r.Context(), "error with getting chirp", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     } 
     
     // encoding 
-    chch := chirp_res{chp.ID, chp.CreatedAt, chp.UpdatedAt, chp.Body, chp.UserID}
-    dta, err := json.Marshal(chch)
+    list := []chirp_res{toChirpRes(chp)}
+    err = cfg.withMedia(r.Context(), cfg.db, list)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting chirp media", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    err = cfg.withViewer(r.Context(), viewer, list)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting quote and poll", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    dta, err := json.Marshal(list[0])
 
     if err != nil {
-        log.Printf("error with marshalling chirp: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with marshalling chirp", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     } 
  
@@ -365,44 +714,55 @@ func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
     // decoding password and email from request into struct
     eml := email{}
-    decoder := json.NewDecoder(r.Body)
-    err := decoder.Decode(&eml)
+    err := decodeJSON(r, &eml)
 
     if err != nil {
-        log.Printf("error with decoding: %v\n", err)
-        w.WriteHeader(400)
+        slog.WarnContext(r.Context(), "error with decoding", "error", err)
+        problem.Write(w, r, decodeProblem(err))
         return
     }
 
+    // emails are stored normalized, old accounts are matched case-insensitively
+    eml.Email = strings.ToLower(strings.TrimSpace(eml.Email))
+
     // checking expires_in_seconds 
-    if eml.Expires == 0 {eml.Expires = time.Duration(3600 * time.Second)}
+    if eml.Expires == 0 {eml.Expires = cfg.conf.Auth.AccessTokenTTL}
 
     // getting user by email  
     usr, err := cfg.db.GetUserByEml(r.Context(), eml.Email)
     
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with getting user by email", "error", err)
+        cfg.metrics.Logins.WithLabelValues("unknown_email").Inc()
+        problem.Write(w, r, problem.New(401, problem.InvalidCredentials, "incorrect email or password"))
+        return 
+    }
     if err != nil {
-        log.Printf("error with getting user by email: %v\n", err)
-        w.WriteHeader(401)
-        w.Write([]byte("incorrect email"))
+        slog.ErrorContext(r.Context(), "error with getting user by email", "error", err)
+        cfg.metrics.Logins.WithLabelValues("error").Inc()
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return 
     }
 
     // checking password 
-    err = auth.CheckPasswordHash(eml.Password, usr.HashedPassword)
+    err = checkPasswordHash(r.Context(), eml.Password, usr.HashedPassword)
     
     if err != nil {
-        log.Printf("error with checking password hash: %v\n", err)
-        w.WriteHeader(401)
-        w.Write([]byte("incorrect password"))
+        slog.WarnContext(r.Context(), "error with checking password hash", "error", err)
+        cfg.metrics.Logins.WithLabelValues("wrong_password").Inc()
+        problem.Write(w, r, problem.New(401, problem.InvalidCredentials, "incorrect email or password"))
         return 
     }
+    logging.SetUser(r.Context(), usr.ID.String())
+    cfg.touchActive(r.Context(), usr.ID)
 
     // creating token 
     tokenU, err := auth.MakeJWT(usr.ID, cfg.tks, eml.Expires)
 
     if err != nil {
-        log.Printf("error with creating token: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with creating token", "error", err)
+        cfg.metrics.Logins.WithLabelValues("error").Inc()
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     }
 
@@ -410,31 +770,35 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
     rtkn, err := auth.MakeRefreshToken()
     
     if err != nil {
-        log.Printf("error with creating refresh token: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with creating refresh token", "error", err)
+        cfg.metrics.Logins.WithLabelValues("error").Inc()
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return 
     }
 
     // saving refresh token to database 
-    _, err = cfg.db.CreateRToken(r.Context(), database.CreateRTokenParams{rtkn, usr.ID, time.Now().Add((60*24*3600) * time.Second)})
+    _, err = cfg.db.CreateRToken(r.Context(), database.CreateRTokenParams{Token: rtkn, UserID: usr.ID, ExpiresAt: time.Now().Add(cfg.conf.Auth.RefreshTokenTTL)})
 
     if err != nil {
-        log.Printf("error with saving rtoken: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with saving rtoken", "error", err)
+        cfg.metrics.Logins.WithLabelValues("error").Inc()
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     }
 
     // encoding response 
-    resp := user{usr.ID, usr.CreatedAt, usr.UpdatedAt, usr.Email, tokenU, rtkn, usr.IsChirpyRed.Bool}
+    resp := user{Id: usr.ID, Created_at: usr.CreatedAt, Updated_at: usr.UpdatedAt, Email: usr.Email, Username: usr.Username.String, Token: tokenU, RToken: rtkn, Red: usr.IsChirpyRed.Bool}
     data, err := json.Marshal(resp) 
 
     if err != nil {
-        log.Printf("error with encoding json: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with encoding json", "error", err)
+        cfg.metrics.Logins.WithLabelValues("error").Inc()
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     }
     
     // sending response 
+    cfg.metrics.Logins.WithLabelValues("success").Inc()
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(200) 
     w.Write(data)
@@ -446,33 +810,40 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
     tkn, err := auth.GetBearerToken(r.Header)
     
     if err != nil {
-        log.Printf("error with getting token: %v\n", err)
-        w.WriteHeader(500)
+        slog.WarnContext(r.Context(), "error with getting token", "error", err)
+        problem.Write(w, r, problem.New(401, problem.MissingToken, "bearer token is required"))
         return
     }
     
     // searching token in database and checking expire time for nil 
     rtkn, err := cfg.db.GetRToken(r.Context(), tkn)
     
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with searching token", "error", err)
+        problem.Write(w, r, problem.New(401, problem.InvalidToken, "refresh token does not exist"))
+        return
+    }
     if err != nil {
-        log.Printf("error with searching token: %v\n", err)
-        w.WriteHeader(401)
+        slog.ErrorContext(r.Context(), "error with searching token", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     }
 
     nullTime := time.Time{}
     if rtkn.RevokedAt.Time != nullTime {
-        log.Println("error with revoked time")
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "error with revoked time", "revoked_at", rtkn.RevokedAt.Time)
+        problem.Write(w, r, problem.New(401, problem.InvalidToken, "refresh token was revoked"))
         return
     }
+    logging.SetUser(r.Context(), rtkn.UserID.String())
+    cfg.touchActive(r.Context(), rtkn.UserID)
     
     // creating new token  
-    ss, err := auth.MakeJWT(rtkn.UserID, cfg.tks, time.Duration(3600 * time.Second))
+    ss, err := auth.MakeJWT(rtkn.UserID, cfg.tks, cfg.conf.Auth.AccessTokenTTL)
 
     if err != nil {
-        log.Printf("error with creating token: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with creating token", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     }
 
@@ -481,8 +852,8 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
     data, err := json.Marshal(resp) 
     
     if err != nil {
-        log.Printf("error with marshalling json: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with marshalling json", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     }
 
@@ -498,8 +869,8 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
     tkn, err := auth.GetBearerToken(r.Header)
     
     if err != nil {
-        log.Printf("error with getting token: %v\n", err)
-        w.WriteHeader(500)
+        slog.WarnContext(r.Context(), "error with getting token", "error", err)
+        problem.Write(w, r, problem.New(401, problem.MissingToken, "bearer token is required"))
         return
     }
     
@@ -507,8 +878,8 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
     err = cfg.db.UpdateRToken(r.Context(), tkn)  
 
     if err != nil {
-        log.Printf("error with updating token: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with updating token", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     }
 
@@ -522,45 +893,58 @@ func (cfg *apiConfig) handlerUUpdate(w http.ResponseWriter, r *http.Request) {
     tkn, err := auth.GetBearerToken(r.Header)
     
     if err != nil {
-        log.Printf("476 error with getting token: %v\n", err)
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "error with getting token", "error", err)
+        problem.Write(w, r, problem.New(401, problem.MissingToken, "bearer token is required"))
         return
     }
 
     // validating JWT 
     userid, err := auth.ValidateJWT(tkn, cfg.tks)
     if err != nil {
-        log.Printf("484 error with validating jwt: %v\n", err)
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "error with validating jwt", "error", err)
+        problem.Write(w, r, problem.New(401, problem.InvalidToken, "token is invalid or expired"))
         return
     }
+    logging.SetUser(r.Context(), userid.String())
 
     // decoding request 
     eml := email{}
-    decoder := json.NewDecoder(r.Body)
-    err = decoder.Decode(&eml)
+    err = decodeJSON(r, &eml)
     
     if err != nil {
-        log.Printf("495 error with decoding request: %v\n", err)
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "error with decoding request", "error", err)
+        problem.Write(w, r, decodeProblem(err))
+        return
+    }
+
+    // validating email and password
+    err = eml.validate()
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with validating user", "error", err)
+        problem.Write(w, r, validationProblem(err))
         return
     }
 
     // hashing password 
-    hashed, err := auth.HashPassword(eml.Password)
+    hashed, err := hashPassword(r.Context(), eml.Password)
  
     if err != nil {
-        log.Printf("504 error with hashing password: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with hashing password", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     }
 
     // updating user's email and password at database
-    err = cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{eml.Email, hashed, userid})
+    err = cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{Email: eml.Email, HashedPassword: hashed, ID: userid})
     
+    if isUniqueViolation(err) {
+        slog.WarnContext(r.Context(), "error with updating user: email is taken")
+        problem.Write(w, r, problem.New(409, problem.Conflict, "email is already registered"))
+        return
+    }
     if err != nil {
-        log.Printf("512 error with updating user: %v\n", err)
-        w.WriteHeader(401)
+        slog.ErrorContext(r.Context(), "error with updating user", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     }
 
@@ -569,8 +953,8 @@ func (cfg *apiConfig) handlerUUpdate(w http.ResponseWriter, r *http.Request) {
     data, err := json.Marshal(res)
 
     if err != nil {
-        log.Printf("522 error with marshalling json: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with marshalling json", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     }
 
@@ -586,52 +970,76 @@ func (cfg *apiConfig) handlerDelChirp(w http.ResponseWriter, r *http.Request) {
     tkn, err := auth.GetBearerToken(r.Header)
     
     if err != nil {
-        log.Printf("error with getting token: %v\n", err)
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "error with getting token", "error", err)
+        problem.Write(w, r, problem.New(401, problem.MissingToken, "bearer token is required"))
         return
     }
 
     // validating JWT 
     userid, err := auth.ValidateJWT(tkn, cfg.tks)
     if err != nil {
-        log.Printf("error with validating jwt: %v\n", err)
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "error with validating jwt", "error", err)
+        problem.Write(w, r, problem.New(401, problem.InvalidToken, "token is invalid or expired"))
         return
     }
+    logging.SetUser(r.Context(), userid.String())
 
     // getting chirp 
     id, err := uuid.Parse(r.PathValue("chirpID"))
     if err != nil {
-        log.Printf("error with parsing uuid: %v\n", err) 
-        w.WriteHeader(400)
-        w.Write([]byte("chirp id is invalid"))
+        slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidID, "chirp id is invalid"))
         return
     }
 
     chp, err := cfg.db.GetChirp(r.Context(), id)
 
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with getting chirp", "error", err)
+        problem.Write(w, r, problem.New(404, problem.NotFound, "chirp does not exist"))
+        return
+    }
     if err != nil {
-        log.Printf("error with getting chirp: %v\n", err)
-        w.WriteHeader(404)
+        slog.ErrorContext(r.Context(), "error with getting chirp", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     } 
     
     // checking user match 
     if userid != chp.UserID {
-        log.Println("error with user match")
-        w.WriteHeader(403)
+        slog.WarnContext(r.Context(), "error with user match", "chirp_id", chp.ID, "author_id", chp.UserID)
+        problem.Write(w, r, problem.New(403, problem.Forbidden, "only the author can delete a chirp"))
         return 
     }
 
-    // deleting chirp 
-    err = cfg.db.DelChirp(r.Context(), chp.ID)
+    // deleting chirp and writing its outbox event in one transaction,
+    // bookmarks of it are removed by the foreign key
+    chirpRes := toChirpRes(chp)
+    err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+        err := q.DelChirp(r.Context(), chp.ID)
+        if err != nil {return err}
+
+        err = q.DeleteTargetNotifications(r.Context(), chp.ID)
+        if err != nil {return err}
+
+        // quotes of it stay and show a tombstone, a deleted quote is uncounted
+        if chp.QuoteOf.Valid {
+            err = q.DecrementQuoteCount(r.Context(), chp.QuoteOf.UUID)
+            if err != nil {return err}
+        }
+
+        _, err = outbox.Write(r.Context(), q, outbox.TopicChirpDeleted, chirpRes)
+        return err
+    })
     
     if err != nil {
-        log.Printf("error with deleting chirp: %v\n", err)
-        w.WriteHeader(500)
+        slog.ErrorContext(r.Context(), "error with deleting chirp", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return
     } 
 
+    cfg.metrics.ChirpsDeleted.Inc()
+
     // response
     w.WriteHeader(204)
     
@@ -643,88 +1051,329 @@ func (cfg *apiConfig) handlerPWH(w http.ResponseWriter, r *http.Request) {
     key, err := auth.GetAPIKey(r.Header)
     
     if err != nil {
-        log.Printf("error with getting api key: %v\n", err)
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "error with getting api key", "error", err)
+        cfg.metrics.Webhooks.WithLabelValues("unauthorized").Inc()
+        problem.Write(w, r, problem.New(401, problem.InvalidAPIKey, "api key is required"))
         return
     }
 
     // checking api key 
     if key != cfg.plk {
-        log.Printf("not matching\n")
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "error with api key: not matching")
+        cfg.metrics.Webhooks.WithLabelValues("unauthorized").Inc()
+        problem.Write(w, r, problem.New(401, problem.InvalidAPIKey, "api key is invalid"))
         return
     }
 
     // decoding request
     pwh := pWebhook{}
+    // fields polka adds later must not break the webhook, so no strict decoding
     decoder := json.NewDecoder(r.Body)
     err = decoder.Decode(&pwh)
 
     if err != nil {
-        log.Printf("error with decoding request: %v\n", err)
-        w.WriteHeader(401)
+        slog.WarnContext(r.Context(), "error with decoding request", "error", err)
+        cfg.metrics.Webhooks.WithLabelValues("invalid").Inc()
+        problem.Write(w, r, decodeProblem(err))
         return 
     }  
 
     // checking event 
     if pwh.Event != "user.upgraded" {
-        log.Printf("invalid event")
+        slog.InfoContext(r.Context(), "ignoring webhook event", "event", pwh.Event)
+        cfg.metrics.Webhooks.WithLabelValues("ignored").Inc()
         w.WriteHeader(204)
         return 
     }
 
     // updating user to red membership
-    err = cfg.db.UpdateRed(r.Context(), database.UpdateRedParams{sql.NullBool{Bool: true, Valid: true}, pwh.Data.UserID})
+    n, err := cfg.db.UpdateRed(r.Context(), database.UpdateRedParams{IsChirpyRed: sql.NullBool{Bool: true, Valid: true}, ID: pwh.Data.UserID})
 
     if err != nil {
-        log.Printf("error with updating membership: %v\n", err)
-        w.WriteHeader(404)
+        slog.ErrorContext(r.Context(), "error with updating membership", "error", err)
+        cfg.metrics.Webhooks.WithLabelValues("failed").Inc()
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
         return 
     }  
 
+    if n == 0 {
+        slog.WarnContext(r.Context(), "error with updating membership: user not found", "user_id", pwh.Data.UserID)
+        cfg.metrics.Webhooks.WithLabelValues("failed").Inc()
+        problem.Write(w, r, problem.New(404, problem.NotFound, "user does not exist"))
+        return 
+    }
+
     // response 
+    cfg.metrics.Webhooks.WithLabelValues("upgraded").Inc()
     w.WriteHeader(204) 
 }
 
+// logs msg and exits
+func fatal(msg string, args ...any) {
+    slog.Error(msg, args...)
+    os.Exit(1)
+}
+
 func main() {
-    // get DB_URL
+    // .env fills in env vars that are not set
     godotenv.Load()
-    dbURL := os.Getenv("DB_URL")
-    tknS := os.Getenv("SECRET")
-    polka := os.Getenv("POLKA")
-    if tknS == "" {log.Fatal("secret is not set")}
+
+    // config from file, env and flags, every invalid value is reported at once
+    conf, args, err := config.Load(os.Args[1:], os.Getenv, os.Stderr)
+    if errors.Is(err, flag.ErrHelp) {return}
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+        os.Exit(2)
+    }
+
+    // logging, format is json or text
+    logger, err := logging.New(os.Stderr, conf.Log.Format, conf.Log.Level)
+    if err != nil {log.Fatal(err)}
+    slog.SetDefault(logger)
+
+    // tracing, exporter is none, stdout or otlp
+    shutdownTracing, err := tracing.Setup(context.Background(), conf.Tracing.Exporter)
+    if err != nil {fatal("error with setting up tracing", "error", err)}
+    defer shutdownTracing(context.Background())
+
+    // outbox sinks, the janitor keeps events until every one of them relayed it
+    outboxBus := outbox.NewBus()
+    sinks := []outbox.Sink{outbox.LogSink{}, outboxBus}
+    if conf.Outbox.WebhookURL != "" {sinks = append(sinks, outbox.NewWebhookSink(conf.Outbox.WebhookURL))}
+
+    janitorCfg := janitor.DefaultConfig()
+    janitorCfg.RevokedTokens = conf.Janitor.RevokedTokenRetention
+    janitorCfg.Jobs = conf.Janitor.JobRetention
+    janitorCfg.Outbox = conf.Janitor.OutboxRetention
+    for _, s := range sinks {janitorCfg.Sinks = append(janitorCfg.Sinks, s.Name())}
+
     // connection to database
-    db, err := sql.Open("postgres", dbURL)
-    dbQueries := database.New(db)
+    db, err := sql.Open("postgres", conf.Database.URL)
+    if err != nil {fatal("error with opening database", "error", err)}
+    dbQueries := database.New(tracing.WrapDB(db))
+
+    // not fatal, readiness keeps failing until the database is reachable
+    pingCtx, cancelPing := context.WithTimeout(context.Background(), 5 * time.Second)
+    err = db.PingContext(pingCtx)
+    cancelPing()
+    if err != nil {slog.Warn("error with pinging database", "error", err)}
+
+    // one-off cleanup: chirpy janitor
+    jan := janitor.New(dbQueries, janitorCfg)
+    if len(args) > 0 && args[0] == "janitor" {
+        deleted, err := jan.Run(context.Background())
+        for name, n := range deleted {slog.Info("janitor done", "artifact", name, "deleted", n)}
+        if err != nil {fatal("error with running janitor", "error", err)}
+        return
+    }
 
-    mux := http.NewServeMux()
-    apiCfg := &apiConfig{fileserverHits: atomic.Int32{}, db: dbQueries, tks: tknS, plk: polka} 
+    // storing uploaded media
+    store, err := newStore(conf.Media)
+    if err != nil {fatal("error with opening media storage", "error", err)}
 
-    mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir(".")))))
+    // sending email, the file backend writes .eml files for development
+    var mail mailer.Mailer = &mailer.SMTP{Addr: conf.Mail.SMTPAddr, Username: conf.Mail.SMTPUsername, Password: conf.Mail.SMTPPassword}
+    if conf.Mail.Backend == "file" {
+        mail, err = mailer.NewFileSink(conf.Mail.Dir)
+        if err != nil {fatal("error with opening mail directory", "error", err)}
+    }
+    dig := digest.New(dbQueries, mail, digest.Config{From: conf.Mail.From, BaseURL: conf.Server.PublicURL, InactiveAfter: conf.Digest.InactiveAfter, Batch: int32(conf.Digest.BatchSize)})
+
+    mux := http.NewServeMux()
+    apiCfg := &apiConfig{fileserverHits: atomic.Int32{}, db: dbQueries, conn: db, jobs: jobs.New(dbQueries), metrics: metrics.New(db), conf: conf, store: store, moderator: moderation.Default(), tks: conf.Auth.Secret, plk: conf.Auth.PolkaKey}
+    apiCfg.metrics.Register(prometheus.NewCounterFunc(prometheus.CounterOpts{
+        Name: "chirpy_fileserver_hits_total",
+        Help: "Requests to the /app/ file server since the last reset.",
+    }, func() float64 {return float64(apiCfg.fileserverHits.Load())}))
+
+    // streaming chirps, postgres bus shares events between instances,
+    // cancelling streamCtx disconnects every sse and websocket client
+    streamCtx, stopStreams := context.WithCancel(context.Background())
+    apiCfg.streamCtx = streamCtx
+    var bus stream.Bus = stream.NewLocalBus()
+    if conf.Stream.Bus == "postgres" {bus = stream.NewPGBus(db, conf.Database.URL)}
+    apiCfg.stream = stream.New(bus, 1000, 64)
+    go func() {
+        err := apiCfg.stream.Run(streamCtx)
+        if err != nil {slog.Error("error with running stream", "error", err)}
+    }()
+
+    // chirp events reach the stream through the relay, subscribing before it
+    // starts so no relayed event is dropped
+    chirpEvents, unsubscribe := outboxBus.Subscribe("", 64)
+    defer unsubscribe()
+    go apiCfg.relayChirps(streamCtx, chirpEvents)
+
+    // relaying outbox events to sinks
+    relayCtx, stopRelay := context.WithCancel(context.Background())
+    relayDone := make(chan struct{})
+    go func() {
+        defer close(relayDone)
+        outbox.NewRelay(dbQueries, sinks...).Run(relayCtx)
+    }()
+
+    // running background jobs
+    jobs.Register(apiCfg.jobs, janitor.JobKind, func(ctx context.Context, _ struct{}) error {
+        _, err := jan.Run(ctx)
+        return err
+    })
+    err = apiCfg.jobs.Schedule(janitor.JobKind, conf.Janitor.Schedule, struct{}{})
+    if err != nil {fatal("error with scheduling janitor", "error", err)}
+    // one send job per due user, the unique key keeps a user to one digest a day
+    jobs.Register(apiCfg.jobs, digest.ScheduleKind, func(ctx context.Context, _ struct{}) error {
+        ids, err := dig.Due(ctx)
+        if err != nil {return err}
+        for _, id := range ids {
+            key := "digest:" + id.String() + ":" + time.Now().UTC().Format(time.DateOnly)
+            err := apiCfg.jobs.Enqueue(ctx, digest.SendKind, digest.Payload{UserID: id}, jobs.Options{UniqueKey: key})
+            if err != nil && !errors.Is(err, jobs.ErrDuplicate) {return err}
+        }
+        return nil
+    })
+    jobs.Register(apiCfg.jobs, digest.SendKind, func(ctx context.Context, p digest.Payload) error {
+        return dig.Send(ctx, p.UserID)
+    })
+    err = apiCfg.jobs.Schedule(digest.ScheduleKind, conf.Digest.Schedule, struct{}{})
+    if err != nil {fatal("error with scheduling digests", "error", err)}
+    jobs.Register(apiCfg.jobs, pollsCloseKind, func(ctx context.Context, _ struct{}) error {
+        return apiCfg.closePolls(ctx)
+    })
+    err = apiCfg.jobs.Schedule(pollsCloseKind, conf.Chirps.PollsSchedule, struct{}{})
+    if err != nil {fatal("error with scheduling polls", "error", err)}
+    apiCfg.jobs.Start()
+
+    mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir(conf.Server.FileserverRoot)))))
     mux.HandleFunc("GET /api/healthz",  handlerHealthz)
+    mux.Handle("GET /api/livez", health.New(time.Second).Handler())
+    mux.Handle("GET /api/readyz", apiCfg.readiness().Handler())
 
-    mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPWH)
+    mux.Handle("POST /api/polka/webhooks", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerPWH))
+
+    mux.HandleFunc("GET /api/stream/chirps", apiCfg.handlerStreamChirps)
+    mux.HandleFunc("GET /api/ws", apiCfg.handlerWS)
 
     mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDelChirp)
     mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetChirp)
     mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
-    mux.HandleFunc("POST /api/chirps", apiCfg.handlerChirps)
+    mux.Handle("POST /api/chirps/{chirpID}/vote", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerVote))
+    mux.HandleFunc("PUT /api/chirps/{chirpID}/pin", apiCfg.handlerPin)
+    mux.HandleFunc("DELETE /api/chirps/{chirpID}/pin", apiCfg.handlerUnpin)
+    mux.Handle("POST /api/chirps", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerChirps))
 
     mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
     mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
-    mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
-    mux.HandleFunc("POST /api/users", apiCfg.handlerUsers)
-    mux.HandleFunc("PUT /api/users", apiCfg.handlerUUpdate)
+    mux.Handle("POST /api/login", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerLogin))
+    mux.Handle("POST /api/users", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerUsers))
+    mux.Handle("PUT /api/users", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerUUpdate))
+    mux.HandleFunc("GET /api/users/{username}", apiCfg.handlerGetProfile)
+
+    mux.HandleFunc("GET /api/blocks", apiCfg.handlerGetBlocks)
+    mux.HandleFunc("PUT /api/blocks/{userID}", apiCfg.handlerBlock)
+    mux.HandleFunc("DELETE /api/blocks/{userID}", apiCfg.handlerUnblock)
+    mux.HandleFunc("GET /api/follows/requests", apiCfg.handlerGetFollowRequests)
+    mux.HandleFunc("POST /api/follows/requests/{userID}/approve", apiCfg.handlerApproveFollow)
+    mux.HandleFunc("POST /api/follows/requests/{userID}/deny", apiCfg.handlerDenyFollow)
+    mux.HandleFunc("PUT /api/follows/{userID}", apiCfg.handlerFollow)
+    mux.HandleFunc("DELETE /api/follows/{userID}", apiCfg.handlerUnfollow)
+    mux.HandleFunc("GET /api/conversations", apiCfg.handlerGetConversations)
+    mux.Handle("POST /api/conversations", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerCreateConversation))
+    mux.HandleFunc("GET /api/conversations/{conversationID}/messages", apiCfg.handlerGetMessages)
+    mux.Handle("POST /api/conversations/{conversationID}/messages", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerSendMessage))
+    mux.HandleFunc("PUT /api/conversations/{conversationID}/read", apiCfg.handlerReadConversation)
+
+    mux.HandleFunc("GET /api/notifications", apiCfg.handlerGetNotifications)
+    mux.HandleFunc("PUT /api/notifications/read", apiCfg.handlerReadNotifications)
+    mux.HandleFunc("PUT /api/notifications/{notificationID}/read", apiCfg.handlerReadNotification)
+    mux.HandleFunc("GET /api/notifications/preferences", apiCfg.handlerGetPreferences)
+    mux.Handle("PUT /api/notifications/preferences", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerUpdatePreferences))
+
+    mux.HandleFunc("GET /api/bookmarks", apiCfg.handlerGetBookmarks)
+    mux.HandleFunc("PUT /api/bookmarks/{chirpID}", apiCfg.handlerBookmark)
+    mux.HandleFunc("DELETE /api/bookmarks/{chirpID}", apiCfg.handlerUnbookmark)
+    mux.HandleFunc("GET /api/lists", apiCfg.handlerGetLists)
+    mux.Handle("POST /api/lists", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerCreateList))
+    mux.HandleFunc("GET /api/lists/{listID}", apiCfg.handlerGetList)
+    mux.Handle("PUT /api/lists/{listID}", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerUpdateList))
+    mux.HandleFunc("DELETE /api/lists/{listID}", apiCfg.handlerDeleteList)
+    mux.HandleFunc("GET /api/lists/{listID}/chirps", apiCfg.handlerGetListChirps)
+    mux.HandleFunc("GET /api/lists/{listID}/members", apiCfg.handlerGetListMembers)
+    mux.HandleFunc("PUT /api/lists/{listID}/members/{userID}", apiCfg.handlerAddListMember)
+    mux.HandleFunc("DELETE /api/lists/{listID}/members/{userID}", apiCfg.handlerRemoveListMember)
+
+    mux.HandleFunc("GET /api/digest/settings", apiCfg.handlerGetDigest)
+    mux.Handle("PUT /api/digest/settings", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerUpdateDigest))
+    mux.HandleFunc("GET /api/digest/unsubscribe", apiCfg.handlerUnsubscribe)
+    mux.HandleFunc("POST /api/digest/unsubscribe", apiCfg.handlerUnsubscribe)
+
+    mux.HandleFunc("GET /api/mutes", apiCfg.handlerGetMutes)
+    mux.HandleFunc("PUT /api/mutes/{userID}", apiCfg.handlerMute)
+    mux.HandleFunc("DELETE /api/mutes/{userID}", apiCfg.handlerUnmute)
+    mux.Handle("PUT /api/users/profile", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerUpdateProfile))
+    mux.Handle("PUT /api/users/username", maxBody(conf.Server.MaxBodyBytes, apiCfg.handlerUpdateUsername))
+
+    mux.Handle("POST /api/media", maxBody(conf.Media.MaxBytes + multipartOverhead, apiCfg.handlerUpload))
+    mux.HandleFunc("GET /api/media/{mediaID}", apiCfg.handlerGetMedia)
+    mux.HandleFunc("GET /api/media/{mediaID}/thumbnail", apiCfg.handlerGetThumbnail)
 
     mux.HandleFunc("GET /admin/metrics", apiCfg.handlerHits)
+    mux.Handle("GET /metrics", apiCfg.metrics.Handler())
+    mux.HandleFunc("GET /admin/jobs", apiCfg.handlerJobs)
+    mux.HandleFunc("GET /admin/config", apiCfg.handlerConfig)
     mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
    
     srv := &http.Server {
-        Addr: ":8080",
-        Handler: mux,
+        Addr: conf.Server.Addr,
+        ReadHeaderTimeout: conf.Server.ReadHeaderTimeout,
+        ReadTimeout: conf.Server.ReadTimeout,
+        WriteTimeout: conf.Server.WriteTimeout,
+        IdleTimeout: conf.Server.IdleTimeout,
+        MaxHeaderBytes: conf.Server.MaxHeaderBytes,
+        Handler: middlewareLogging(otelhttp.NewHandler(apiCfg.middlewareMetrics(middlewareRoute(mux)), "http.server")),
     }
 
-    log.Println("serving on port 8080")
-    err = srv.ListenAndServe()
-    if err != nil {log.Fatal(err)}
+    // long lived streams would keep Shutdown waiting, so they end first
+    srv.RegisterOnShutdown(stopStreams)
+
+    // serving until SIGINT or SIGTERM
+    sigCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stopSignals()
+
+    serveErr := make(chan error, 1)
+    go func() {
+        slog.Info("serving", "addr", conf.Server.Addr, "config_file", conf.File)
+        serveErr <- srv.ListenAndServe()
+    }()
+
+    select {
+    case err := <-serveErr:
+        fatal("error with serving", "error", err)
+    case <-sigCtx.Done():
+    }
+
+    // failing readiness first so load balancers stop sending traffic
+    slog.Info("shutting down", "delay", conf.Server.ShutdownDelay, "timeout", conf.Server.ShutdownTimeout)
+    apiCfg.draining.Store(true)
+    time.Sleep(conf.Server.ShutdownDelay)
+
+    // refusing new connections and draining in-flight requests
+    ctx, cancel := context.WithTimeout(context.Background(), conf.Server.ShutdownTimeout)
+    defer cancel()
+
+    err = srv.Shutdown(ctx)
+    if err != nil {
+        slog.Error("error with draining requests, closing remaining connections", "error", err)
+        srv.Close()
+    }
+
+    // stopping background work before the pool it uses
+    stopRelay()
+    <-relayDone
+
+    err = apiCfg.jobs.Shutdown(ctx)
+    if err != nil {slog.Error("error with stopping job workers", "error", err)}
+
+    err = db.Close()
+    if err != nil {slog.Error("error with closing database", "error", err)}
+
+    slog.Info("shutdown complete")
 }
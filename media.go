@@ -0,0 +1,262 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/config"
+    "github.com/sudonetizen/database"
+    "github.com/sudonetizen/media"
+    "github.com/sudonetizen/problem"
+    "github.com/sudonetizen/storage"
+)
+
+// attachments per chirp
+const maxChirpMedia = 4
+
+// multipart boundaries and headers on top of the file itself
+const multipartOverhead = 64 << 10
+
+type media_res struct {
+    Id            uuid.UUID `json:"id"`
+    Url           string    `json:"url"`
+    Thumbnail_url string    `json:"thumbnail_url"`
+    Content_type  string    `json:"content_type"`
+    Width         int32     `json:"width"`
+    Height        int32     `json:"height"`
+}
+
+func mediaURL(id uuid.UUID) string {
+    return "/api/media/" + id.String()
+}
+
+func toMediaRes(id uuid.UUID, contentType string, width, height int32) media_res {
+    return media_res{
+        Id: id,
+        Url: mediaURL(id),
+        Thumbnail_url: mediaURL(id) + "/thumbnail",
+        Content_type: contentType,
+        Width: width,
+        Height: height,
+    }
+}
+
+// builds the configured storage backend, filesystem or s3
+func newStore(m config.Media) (storage.Store, error) {
+    if m.Storage == "s3" {return storage.NewS3(m.S3Endpoint, m.S3Bucket, m.S3Region, m.S3AccessKey, m.S3SecretKey), nil}
+    return storage.NewFS(m.Dir)
+}
+
+// fills in the attachments of chirps with one query
+func (cfg *apiConfig) withMedia(ctx context.Context, q *database.Queries, chirps []chirp_res) error {
+    if len(chirps) == 0 {return nil}
+
+    ids := make([]uuid.UUID, 0, len(chirps))
+    for _, ch := range chirps {ids = append(ids, ch.Id)}
+
+    rows, err := q.GetChirpMedia(ctx, ids)
+    if err != nil {return err}
+
+    byChirp := map[uuid.UUID][]media_res{}
+    for _, row := range rows {
+        byChirp[row.ChirpID] = append(byChirp[row.ChirpID], toMediaRes(row.ID, row.ContentType, row.Width, row.Height))
+    }
+    for i := range chirps {chirps[i].Media = byChirp[chirps[i].Id]}
+
+    return nil
+}
+
+// checks ids are distinct, at most max and all uploaded by userID,
+// a non nil problem reports field as invalid
+func (cfg *apiConfig) checkOwnedMedia(ctx context.Context, userID uuid.UUID, field string, ids []uuid.UUID, max int) (*problem.Problem, error) {
+    if len(ids) == 0 {return nil, nil}
+    if len(ids) > max {
+        return problem.Validation(problem.FieldError{Field: field, Code: "too_many", Message: fmt.Sprintf("at most %d attachments", max)}), nil
+    }
+
+    seen := map[uuid.UUID]struct{}{}
+    for _, id := range ids {
+        if _, ok := seen[id]; ok {
+            return problem.Validation(problem.FieldError{Field: field, Code: "duplicate", Message: "attachments must be distinct"}), nil
+        }
+        seen[id] = struct{}{}
+    }
+
+    n, err := cfg.db.CountOwnedMedia(ctx, database.CountOwnedMediaParams{Ids: ids, OwnerID: userID})
+    if err != nil {return nil, err}
+    if int(n) != len(ids) {
+        return problem.Validation(problem.FieldError{Field: field, Code: "not_found", Message: "attachments must be your own uploads"}), nil
+    }
+
+    return nil, nil
+}
+
+// handles -> post /api/media
+func (cfg *apiConfig) handlerUpload(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    // finding the file part, nothing is buffered to disk
+    mr, err := r.MultipartReader()
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with reading multipart", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidUpload, "body must be multipart/form-data with a file field"))
+        return
+    }
+
+    var data []byte
+    for {
+        part, err := mr.NextPart()
+        if err == io.EOF {break}
+        if err != nil {
+            slog.WarnContext(r.Context(), "error with reading multipart", "error", err)
+            problem.Write(w, r, decodeProblem(err))
+            return
+        }
+        if part.FormName() != "file" {continue}
+
+        max := cfg.conf.Media.MaxBytes
+        data, err = io.ReadAll(io.LimitReader(part, int64(max) + 1))
+        if err != nil {
+            slog.WarnContext(r.Context(), "error with reading upload", "error", err)
+            problem.Write(w, r, decodeProblem(err))
+            return
+        }
+        if len(data) > max {
+            slog.WarnContext(r.Context(), "error with upload: too large", "limit", max)
+            problem.Write(w, r, problem.New(413, problem.BodyTooLarge, fmt.Sprintf("file is larger than %d bytes", max)))
+            return
+        }
+        break
+    }
+    if data == nil {
+        slog.WarnContext(r.Context(), "error with upload: no file field")
+        problem.Write(w, r, problem.New(400, problem.InvalidUpload, "body must be multipart/form-data with a file field"))
+        return
+    }
+
+    // sniffing, stripping metadata and making the thumbnail
+    img, err := media.Process(data, media.Options{MaxDimension: cfg.conf.Media.MaxDimension, ThumbnailSize: cfg.conf.Media.ThumbnailSize, MaxFrames: cfg.conf.Media.MaxFrames, MaxPixels: int64(cfg.conf.Media.MaxPixels)})
+    if errors.Is(err, media.ErrUnsupported) {
+        slog.WarnContext(r.Context(), "error with processing upload", "error", err)
+        problem.Write(w, r, problem.New(415, problem.UnsupportedMedia, err.Error()))
+        return
+    }
+    if errors.Is(err, media.ErrTooBig) {
+        slog.WarnContext(r.Context(), "error with processing upload", "error", err)
+        problem.Write(w, r, problem.Validation(problem.FieldError{Field: "file", Code: "too_large", Message: fmt.Sprintf("image sides can be at most %d pixels", cfg.conf.Media.MaxDimension)}))
+        return
+    }
+    if errors.Is(err, media.ErrTooManyFrames) {
+        slog.WarnContext(r.Context(), "error with processing upload", "error", err)
+        problem.Write(w, r, problem.Validation(problem.FieldError{Field: "file", Code: "too_large", Message: fmt.Sprintf("gifs can have at most %d frames and %d pixels over all frames", cfg.conf.Media.MaxFrames, cfg.conf.Media.MaxPixels)}))
+        return
+    }
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with processing upload", "error", err)
+        problem.Write(w, r, problem.Validation(problem.FieldError{Field: "file", Code: "invalid_image", Message: "image can not be decoded"}))
+        return
+    }
+
+    // storing both files before the row so a row never points at nothing
+    id := uuid.New()
+    key, thumbKey := "media/" + id.String(), "thumbnails/" + id.String()
+
+    err = cfg.store.Put(r.Context(), key, img.Data, img.ContentType)
+    if err == nil {err = cfg.store.Put(r.Context(), thumbKey, img.Thumbnail, img.ThumbnailType)}
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with storing upload", "error", err)
+        cfg.deleteObjects(r.Context(), key, thumbKey)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    m, err := cfg.db.CreateMedia(r.Context(), database.CreateMediaParams{
+        ID: id,
+        OwnerID: userid,
+        ContentType: img.ContentType,
+        SizeBytes: int64(len(img.Data)),
+        Width: int32(img.Width),
+        Height: int32(img.Height),
+        StorageKey: key,
+        ThumbnailKey: thumbKey,
+        ThumbnailType: img.ThumbnailType,
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with saving media", "error", err)
+        cfg.deleteObjects(r.Context(), key, thumbKey)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    writeJSON(w, r, 201, toMediaRes(m.ID, m.ContentType, m.Width, m.Height))
+}
+
+// best effort, an orphaned object only costs space
+func (cfg *apiConfig) deleteObjects(ctx context.Context, keys ...string) {
+    for _, key := range keys {
+        err := cfg.store.Delete(context.WithoutCancel(ctx), key)
+        if err != nil {slog.ErrorContext(ctx, "error with deleting object", "key", key, "error", err)}
+    }
+}
+
+// handles -> get /api/media/{mediaID}
+func (cfg *apiConfig) handlerGetMedia(w http.ResponseWriter, r *http.Request) {
+    cfg.serveMedia(w, r, false)
+}
+
+// handles -> get /api/media/{mediaID}/thumbnail
+func (cfg *apiConfig) handlerGetThumbnail(w http.ResponseWriter, r *http.Request) {
+    cfg.serveMedia(w, r, true)
+}
+
+func (cfg *apiConfig) serveMedia(w http.ResponseWriter, r *http.Request, thumb bool) {
+    id, err := uuid.Parse(r.PathValue("mediaID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidID, "media id is invalid"))
+        return
+    }
+
+    m, err := cfg.db.GetMedia(r.Context(), id)
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with getting media", "error", err)
+        problem.Write(w, r, problem.New(404, problem.NotFound, "media does not exist"))
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting media", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    key, contentType := m.StorageKey, m.ContentType
+    if thumb {key, contentType = m.ThumbnailKey, m.ThumbnailType}
+
+    body, err := cfg.store.Get(r.Context(), key)
+    if errors.Is(err, storage.ErrNotFound) {
+        slog.ErrorContext(r.Context(), "error with getting object: missing", "key", key)
+        problem.Write(w, r, problem.New(404, problem.NotFound, "media does not exist"))
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting object", "key", key, "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+    defer body.Close()
+
+    // objects never change once stored
+    w.Header().Set("Content-Type", contentType)
+    w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.WriteHeader(200)
+
+    _, err = io.Copy(w, body)
+    if err != nil {slog.WarnContext(r.Context(), "error with sending media", "error", err)}
+}
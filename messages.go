@@ -0,0 +1,376 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "time"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+    "github.com/sudonetizen/problem"
+    "github.com/sudonetizen/stream"
+    "github.com/sudonetizen/validate"
+)
+
+// messages per page
+const (
+    defaultMessagePage = 50
+    maxMessagePage     = 100
+)
+
+type conversationReq struct {
+    Participant_ids []uuid.UUID `json:"participant_ids"`
+}
+
+type messageReq struct {
+    Body string `json:"body"`
+}
+
+type participant_res struct {
+    User_id      uuid.UUID  `json:"user_id"`
+    Username     string     `json:"username"`
+    Last_read_at *time.Time `json:"last_read_at"`
+}
+
+type conversation_res struct {
+    Id           uuid.UUID         `json:"id"`
+    Created_at   time.Time         `json:"created_at"`
+    Updated_at   time.Time         `json:"updated_at"`
+    Unread       int64             `json:"unread"`
+    Participants []participant_res `json:"participants"`
+}
+
+type message_res struct {
+    Id              uuid.UUID `json:"id"`
+    Conversation_id uuid.UUID `json:"conversation_id"`
+    Sender_id       uuid.UUID `json:"sender_id"`
+    Body            string    `json:"body"`
+    Created_at      time.Time `json:"created_at"`
+}
+
+func toMessageRes(m database.Message) message_res {
+    return message_res{m.ID, m.ConversationID, m.SenderID, m.Body, m.CreatedAt}
+}
+
+// fills in the participants of conversations with one query
+func withParticipants(ctx context.Context, q *database.Queries, convs []conversation_res) error {
+    if len(convs) == 0 {return nil}
+
+    ids := make([]uuid.UUID, 0, len(convs))
+    for _, c := range convs {ids = append(ids, c.Id)}
+
+    rows, err := q.GetConversationMembers(ctx, ids)
+    if err != nil {return err}
+
+    byConv := map[uuid.UUID][]participant_res{}
+    for _, row := range rows {
+        p := participant_res{User_id: row.ID, Username: row.Username.String}
+        if row.LastReadAt.Valid {p.Last_read_at = &row.LastReadAt.Time}
+        byConv[row.ConversationID] = append(byConv[row.ConversationID], p)
+    }
+    for i := range convs {convs[i].Participants = byConv[convs[i].Id]}
+
+    return nil
+}
+
+// authenticates the caller and checks they are in the conversation of the path,
+// on failure the problem is written and ok is false
+func (cfg *apiConfig) conversationMember(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return uuid.Nil, uuid.Nil, false}
+
+    convid, err := uuid.Parse(r.PathValue("conversationID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidID, "conversation id is invalid"))
+        return uuid.Nil, uuid.Nil, false
+    }
+
+    // outsiders can not tell a conversation exists
+    member, err := cfg.db.IsConversationMember(r.Context(), database.IsConversationMemberParams{ConversationID: convid, UserID: userid})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with checking conversation member", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return uuid.Nil, uuid.Nil, false
+    }
+    if !member {
+        slog.WarnContext(r.Context(), "error with conversation: not a member")
+        problem.Write(w, r, problem.New(404, problem.NotFound, "conversation does not exist"))
+        return uuid.Nil, uuid.Nil, false
+    }
+
+    return userid, convid, true
+}
+
+// handles -> post /api/conversations
+func (cfg *apiConfig) handlerCreateConversation(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    req := conversationReq{}
+    err := decodeJSON(r, &req)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with decoding", "error", err)
+        problem.Write(w, r, decodeProblem(err))
+        return
+    }
+
+    // the caller is always a participant, repeats are ignored
+    others := []uuid.UUID{}
+    seen := map[uuid.UUID]struct{}{userid: {}}
+    for _, id := range req.Participant_ids {
+        if _, ok := seen[id]; ok {continue}
+        seen[id] = struct{}{}
+        others = append(others, id)
+    }
+
+    max := cfg.conf.Messages.MaxGroupSize
+    if len(others) == 0 || len(others) + 1 > max {
+        slog.WarnContext(r.Context(), "error with validating conversation", "participants", len(others))
+        problem.Write(w, r, problem.Validation(problem.FieldError{Field: "participant_ids", Code: "out_of_range", Message: fmt.Sprintf("between 1 and %d other users", max - 1)}))
+        return
+    }
+
+    n, err := cfg.db.CountUsers(r.Context(), others)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with counting users", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+    if int(n) != len(others) {
+        slog.WarnContext(r.Context(), "error with validating conversation: unknown users")
+        problem.Write(w, r, problem.Validation(problem.FieldError{Field: "participant_ids", Code: "not_found", Message: "every participant must be an existing user"}))
+        return
+    }
+
+    // no conversation with someone on either side of a block
+    n, err = cfg.db.CountBlocksWith(r.Context(), database.CountBlocksWithParams{UserID: userid, Ids: others})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with counting blocks", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+    if n > 0 {
+        slog.WarnContext(r.Context(), "error with creating conversation: blocked")
+        problem.Write(w, r, problem.New(403, problem.Forbidden, "you can not message one of these users"))
+        return
+    }
+
+    // two users share one direct conversation, its unique key settles concurrent requests
+    key := sql.NullString{}
+    if len(others) == 1 {key = sql.NullString{String: directKey(userid, others[0]), Valid: true}}
+
+    code := 201
+    convid := uuid.Nil
+    err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+        conv, err := q.CreateConversation(r.Context(), key)
+        if errors.Is(err, sql.ErrNoRows) {
+            code = 200
+            convid, err = q.FindDirectConversation(r.Context(), key)
+            return err
+        }
+        if err != nil {return err}
+
+        for _, id := range append([]uuid.UUID{userid}, others...) {
+            err = q.AddConversationMember(r.Context(), database.AddConversationMemberParams{ConversationID: conv.ID, UserID: id})
+            if err != nil {return err}
+        }
+
+        convid = conv.ID
+        return nil
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with creating conversation", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    cfg.writeConversation(w, r, code, userid, convid)
+}
+
+// key of the direct conversation of two users, the same in both orders
+func directKey(a, b uuid.UUID) string {
+    x, y := a.String(), b.String()
+    if x > y {x, y = y, x}
+    return x + ":" + y
+}
+
+// writes one conversation as the caller sees it
+func (cfg *apiConfig) writeConversation(w http.ResponseWriter, r *http.Request, code int, userid, convid uuid.UUID) {
+    row, err := cfg.db.GetConversation(r.Context(), database.GetConversationParams{ID: convid, UserID: userid})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting conversation", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    list := []conversation_res{{Id: row.ID, Created_at: row.CreatedAt, Updated_at: row.UpdatedAt, Unread: row.Unread}}
+    err = withParticipants(r.Context(), cfg.db, list)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting participants", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    writeJSON(w, r, code, list[0])
+}
+
+// handles -> get /api/conversations
+func (cfg *apiConfig) handlerGetConversations(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    rows, err := cfg.db.GetConversations(r.Context(), userid)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting conversations", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    list := []conversation_res{}
+    for _, row := range rows {
+        list = append(list, conversation_res{Id: row.ID, Created_at: row.CreatedAt, Updated_at: row.UpdatedAt, Unread: row.Unread})
+    }
+
+    err = withParticipants(r.Context(), cfg.db, list)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting participants", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    writeJSON(w, r, 200, list)
+}
+
+// handles -> get /api/conversations/{conversationID}/messages
+func (cfg *apiConfig) handlerGetMessages(w http.ResponseWriter, r *http.Request) {
+    _, convid, ok := cfg.conversationMember(w, r)
+    if !ok {return}
+
+    // paging with ?before=<oldest id seen>&limit=
+    before, limit, ok := page(w, r, defaultMessagePage, maxMessagePage)
+    if !ok {return}
+
+    msgs, err := cfg.db.GetMessages(r.Context(), database.GetMessagesParams{ConversationID: convid, BeforeID: before, MaxRows: limit})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting messages", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    list := []message_res{}
+    for _, m := range msgs {list = append(list, toMessageRes(m))}
+    writeJSON(w, r, 200, list)
+}
+
+// handles -> post /api/conversations/{conversationID}/messages
+func (cfg *apiConfig) handlerSendMessage(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    convid, err := uuid.Parse(r.PathValue("conversationID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidID, "conversation id is invalid"))
+        return
+    }
+
+    // decoding, validating and moderating the body like a chirp's
+    req := messageReq{}
+    err = decodeJSON(r, &req)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with decoding", "error", err)
+        problem.Write(w, r, decodeProblem(err))
+        return
+    }
+
+    v := validate.Validator{}
+    v.Text("body", req.Body, 1, cfg.conf.Messages.MaxLength)
+    err = v.Err()
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with validating message", "error", err)
+        problem.Write(w, r, validationProblem(err))
+        return
+    }
+
+    body, err := cfg.moderator.Moderate(r.Context(), req.Body)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with moderating message", "error", err)
+        problem.Write(w, r, moderationProblem(err))
+        return
+    }
+
+    // membership and blocks are checked by the insert
+    msg := database.Message{}
+    members := []database.GetConversationMembersRow{}
+    err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+        msg, err = q.CreateMessage(r.Context(), database.CreateMessageParams{ConversationID: convid, SenderID: userid, Body: body})
+        if err != nil {return err}
+
+        err = q.TouchConversation(r.Context(), database.TouchConversationParams{ID: convid, UpdatedAt: msg.CreatedAt})
+        if err != nil {return err}
+
+        // the sender has read everything up to their own message
+        err = q.MarkConversationRead(r.Context(), database.MarkConversationReadParams{ConversationID: convid, UserID: userid})
+        if err != nil {return err}
+
+        members, err = q.GetConversationMembers(r.Context(), []uuid.UUID{convid})
+        return err
+    })
+    if errors.Is(err, sql.ErrNoRows) {
+        member, err := cfg.db.IsConversationMember(r.Context(), database.IsConversationMemberParams{ConversationID: convid, UserID: userid})
+        if err == nil && !member {
+            slog.WarnContext(r.Context(), "error with sending message: not a member")
+            problem.Write(w, r, problem.New(404, problem.NotFound, "conversation does not exist"))
+            return
+        }
+        if err == nil {
+            slog.WarnContext(r.Context(), "error with sending message: blocked")
+            problem.Write(w, r, problem.New(403, problem.Forbidden, "you can not message this conversation"))
+            return
+        }
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with sending message", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    res := toMessageRes(msg)
+    for _, m := range members {
+        if m.ID != userid {cfg.publishMessage(r.Context(), m.ID, res)}
+    }
+
+    writeJSON(w, r, 201, res)
+}
+
+// pushes a message to every open connection of userID
+func (cfg *apiConfig) publishMessage(ctx context.Context, userID uuid.UUID, m message_res) {
+    data, err := json.Marshal(m)
+    if err != nil {
+        slog.ErrorContext(ctx, "error with marshalling message", "error", err)
+        return
+    }
+
+    err = cfg.stream.Publish(ctx, stream.Event{Type: "message.created", Author: m.Sender_id, Recipient: userID, Data: data})
+    if err != nil {slog.ErrorContext(ctx, "error with publishing message", "error", err)}
+}
+
+// handles -> put /api/conversations/{conversationID}/read
+func (cfg *apiConfig) handlerReadConversation(w http.ResponseWriter, r *http.Request) {
+    userid, convid, ok := cfg.conversationMember(w, r)
+    if !ok {return}
+
+    err := cfg.db.MarkConversationRead(r.Context(), database.MarkConversationReadParams{ConversationID: convid, UserID: userid})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with marking conversation read", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    w.WriteHeader(204)
+}
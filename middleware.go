@@ -0,0 +1,135 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "log/slog"
+    "net"
+    "net/http"
+    "time"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/logging"
+    "github.com/sudonetizen/problem"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// remembers the status code, keeps flushing (sse) and hijacking (websocket) working
+type statusWriter struct {
+    http.ResponseWriter
+    status int
+    bytes  int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+    if sw.status == 0 {sw.status = code}
+    sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+    if sw.status == 0 {sw.status = http.StatusOK}
+    n, err := sw.ResponseWriter.Write(b)
+    sw.bytes += n
+    return n, err
+}
+
+func (sw *statusWriter) Flush() {
+    if f, ok := sw.ResponseWriter.(http.Flusher); ok {f.Flush()}
+}
+
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+    h, ok := sw.ResponseWriter.(http.Hijacker)
+    if !ok {return nil, nil, fmt.Errorf("response writer can not hijack")}
+
+    // a hijacked websocket counts as switching protocols
+    if sw.status == 0 {sw.status = http.StatusSwitchingProtocols}
+    return h.Hijack()
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+    return sw.ResponseWriter
+}
+
+func (sw *statusWriter) code() int {
+    if sw.status == 0 {return http.StatusOK}
+    return sw.status
+}
+
+// middleware that records request count, latency and in-flight requests,
+// the route label is the mux pattern which the mux sets on r while serving
+func (cfg *apiConfig) middlewareMetrics(next http.Handler) http.Handler {
+    return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+        cfg.metrics.InFlight.Inc()
+        defer cfg.metrics.InFlight.Dec()
+
+        start := time.Now()
+        sw := &statusWriter{ResponseWriter: w}
+        next.ServeHTTP(sw, r)
+
+        cfg.metrics.ObserveRequest(r.Pattern, r.Method, sw.code(), time.Since(start))
+    })
+}
+
+// accepts client supplied request ids only if they are short and printable
+func validRequestID(id string) bool {
+    if id == "" || len(id) > 128 {return false}
+
+    for _, c := range id {
+        if c < 0x21 || c > 0x7e {return false}
+    }
+    return true
+}
+
+// middleware that assigns or propagates X-Request-ID, puts request fields in
+// the context for every log line and writes one access log line per request
+func middlewareLogging(next http.Handler) http.Handler {
+    return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get("X-Request-ID")
+        if !validRequestID(id) {id = uuid.NewString()}
+        w.Header().Set("X-Request-ID", id)
+
+        r = logging.WithRequest(r, id)
+        start := time.Now()
+        sw := &statusWriter{ResponseWriter: w}
+        next.ServeHTTP(sw, r)
+
+        slog.LogAttrs(r.Context(), slog.LevelInfo, "request",
+            slog.String("method", r.Method),
+            slog.String("path", r.URL.Path),
+            slog.Int("status", sw.code()),
+            slog.Int("bytes", sw.bytes),
+            slog.Duration("duration", time.Since(start)),
+            slog.String("remote", r.RemoteAddr),
+        )
+    })
+}
+
+// middleware right before the mux, log lines pick up the route the mux sets
+// on r and the request span is named after it once routing is done
+func middlewareRoute(next http.Handler) http.Handler {
+    return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+        logging.Track(r)
+        next.ServeHTTP(w, r)
+
+        if r.Pattern == "" {return}
+        span := trace.SpanFromContext(r.Context())
+        span.SetName(r.Pattern)
+        span.SetAttributes(attribute.String("http.route", r.Pattern))
+    })
+}
+
+// middleware limiting the request body to n bytes, bigger bodies get 413
+// once the handler reads past the limit
+func maxBody(n int, next http.HandlerFunc) http.Handler {
+    return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+        // known up front, no need to read anything
+        if r.ContentLength > int64(n) {
+            slog.WarnContext(r.Context(), "error with request body: too large", "content_length", r.ContentLength, "limit", n)
+            problem.Write(w, r, problem.New(413, problem.BodyTooLarge, fmt.Sprintf("body is larger than %d bytes", n)))
+            return
+        }
+
+        r.Body = http.MaxBytesReader(w, r.Body, int64(n))
+        next(w, r)
+    })
+}
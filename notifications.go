@@ -0,0 +1,354 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "regexp"
+    "slices"
+    "sort"
+    "strings"
+    "time"
+    "unicode"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+    "github.com/sudonetizen/problem"
+    "github.com/sudonetizen/stream"
+)
+
+// notification kinds delivered on the notifications topic
+const (
+    notifyMention        = "mention"
+    notifyFollow         = "follow"
+    notifyFollowRequest  = "follow_request"
+    notifyFollowAccepted = "follow_accepted"
+    notifyPollClosed     = "poll_closed"
+)
+
+// kinds users can turn off, chirp kinds point at a chirp
+var (
+    notifyKinds      = []string{notifyMention, notifyFollow, notifyFollowRequest, notifyFollowAccepted, notifyPollClosed}
+    notifyChirpKinds = map[string]struct{}{notifyMention: {}, notifyPollClosed: {}}
+)
+
+const (
+    // actors listed on one notification, the rest are only counted
+    notifyActors = 3
+    // mentions of one chirp that notify, the rest are plain text
+    maxMentions = 10
+
+    defaultNotificationPage = 50
+    maxNotificationPage     = 100
+)
+
+var mentionPattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,15}$`)
+
+type actor_res struct {
+    User_id  uuid.UUID `json:"user_id"`
+    Username string    `json:"username"`
+}
+
+// notification payload, one per burst of the same kind about the same target
+type notification struct {
+    Id          uuid.UUID   `json:"id"`
+    Kind        string      `json:"kind"`
+    Actor_id    uuid.UUID   `json:"actor_id"`
+    Chirp_id    *uuid.UUID  `json:"chirp_id,omitempty"`
+    Actors      []actor_res `json:"actors"`
+    Actor_count int         `json:"actor_count"`
+    Summary     string      `json:"summary"`
+    Read        bool        `json:"read"`
+    Created_at  time.Time   `json:"created_at"`
+    Updated_at  time.Time   `json:"updated_at"`
+}
+
+type notifications_res struct {
+    Unread        int64          `json:"unread"`
+    Notifications []notification `json:"notifications"`
+}
+
+// @usernames of a chirp body, lowercased and without repeats
+func mentions(body string) []string {
+    seen := map[string]struct{}{}
+    names := []string{}
+    for _, word := range strings.Fields(body) {
+        if !strings.HasPrefix(word, "@") {continue}
+
+        name := strings.TrimRightFunc(word[1:], func(r rune) bool {return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'})
+        if !mentionPattern.MatchString(name) {continue}
+
+        name = strings.ToLower(name)
+        if _, ok := seen[name]; ok {continue}
+        seen[name] = struct{}{}
+        names = append(names, name)
+        if len(names) == maxMentions {break}
+    }
+    return names
+}
+
+// a line like "5 people followed you"
+func summary(kind string, actors []actor_res, count int) string {
+    who := "someone"
+    if len(actors) > 0 && actors[0].Username != "" {who = "@" + actors[0].Username}
+    if count > 1 {who = fmt.Sprintf("%d people", count)}
+
+    switch kind {
+    case notifyMention:
+        return who + " mentioned you"
+    case notifyFollow:
+        return who + " followed you"
+    case notifyFollowRequest:
+        return who + " asked to follow you"
+    case notifyFollowAccepted:
+        return who + " accepted your follow request"
+    case notifyPollClosed:
+        return "the poll by " + who + " you voted in has ended"
+    }
+    return who + " " + kind
+}
+
+// turns rows into payloads, actor names are loaded with one query
+func toNotifications(ctx context.Context, q *database.Queries, rows []database.Notification) ([]notification, error) {
+    ids := []uuid.UUID{}
+    for _, row := range rows {
+        n := min(len(row.ActorIds), notifyActors)
+        ids = append(ids, row.ActorIds[:n]...)
+    }
+
+    names := map[uuid.UUID]string{}
+    if len(ids) > 0 {
+        users, err := q.GetUsersByIDs(ctx, ids)
+        if err != nil {return nil, err}
+        for _, u := range users {names[u.ID] = u.Username.String}
+    }
+
+    list := []notification{}
+    for _, row := range rows {
+        n := notification{
+            Id: row.ID,
+            Kind: row.Kind,
+            Actors: []actor_res{},
+            Actor_count: len(row.ActorIds),
+            Read: row.ReadAt.Valid,
+            Created_at: row.CreatedAt,
+            Updated_at: row.UpdatedAt,
+        }
+        if len(row.ActorIds) > 0 {n.Actor_id = row.ActorIds[0]}
+        if _, ok := notifyChirpKinds[row.Kind]; ok {
+            id := row.TargetID
+            n.Chirp_id = &id
+        }
+        for i := 0; i < len(row.ActorIds) && i < notifyActors; i++ {
+            n.Actors = append(n.Actors, actor_res{row.ActorIds[i], names[row.ActorIds[i]]})
+        }
+        n.Summary = summary(n.Kind, n.Actors, n.Actor_count)
+        list = append(list, n)
+    }
+
+    return list, nil
+}
+
+// records that actorID did kind to userID about target and pushes the updated
+// notification, best effort so the action itself never fails because of it
+func (cfg *apiConfig) notify(ctx context.Context, userID uuid.UUID, kind string, actorID, target uuid.UUID) {
+    row, err := cfg.db.Notify(ctx, database.NotifyParams{UserID: userID, Kind: kind, TargetID: target, ActorID: actorID})
+    // filtered out by preferences, blocks, mutes or visibility
+    if errors.Is(err, sql.ErrNoRows) {return}
+    if err != nil {
+        slog.ErrorContext(ctx, "error with creating notification", "kind", kind, "error", err)
+        return
+    }
+
+    list, err := toNotifications(ctx, cfg.db, []database.Notification{row})
+    if err != nil {
+        slog.ErrorContext(ctx, "error with loading notification", "error", err)
+        return
+    }
+
+    cfg.publishNotification(ctx, userID, list[0])
+}
+
+// notifies every user mentioned by a new chirp
+func (cfg *apiConfig) notifyMentions(ctx context.Context, ch chirp_res) {
+    names := mentions(ch.Body)
+    if len(names) == 0 {return}
+
+    users, err := cfg.db.GetUsersByUsernames(ctx, names)
+    if err != nil {
+        slog.ErrorContext(ctx, "error with getting mentioned users", "error", err)
+        return
+    }
+
+    for _, u := range users {cfg.notify(ctx, u.ID, notifyMention, ch.User_id, ch.Id)}
+}
+
+// pushes a notification to every open connection of userID
+func (cfg *apiConfig) publishNotification(ctx context.Context, userID uuid.UUID, n notification) {
+    data, err := json.Marshal(n)
+    if err != nil {
+        slog.ErrorContext(ctx, "error with marshalling notification", "error", err)
+        return
+    }
+
+    err = cfg.stream.Publish(ctx, stream.Event{Type: "notification." + n.Kind, Author: n.Actor_id, Recipient: userID, Data: data})
+    if err != nil {slog.ErrorContext(ctx, "error with publishing notification", "error", err)}
+}
+
+// handles -> get /api/notifications
+func (cfg *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    // paging with ?before=<last id seen>&limit=, ?unread=true leaves out read ones
+    before, limit, ok := page(w, r, defaultNotificationPage, maxNotificationPage)
+    if !ok {return}
+    unreadOnly := r.URL.Query().Get("unread") == "true"
+
+    rows, err := cfg.db.GetNotifications(r.Context(), database.GetNotificationsParams{UserID: userid, UnreadOnly: unreadOnly, BeforeID: before, MaxRows: limit})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting notifications", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    unread, err := cfg.db.CountUnreadNotifications(r.Context(), userid)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with counting notifications", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    list, err := toNotifications(r.Context(), cfg.db, rows)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with loading notifications", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    writeJSON(w, r, 200, notifications_res{unread, list})
+}
+
+// handles -> put /api/notifications/read
+func (cfg *apiConfig) handlerReadNotifications(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    err := cfg.db.MarkAllNotificationsRead(r.Context(), userid)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with marking notifications read", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    w.WriteHeader(204)
+}
+
+// handles -> put /api/notifications/{notificationID}/read
+func (cfg *apiConfig) handlerReadNotification(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    id, err := uuid.Parse(r.PathValue("notificationID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidID, "notification id is invalid"))
+        return
+    }
+
+    n, err := cfg.db.MarkNotificationRead(r.Context(), database.MarkNotificationReadParams{ID: id, UserID: userid})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with marking notification read", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+    if n == 0 {
+        slog.WarnContext(r.Context(), "error with marking notification read: not found")
+        problem.Write(w, r, problem.New(404, problem.NotFound, "notification does not exist"))
+        return
+    }
+
+    w.WriteHeader(204)
+}
+
+// every kind with its setting, kinds without a stored row are on
+func (cfg *apiConfig) preferences(ctx context.Context, userID uuid.UUID) (map[string]bool, error) {
+    rows, err := cfg.db.GetNotificationPreferences(ctx, userID)
+    if err != nil {return nil, err}
+
+    prefs := map[string]bool{}
+    for _, kind := range notifyKinds {prefs[kind] = true}
+    // rows of kinds that are gone are left out
+    for _, row := range rows {
+        if _, ok := prefs[row.Kind]; ok {prefs[row.Kind] = row.Enabled}
+    }
+    return prefs, nil
+}
+
+// handles -> get /api/notifications/preferences
+func (cfg *apiConfig) handlerGetPreferences(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    prefs, err := cfg.preferences(r.Context(), userid)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting preferences", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    writeJSON(w, r, 200, prefs)
+}
+
+// handles -> put /api/notifications/preferences, kinds left out keep their setting
+func (cfg *apiConfig) handlerUpdatePreferences(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    req := map[string]bool{}
+    err := decodeJSON(r, &req)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with decoding", "error", err)
+        problem.Write(w, r, decodeProblem(err))
+        return
+    }
+
+    // every unknown kind is reported, in a stable order
+    unknown := []problem.FieldError{}
+    for kind := range req {
+        if !slices.Contains(notifyKinds, kind) {
+            unknown = append(unknown, problem.FieldError{Field: kind, Code: "unknown", Message: "not a notification kind"})
+        }
+    }
+    if len(unknown) > 0 {
+        sort.Slice(unknown, func(i, j int) bool {return unknown[i].Field < unknown[j].Field})
+        slog.WarnContext(r.Context(), "error with validating preferences", "unknown", len(unknown))
+        problem.Write(w, r, problem.Validation(unknown...))
+        return
+    }
+
+    err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+        for kind, enabled := range req {
+            err := q.SetNotificationPreference(r.Context(), database.SetNotificationPreferenceParams{UserID: userid, Kind: kind, Enabled: enabled})
+            if err != nil {return err}
+        }
+        return nil
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with updating preferences", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    prefs, err := cfg.preferences(r.Context(), userid)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting preferences", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    writeJSON(w, r, 200, prefs)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+    "database/sql"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+    "github.com/sudonetizen/problem"
+)
+
+// authenticates the caller and loads the chirp in the path, only its author
+// may go on, on failure the problem is written and ok is false
+func (cfg *apiConfig) authorChirp(w http.ResponseWriter, r *http.Request) (database.Chirp, bool) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return database.Chirp{}, false}
+
+    id, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidID, "chirp id is invalid"))
+        return database.Chirp{}, false
+    }
+
+    chp, err := cfg.db.GetChirp(r.Context(), id)
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with getting chirp", "error", err)
+        problem.Write(w, r, problem.New(404, problem.NotFound, "chirp does not exist"))
+        return database.Chirp{}, false
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting chirp", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return database.Chirp{}, false
+    }
+
+    if userid != chp.UserID {
+        slog.WarnContext(r.Context(), "error with user match", "chirp_id", chp.ID, "author_id", chp.UserID)
+        problem.Write(w, r, problem.New(403, problem.Forbidden, "only the author can pin a chirp"))
+        return database.Chirp{}, false
+    }
+
+    return chp, true
+}
+
+// handles -> put /api/chirps/{chirpID}/pin
+func (cfg *apiConfig) handlerPin(w http.ResponseWriter, r *http.Request) {
+    chp, ok := cfg.authorChirp(w, r)
+    if !ok {return}
+
+    // chirpy red allows more pins, pins over the limit after a downgrade stay,
+    // the user row is locked so concurrent pins see each other
+    red := false
+    limit := cfg.conf.Chirps.MaxPins
+    n := int64(0)
+    err := cfg.withTx(r.Context(), func(q *database.Queries) error {
+        isRed, err := q.LockPinningUser(r.Context(), chp.UserID)
+        if err != nil {return err}
+        red = isRed.Bool
+        if red {limit = cfg.conf.Chirps.MaxPinsRed}
+
+        n, err = q.PinChirp(r.Context(), database.PinChirpParams{ChirpID: chp.ID, UserID: chp.UserID, MaxPins: int64(limit)})
+        return err
+    })
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with pinning chirp", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+    if n == 0 {
+        detail := fmt.Sprintf("you can pin at most %d chirps, unpin one first", limit)
+        if !red && cfg.conf.Chirps.MaxPinsRed > limit {
+            detail = fmt.Sprintf("you can pin at most %d chirps, %d with chirpy red", limit, cfg.conf.Chirps.MaxPinsRed)
+        }
+        slog.WarnContext(r.Context(), "error with pinning chirp: limit reached", "limit", limit)
+        problem.Write(w, r, problem.New(409, problem.Conflict, detail))
+        return
+    }
+
+    w.WriteHeader(204)
+}
+
+// handles -> delete /api/chirps/{chirpID}/pin
+func (cfg *apiConfig) handlerUnpin(w http.ResponseWriter, r *http.Request) {
+    chp, ok := cfg.authorChirp(w, r)
+    if !ok {return}
+
+    err := cfg.db.UnpinChirp(r.Context(), database.UnpinChirpParams{ChirpID: chp.ID, UserID: chp.UserID})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with unpinning chirp", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    w.WriteHeader(204)
+}
+
+// marks pinned chirps, with first they also move to the top in pin order
+// and the rest keeps its order
+func withPins(chirps []chirp_res, pinned []uuid.UUID, first bool) []chirp_res {
+    order := map[uuid.UUID]int{}
+    for i, id := range pinned {order[id] = i}
+
+    top := make([]chirp_res, len(pinned))
+    found := make([]bool, len(pinned))
+    rest := []chirp_res{}
+    for _, ch := range chirps {
+        i, ok := order[ch.Id]
+        ch.Pinned = ok
+        if ok && first {
+            top[i], found[i] = ch, true
+            continue
+        }
+        rest = append(rest, ch)
+    }
+
+    // pins of chirps the viewer can not see leave gaps
+    list := []chirp_res{}
+    for i, ch := range top {
+        if found[i] {list = append(list, ch)}
+    }
+    return append(list, rest...)
+}
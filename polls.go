@@ -0,0 +1,266 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "strings"
+    "time"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+    "github.com/sudonetizen/problem"
+    "github.com/sudonetizen/validate"
+)
+
+// job kind of the scheduled job notifying voters of closed polls
+const pollsCloseKind = "polls.close"
+
+const (
+    minPollOptions = 2
+    maxPollOptions = 4
+    maxPollOption  = 25
+    minPollMinutes = 5
+    maxPollMinutes = 7 * 24 * 60
+    // polls whose voters are notified per run of the job
+    pollsCloseBatch = 100
+)
+
+type pollReq struct {
+    Options          []string `json:"options"`
+    Duration_minutes int      `json:"duration_minutes"`
+}
+
+type voteReq struct {
+    Option int `json:"option"`
+}
+
+type poll_option_res struct {
+    Text  string `json:"text"`
+    Votes *int64 `json:"votes,omitempty"`
+}
+
+// poll state as one viewer sees it, votes are left out until the viewer
+// voted or the poll closed
+type poll_res struct {
+    Options      []poll_option_res `json:"options"`
+    Closes_at    time.Time         `json:"closes_at"`
+    Closed       bool              `json:"closed"`
+    Total_votes  *int64            `json:"total_votes,omitempty"`
+    Voted_option *int32            `json:"voted_option"`
+}
+
+func (p pollReq) validate(v *validate.Validator) {
+    if len(p.Options) < minPollOptions || len(p.Options) > maxPollOptions {
+        v.Add("poll.options", "out_of_range", fmt.Sprintf("between %d and %d options", minPollOptions, maxPollOptions))
+    }
+
+    seen := map[string]struct{}{}
+    for i, o := range p.Options {
+        v.Text(fmt.Sprintf("poll.options[%d]", i), o, 1, maxPollOption)
+
+        key := strings.ToLower(strings.TrimSpace(o))
+        if _, ok := seen[key]; ok {
+            v.Add(fmt.Sprintf("poll.options[%d]", i), "duplicate", "options must differ")
+        }
+        seen[key] = struct{}{}
+    }
+
+    if p.Duration_minutes < minPollMinutes || p.Duration_minutes > maxPollMinutes {
+        v.Add("poll.duration_minutes", "out_of_range", fmt.Sprintf("between %d and %d minutes", minPollMinutes, maxPollMinutes))
+    }
+}
+
+// fills in the polls of chirps as viewer sees them with two queries,
+// uuid.Nil sees no vote of its own
+func (cfg *apiConfig) withPolls(ctx context.Context, q *database.Queries, viewer uuid.UUID, chirps []chirp_res) error {
+    if len(chirps) == 0 {return nil}
+
+    ids := make([]uuid.UUID, 0, len(chirps))
+    for _, ch := range chirps {ids = append(ids, ch.Id)}
+
+    rows, err := q.GetPollOptions(ctx, ids)
+    if err != nil {return err}
+    if len(rows) == 0 {return nil}
+
+    voted := map[uuid.UUID]int32{}
+    if viewer != uuid.Nil {
+        votes, err := q.GetPollVotesBy(ctx, database.GetPollVotesByParams{Ids: ids, UserID: viewer})
+        if err != nil {return err}
+        for _, v := range votes {voted[v.ChirpID] = v.Position}
+    }
+
+    polls := map[uuid.UUID]*poll_res{}
+    totals := map[uuid.UUID]int64{}
+    for _, row := range rows {
+        p, ok := polls[row.ChirpID]
+        if !ok {
+            p = &poll_res{Options: []poll_option_res{}, Closes_at: row.ClosesAt, Closed: row.Closed}
+            if pos, ok := voted[row.ChirpID]; ok {p.Voted_option = &pos}
+            polls[row.ChirpID] = p
+        }
+
+        opt := poll_option_res{Text: row.Text}
+        if p.Closed || p.Voted_option != nil {
+            n := row.Votes
+            opt.Votes = &n
+        }
+        p.Options = append(p.Options, opt)
+        totals[row.ChirpID] += row.Votes
+    }
+
+    for id, p := range polls {
+        if p.Closed || p.Voted_option != nil {
+            n := totals[id]
+            p.Total_votes = &n
+        }
+    }
+    for i := range chirps {chirps[i].Poll = polls[chirps[i].Id]}
+
+    return nil
+}
+
+// fills in what depends on who looks, quoted chirps and poll results
+func (cfg *apiConfig) withViewer(ctx context.Context, viewer uuid.UUID, chirps []chirp_res) error {
+    err := cfg.withQuotes(ctx, viewer, chirps)
+    if err != nil {return err}
+    return cfg.withPolls(ctx, cfg.db, viewer, chirps)
+}
+
+// handles -> post /api/chirps/{chirpID}/vote, one vote per user that can
+// not be changed
+func (cfg *apiConfig) handlerVote(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    id, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+        problem.Write(w, r, problem.New(400, problem.InvalidID, "chirp id is invalid"))
+        return
+    }
+
+    req := voteReq{}
+    err = decodeJSON(r, &req)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with decoding", "error", err)
+        problem.Write(w, r, decodeProblem(err))
+        return
+    }
+
+    // only polls the caller can see take votes
+    list, ok := cfg.pollOf(w, r, id, userid)
+    if !ok {return}
+    poll := list[0].Poll
+
+    if poll.Voted_option != nil {
+        slog.WarnContext(r.Context(), "error with voting: already voted")
+        problem.Write(w, r, problem.New(409, problem.Conflict, "you already voted"))
+        return
+    }
+    if poll.Closed {
+        slog.WarnContext(r.Context(), "error with voting: poll closed")
+        problem.Write(w, r, problem.New(409, problem.Conflict, "poll is closed"))
+        return
+    }
+    if req.Option < 0 || req.Option >= len(poll.Options) {
+        slog.WarnContext(r.Context(), "error with validating vote", "option", req.Option)
+        problem.Write(w, r, problem.Validation(problem.FieldError{Field: "option", Code: "out_of_range", Message: fmt.Sprintf("between 0 and %d", len(poll.Options) - 1)}))
+        return
+    }
+
+    // closed or voted in between the two queries
+    n, err := cfg.db.CreateVote(r.Context(), database.CreateVoteParams{ChirpID: id, UserID: userid, Position: int32(req.Option)})
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with voting", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+    if n == 0 {
+        slog.WarnContext(r.Context(), "error with voting: closed or already voted")
+        problem.Write(w, r, problem.New(409, problem.Conflict, "poll is closed or you already voted"))
+        return
+    }
+
+    list, ok = cfg.pollOf(w, r, id, userid)
+    if !ok {return}
+    writeJSON(w, r, 200, list[0].Poll)
+}
+
+// loads a chirp with its poll as viewer sees it, a hidden chirp or one
+// without a poll is 404, on failure the problem is written and ok is false
+func (cfg *apiConfig) pollOf(w http.ResponseWriter, r *http.Request, id, viewer uuid.UUID) ([]chirp_res, bool) {
+    chp, err := cfg.db.GetChirpForViewer(r.Context(), database.GetChirpForViewerParams{ID: id, ViewerID: viewer})
+    list := []chirp_res{toChirpRes(chp)}
+    if err == nil {err = cfg.withPolls(r.Context(), cfg.db, viewer, list)}
+
+    if errors.Is(err, sql.ErrNoRows) || (err == nil && list[0].Poll == nil) {
+        slog.WarnContext(r.Context(), "error with getting poll: not found", "chirp_id", id)
+        problem.Write(w, r, problem.New(404, problem.NotFound, "poll does not exist"))
+        return nil, false
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting poll", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return nil, false
+    }
+
+    return list, true
+}
+
+// notifies the voters of polls that closed since the last run, each poll is
+// claimed and its notifications written in one transaction so a failing poll
+// is left for the next run while the rest of the batch goes on
+func (cfg *apiConfig) closePolls(ctx context.Context) error {
+    failed := []uuid.UUID{}
+    errs := []error{}
+
+    for range pollsCloseBatch {
+        claimed := false
+        id := uuid.Nil
+        rows := []database.Notification{}
+
+        err := cfg.withTx(ctx, func(q *database.Queries) error {
+            var err error
+            id, err = q.ClaimClosedPoll(ctx, failed)
+            if err != nil {return err}
+            claimed = true
+
+            chp, err := q.GetChirp(ctx, id)
+            if err != nil {return err}
+
+            voters, err := q.GetPollVoters(ctx, id)
+            if err != nil {return err}
+
+            for _, voter := range voters {
+                row, err := q.Notify(ctx, database.NotifyParams{UserID: voter, Kind: notifyPollClosed, TargetID: chp.ID, ActorID: chp.UserID})
+                // filtered out by preferences, blocks, mutes or visibility
+                if errors.Is(err, sql.ErrNoRows) {continue}
+                if err != nil {return err}
+                rows = append(rows, row)
+            }
+            return nil
+        })
+        // no closed poll left
+        if !claimed && errors.Is(err, sql.ErrNoRows) {break}
+        if err != nil {
+            slog.ErrorContext(ctx, "error with notifying closed poll", "chirp_id", id, "error", err)
+            if !claimed {return errors.Join(append(errs, err)...)}
+            failed = append(failed, id)
+            errs = append(errs, err)
+            continue
+        }
+
+        // pushing the committed notifications to open connections
+        list, err := toNotifications(ctx, cfg.db, rows)
+        if err != nil {
+            slog.ErrorContext(ctx, "error with loading notifications", "error", err)
+            continue
+        }
+        for i, n := range list {cfg.publishNotification(ctx, rows[i].UserID, n)}
+    }
+
+    return errors.Join(errs...)
+}
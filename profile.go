@@ -0,0 +1,238 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "math"
+    "net/http"
+    "strconv"
+    "time"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+    "github.com/sudonetizen/problem"
+    "github.com/sudonetizen/validate"
+)
+
+const (
+    maxDisplayName = 50
+    maxBio         = 160
+)
+
+// public profile, never carries the email
+type profile struct {
+    Id           uuid.UUID `json:"id"`
+    Username     string    `json:"username"`
+    Display_name string    `json:"display_name"`
+    Bio          string    `json:"bio"`
+    Avatar_url   string    `json:"avatar_url"`
+    Red          bool      `json:"is_chirpy_red"`
+    Private      bool      `json:"is_private"`
+    Created_at   time.Time `json:"created_at"`
+}
+
+type profileReq struct {
+    Display_name    string     `json:"display_name"`
+    Bio             string     `json:"bio"`
+    Avatar_url      string     `json:"avatar_url"`
+    Avatar_media_id *uuid.UUID `json:"avatar_media_id"`
+    Private         bool       `json:"is_private"`
+}
+
+type usernameReq struct {
+    Username string `json:"username"`
+}
+
+func (p profileReq) validate() error {
+    v := validate.Validator{}
+    v.Text("display_name", p.Display_name, 0, maxDisplayName)
+    v.Text("bio", p.Bio, 0, maxBio)
+    v.URL("avatar_url", p.Avatar_url)
+    return v.Err()
+}
+
+func toProfile(usr database.User) profile {
+    p := profile{
+        Id: usr.ID,
+        Username: usr.Username.String,
+        Display_name: usr.DisplayName,
+        Bio: usr.Bio,
+        Avatar_url: usr.AvatarUrl,
+        Red: usr.IsChirpyRed.Bool,
+        Private: usr.IsPrivate,
+        Created_at: usr.CreatedAt,
+    }
+
+    // an uploaded avatar wins over a linked one
+    if usr.AvatarMediaID.Valid {p.Avatar_url = mediaURL(usr.AvatarMediaID.UUID)}
+
+    return p
+}
+
+// writes v as json with code
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, v any) {
+    data, err := json.Marshal(v)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with marshalling response", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    w.Write(data)
+}
+
+// handles -> get /api/users/{username}
+func (cfg *apiConfig) handlerGetProfile(w http.ResponseWriter, r *http.Request) {
+    usr, err := cfg.db.GetUserByUsername(r.Context(), r.PathValue("username"))
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with getting user by username", "error", err)
+        problem.Write(w, r, problem.New(404, problem.NotFound, "user does not exist"))
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting user by username", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    writeJSON(w, r, 200, toProfile(usr))
+}
+
+// handles -> put /api/users/profile
+func (cfg *apiConfig) handlerUpdateProfile(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    // decoding and validating profile fields
+    req := profileReq{}
+    err := decodeJSON(r, &req)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with decoding", "error", err)
+        problem.Write(w, r, decodeProblem(err))
+        return
+    }
+
+    err = req.validate()
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with validating profile", "error", err)
+        problem.Write(w, r, validationProblem(err))
+        return
+    }
+
+    // an uploaded avatar must be the user's own
+    avatar := uuid.NullUUID{}
+    if req.Avatar_media_id != nil {
+        prob, err := cfg.checkOwnedMedia(r.Context(), userid, "avatar_media_id", []uuid.UUID{*req.Avatar_media_id}, 1)
+        if err != nil {
+            slog.ErrorContext(r.Context(), "error with checking media", "error", err)
+            problem.Write(w, r, problem.New(500, problem.Internal, ""))
+            return
+        }
+        if prob != nil {
+            slog.WarnContext(r.Context(), "error with validating avatar", "avatar_media_id", *req.Avatar_media_id)
+            problem.Write(w, r, prob)
+            return
+        }
+        avatar = uuid.NullUUID{UUID: *req.Avatar_media_id, Valid: true}
+    }
+
+    // replacing the profile, a public account has no reason to keep requests pending
+    usr := database.User{}
+    err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+        usr, err = q.UpdateProfile(r.Context(), database.UpdateProfileParams{ID: userid, DisplayName: req.Display_name, Bio: req.Bio, AvatarUrl: req.Avatar_url, AvatarMediaID: avatar, IsPrivate: req.Private})
+        if err != nil || usr.IsPrivate {return err}
+
+        return q.AcceptPendingFollows(r.Context(), userid)
+    })
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with updating profile: user not found")
+        problem.Write(w, r, problem.New(401, problem.InvalidToken, "user of the token does not exist"))
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with updating profile", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    writeJSON(w, r, 200, toProfile(usr))
+}
+
+// handles -> put /api/users/username
+func (cfg *apiConfig) handlerUpdateUsername(w http.ResponseWriter, r *http.Request) {
+    userid, ok := cfg.authUser(w, r)
+    if !ok {return}
+
+    // decoding and validating username
+    req := usernameReq{}
+    err := decodeJSON(r, &req)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with decoding", "error", err)
+        problem.Write(w, r, decodeProblem(err))
+        return
+    }
+
+    v := validate.Validator{}
+    req.Username = v.Username("username", req.Username)
+    err = v.Err()
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with validating username", "error", err)
+        problem.Write(w, r, validationProblem(err))
+        return
+    }
+
+    usr, err := cfg.db.GetUser(r.Context(), userid)
+    if errors.Is(err, sql.ErrNoRows) {
+        slog.WarnContext(r.Context(), "error with getting user: not found")
+        problem.Write(w, r, problem.New(401, problem.InvalidToken, "user of the token does not exist"))
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with getting user", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    // nothing to change, not counted against the limit
+    if usr.Username.String == req.Username {
+        writeJSON(w, r, 200, toProfile(usr))
+        return
+    }
+
+    // one change per cooldown, the first one is free
+    cooldown := cfg.conf.Users.UsernameCooldown
+    if usr.UsernameChangedAt.Valid {
+        wait := time.Until(usr.UsernameChangedAt.Time.Add(cooldown))
+        if wait > 0 {
+            slog.WarnContext(r.Context(), "error with changing username: too soon", "retry_after", wait)
+            w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+            problem.Write(w, r, problem.New(429, problem.RateLimited, fmt.Sprintf("username can change once every %s", cooldown)))
+            return
+        }
+    }
+
+    // the query checks the cooldown again so concurrent changes can not both win
+    n, err := cfg.db.UpdateUsername(r.Context(), database.UpdateUsernameParams{ID: userid, Username: sql.NullString{String: req.Username, Valid: true}, CooldownSeconds: cooldown.Seconds()})
+    if isUniqueViolation(err) {
+        slog.WarnContext(r.Context(), "error with changing username: taken")
+        problem.Write(w, r, problem.New(409, problem.Conflict, "username is already taken"))
+        return
+    }
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with changing username", "error", err)
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+    if n == 0 {
+        slog.WarnContext(r.Context(), "error with changing username: too soon")
+        problem.Write(w, r, problem.New(429, problem.RateLimited, fmt.Sprintf("username can change once every %s", cooldown)))
+        return
+    }
+
+    usr.Username = sql.NullString{String: req.Username, Valid: true}
+    writeJSON(w, r, 200, toProfile(usr))
+}
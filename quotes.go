@@ -0,0 +1,46 @@
+package main
+
+import (
+    "context"
+    "time"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/database"
+)
+
+// compact quoted chirp, only id and unavailable for a tombstone of a chirp
+// that was deleted or that the viewer can not see
+type quote_res struct {
+    Id          uuid.UUID  `json:"id"`
+    User_id     *uuid.UUID `json:"user_id,omitempty"`
+    Body        string     `json:"body,omitempty"`
+    Created_at  *time.Time `json:"created_at,omitempty"`
+    Unavailable bool       `json:"unavailable,omitempty"`
+}
+
+// fills in the quoted chirps as viewer sees them with one query
+func (cfg *apiConfig) withQuotes(ctx context.Context, viewer uuid.UUID, chirps []chirp_res) error {
+    ids := []uuid.UUID{}
+    for _, ch := range chirps {
+        if ch.Quote_of != nil {ids = append(ids, *ch.Quote_of)}
+    }
+    if len(ids) == 0 {return nil}
+
+    rows, err := cfg.db.GetQuotedChirps(ctx, database.GetQuotedChirpsParams{Ids: ids, ViewerID: viewer})
+    if err != nil {return err}
+
+    found := map[uuid.UUID]database.Chirp{}
+    for _, row := range rows {found[row.ID] = row}
+
+    for i, ch := range chirps {
+        if ch.Quote_of == nil {continue}
+
+        q, ok := found[*ch.Quote_of]
+        if !ok {
+            chirps[i].Quote = &quote_res{Id: *ch.Quote_of, Unavailable: true}
+            continue
+        }
+        chirps[i].Quote = &quote_res{Id: q.ID, User_id: &q.UserID, Body: q.Body, Created_at: &q.CreatedAt}
+    }
+
+    return nil
+}
@@ -0,0 +1,43 @@
+-- name: CreateBlock :exec
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteBlock :exec
+DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: GetBlocks :many
+SELECT users.id, users.username, blocks.created_at FROM blocks
+JOIN users ON users.id = blocks.blocked_id
+WHERE blocks.blocker_id = $1
+ORDER BY blocks.created_at DESC;
+
+-- name: IsBlocked :one
+-- true when either user blocked the other
+SELECT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocker_id = sqlc.arg(a) AND blocked_id = sqlc.arg(b))
+       OR (blocker_id = sqlc.arg(b) AND blocked_id = sqlc.arg(a))
+);
+
+-- name: CreateMute :exec
+INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteMute :exec
+DELETE FROM mutes WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: GetMutes :many
+SELECT users.id, users.username, mutes.created_at FROM mutes
+JOIN users ON users.id = mutes.muted_id
+WHERE mutes.muter_id = $1
+ORDER BY mutes.created_at DESC;
+
+-- name: GetHiddenAuthors :many
+-- users whose chirps the viewer does not see: muted ones and blocks in either direction
+SELECT muted_id AS user_id FROM mutes WHERE muter_id = sqlc.arg(viewer_id)
+UNION
+SELECT blocked_id FROM blocks WHERE blocker_id = sqlc.arg(viewer_id)
+UNION
+SELECT blocker_id FROM blocks WHERE blocked_id = sqlc.arg(viewer_id);
@@ -0,0 +1,38 @@
+-- name: CreateBookmark :exec
+INSERT INTO bookmarks (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: DeleteBookmark :exec
+DELETE FROM bookmarks WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: GetBookmarks :many
+-- one page, latest bookmark first, before_id is the last chirp of the previous
+-- page, chirps the user can no longer see are left out
+SELECT chirps.* FROM bookmarks
+JOIN chirps ON chirps.id = bookmarks.chirp_id
+JOIN users ON users.id = chirps.user_id
+WHERE bookmarks.user_id = sqlc.arg(user_id)
+AND (
+    sqlc.narg(before_id)::uuid IS NULL
+    OR (bookmarks.created_at, bookmarks.chirp_id) < (
+        SELECT b.created_at, b.chirp_id FROM bookmarks b
+        WHERE b.user_id = sqlc.arg(user_id) AND b.chirp_id = sqlc.narg(before_id)
+    )
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = sqlc.arg(user_id) AND blocks.blocked_id = chirps.user_id)
+       OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.arg(user_id))
+)
+AND (
+    NOT users.is_private
+    OR chirps.user_id = sqlc.arg(user_id)
+    OR EXISTS (
+        SELECT 1 FROM follows
+        WHERE follows.follower_id = sqlc.arg(user_id) AND follows.followee_id = chirps.user_id
+        AND follows.status = 'accepted'
+    )
+)
+ORDER BY bookmarks.created_at DESC, bookmarks.chirp_id DESC
+LIMIT sqlc.arg(max_rows);
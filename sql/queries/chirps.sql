@@ -1,6 +1,6 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, quote_of)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3)
 RETURNING *;
 
 -- name: GetChirps :many
@@ -11,3 +11,75 @@ SELECT * FROM chirps WHERE id = $1;
 
 -- name: DelChirp :exec
 DELETE FROM chirps WHERE id = $1;
+
+-- name: GetChirpsForViewer :many
+-- leaves out muted authors, authors blocked by or blocking the viewer and
+-- private authors the viewer does not follow
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.arg(viewer_id) AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = sqlc.arg(viewer_id) AND blocks.blocked_id = chirps.user_id)
+       OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND (
+    NOT users.is_private
+    OR chirps.user_id = sqlc.arg(viewer_id)
+    OR EXISTS (
+        SELECT 1 FROM follows
+        WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = chirps.user_id
+        AND follows.status = 'accepted'
+    )
+)
+ORDER BY chirps.created_at ASC;
+
+-- name: GetChirpForViewer :one
+-- a chirp is hidden when its author and the viewer blocked each other or
+-- the author is private and not followed by the viewer
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = sqlc.arg(id)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = sqlc.arg(viewer_id) AND blocks.blocked_id = chirps.user_id)
+       OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND (
+    NOT users.is_private
+    OR chirps.user_id = sqlc.arg(viewer_id)
+    OR EXISTS (
+        SELECT 1 FROM follows
+        WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = chirps.user_id
+        AND follows.status = 'accepted'
+    )
+);
+
+-- name: IncrementQuoteCount :exec
+UPDATE chirps SET quote_count = quote_count + 1 WHERE id = $1;
+
+-- name: DecrementQuoteCount :exec
+UPDATE chirps SET quote_count = GREATEST(quote_count - 1, 0) WHERE id = $1;
+
+-- name: GetQuotedChirps :many
+-- the quoted chirps the viewer can see, like GetChirpForViewer
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = ANY(sqlc.arg(ids)::uuid[])
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = sqlc.arg(viewer_id) AND blocks.blocked_id = chirps.user_id)
+       OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND (
+    NOT users.is_private
+    OR chirps.user_id = sqlc.arg(viewer_id)
+    OR EXISTS (
+        SELECT 1 FROM follows
+        WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = chirps.user_id
+        AND follows.status = 'accepted'
+    )
+);
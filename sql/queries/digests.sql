@@ -0,0 +1,51 @@
+-- name: TouchUserActive :exec
+UPDATE users SET last_active_at = NOW() WHERE id = $1;
+
+-- name: GetDueDigests :many
+-- users away for inactive_seconds whose last digest is a full period old
+SELECT id FROM users
+WHERE digest_frequency <> 'off'
+AND (last_active_at IS NULL OR last_active_at < NOW() - make_interval(secs => sqlc.arg(inactive_seconds)::float8))
+AND (
+    digest_sent_at IS NULL
+    OR digest_sent_at < NOW() - CASE digest_frequency WHEN 'daily' THEN INTERVAL '1 day' ELSE INTERVAL '7 days' END
+)
+ORDER BY digest_sent_at ASC NULLS FIRST
+LIMIT sqlc.arg(batch_size);
+
+-- name: GetDigestUser :one
+SELECT id, email, username, digest_frequency, digest_sent_at, last_active_at, unsubscribe_token
+FROM users WHERE id = $1;
+
+-- name: GetDigestActivity :many
+-- mentions of the recipient and new followers since a time, newest first,
+-- followers come from the follows themselves so an approved request to a
+-- private account counts from when it was accepted
+SELECT notifications.kind, notifications.actor_ids, notifications.updated_at, chirps.body AS chirp_body
+FROM notifications
+LEFT JOIN chirps ON chirps.id = notifications.target_id
+WHERE notifications.user_id = sqlc.arg(user_id)
+AND notifications.kind = 'mention'
+AND notifications.updated_at > sqlc.arg(since)
+UNION ALL
+SELECT 'follow', ARRAY[follows.follower_id]::uuid[], follows.updated_at, NULL::text
+FROM follows
+WHERE follows.followee_id = sqlc.arg(user_id) AND follows.status = 'accepted'
+AND follows.updated_at > sqlc.arg(since)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.arg(user_id) AND mutes.muted_id = follows.follower_id
+)
+ORDER BY updated_at DESC;
+
+-- name: MarkDigestSent :exec
+UPDATE users SET digest_sent_at = NOW() WHERE id = $1;
+
+-- name: SetDigestFrequency :one
+UPDATE users SET digest_frequency = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING digest_frequency;
+
+-- name: UnsubscribeDigest :execrows
+UPDATE users SET digest_frequency = 'off', updated_at = NOW()
+WHERE unsubscribe_token = $1;
@@ -0,0 +1,44 @@
+-- name: CreateFollow :one
+-- no row when the followee does not exist or either user blocked the other,
+-- following again keeps the current status, created is false then
+INSERT INTO follows (follower_id, followee_id, status, created_at, updated_at)
+SELECT sqlc.arg(follower_id), users.id,
+    CASE WHEN users.is_private THEN 'pending' ELSE 'accepted' END, NOW(), NOW()
+FROM users
+WHERE users.id = sqlc.arg(followee_id)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = sqlc.arg(follower_id) AND blocks.blocked_id = users.id)
+       OR (blocks.blocker_id = users.id AND blocks.blocked_id = sqlc.arg(follower_id))
+)
+ON CONFLICT (follower_id, followee_id) DO UPDATE SET updated_at = follows.updated_at
+RETURNING status, (xmax = 0)::boolean AS created;
+
+-- name: DeleteFollow :exec
+DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: DeleteFollowsBetween :exec
+DELETE FROM follows
+WHERE (follower_id = sqlc.arg(a) AND followee_id = sqlc.arg(b))
+   OR (follower_id = sqlc.arg(b) AND followee_id = sqlc.arg(a));
+
+-- name: GetFollowRequests :many
+SELECT users.id, users.username, follows.created_at FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = $1 AND follows.status = 'pending'
+ORDER BY follows.created_at ASC;
+
+-- name: AcceptFollow :execrows
+UPDATE follows SET status = 'accepted', updated_at = NOW()
+WHERE follower_id = $1 AND followee_id = $2 AND status = 'pending';
+
+-- name: DenyFollow :execrows
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2 AND status = 'pending';
+
+-- name: AcceptPendingFollows :exec
+UPDATE follows SET status = 'accepted', updated_at = NOW()
+WHERE followee_id = $1 AND status = 'pending';
+
+-- name: GetFolloweeIDs :many
+SELECT followee_id FROM follows WHERE follower_id = $1 AND status = 'accepted';
@@ -0,0 +1,69 @@
+-- name: EnqueueJob :one
+INSERT INTO jobs (id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at, unique_key)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, 'queued', 0, $3,
+    NOW() + make_interval(secs => sqlc.arg(delay_seconds)::float8), $4
+)
+ON CONFLICT (unique_key) DO NOTHING
+RETURNING *;
+
+-- name: ClaimJob :one
+UPDATE jobs
+SET status = 'running', attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+WHERE id = (
+    SELECT id FROM jobs
+    WHERE status = 'queued' AND run_at <= NOW() AND kind = ANY(sqlc.arg(kinds)::text[])
+    ORDER BY run_at ASC
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: HeartbeatJob :execrows
+-- keeps a running job from being requeued as stale, attempts identifies the
+-- claim, no row when the job was requeued or claimed again meanwhile
+UPDATE jobs
+SET locked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'running' AND attempts = $2;
+
+-- name: CompleteJob :execrows
+UPDATE jobs
+SET status = 'done', locked_at = NULL, updated_at = NOW()
+WHERE id = $1 AND status = 'running' AND attempts = $2;
+
+-- name: RetryJob :execrows
+UPDATE jobs
+SET status = 'queued', locked_at = NULL, updated_at = NOW(), last_error = $3,
+    run_at = NOW() + make_interval(secs => sqlc.arg(delay_seconds)::float8)
+WHERE id = $1 AND status = 'running' AND attempts = $2;
+
+-- name: KillJob :execrows
+UPDATE jobs
+SET status = 'dead', locked_at = NULL, updated_at = NOW(), last_error = $3
+WHERE id = $1 AND status = 'running' AND attempts = $2;
+
+-- name: RequeueStaleJobs :execrows
+UPDATE jobs
+SET status = 'queued', locked_at = NULL, updated_at = NOW()
+WHERE status = 'running'
+AND locked_at < NOW() - make_interval(secs => sqlc.arg(stale_seconds)::float8);
+
+-- name: GetJobStats :many
+SELECT kind, status, COUNT(*) AS total FROM jobs
+GROUP BY kind, status
+ORDER BY kind, status;
+
+-- name: GetFailedJobs :many
+SELECT * FROM jobs
+WHERE last_error IS NOT NULL
+ORDER BY updated_at DESC
+LIMIT $1;
+
+-- name: DeleteFinishedJobs :execrows
+DELETE FROM jobs
+WHERE id IN (
+    SELECT id FROM jobs
+    WHERE status IN ('done', 'dead')
+    AND updated_at < NOW() - make_interval(secs => sqlc.arg(retention_seconds)::float8)
+    LIMIT sqlc.arg(batch_size)
+);
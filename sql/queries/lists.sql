@@ -0,0 +1,86 @@
+-- name: CreateList :one
+INSERT INTO lists (id, owner_id, name, is_private, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW(), NOW())
+RETURNING *;
+
+-- name: GetList :one
+-- private lists are only found by their owner
+SELECT * FROM lists
+WHERE id = sqlc.arg(id)
+AND (NOT is_private OR owner_id = sqlc.arg(viewer_id));
+
+-- name: GetLists :many
+-- lists of an owner, private ones only for the owner
+SELECT * FROM lists
+WHERE owner_id = sqlc.arg(owner_id)
+AND (NOT is_private OR owner_id = sqlc.arg(viewer_id))
+ORDER BY created_at ASC, id ASC;
+
+-- name: UpdateList :one
+UPDATE lists SET name = $3, is_private = $4, updated_at = NOW()
+WHERE id = $1 AND owner_id = $2
+RETURNING *;
+
+-- name: DeleteList :execrows
+DELETE FROM lists WHERE id = $1 AND owner_id = $2;
+
+-- name: LockList :one
+-- taken before adding members so concurrent adds count one after another
+SELECT id FROM lists WHERE id = $1 AND owner_id = $2 FOR UPDATE;
+
+-- name: AddListMember :execrows
+-- no row when the list is not the owner's or has max_members other members,
+-- adding a member twice keeps the first time and still counts as a row, the
+-- count only holds under LockList
+INSERT INTO list_members (list_id, user_id, created_at)
+SELECT lists.id, sqlc.arg(user_id), NOW() FROM lists
+WHERE lists.id = sqlc.arg(list_id) AND lists.owner_id = sqlc.arg(owner_id)
+AND (
+    SELECT COUNT(*) FROM list_members
+    WHERE list_members.list_id = lists.id AND list_members.user_id <> sqlc.arg(user_id)
+) < sqlc.arg(max_members)::bigint
+ON CONFLICT (list_id, user_id) DO UPDATE SET created_at = list_members.created_at;
+
+-- name: RemoveListMember :execrows
+DELETE FROM list_members
+USING lists
+WHERE list_members.list_id = lists.id
+AND lists.id = sqlc.arg(list_id) AND lists.owner_id = sqlc.arg(owner_id)
+AND list_members.user_id = sqlc.arg(user_id);
+
+-- name: GetListMembers :many
+SELECT users.id, users.username, list_members.created_at FROM list_members
+JOIN users ON users.id = list_members.user_id
+WHERE list_members.list_id = $1
+ORDER BY list_members.created_at ASC, users.id ASC;
+
+-- name: GetListChirps :many
+-- one page of the members' chirps, newest first, before_id is the last chirp
+-- of the previous page, filtered for the viewer like the public feed
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+JOIN list_members ON list_members.user_id = chirps.user_id AND list_members.list_id = sqlc.arg(list_id)
+WHERE (
+    sqlc.narg(before_id)::uuid IS NULL
+    OR (chirps.created_at, chirps.id) < (SELECT c.created_at, c.id FROM chirps c WHERE c.id = sqlc.narg(before_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.arg(viewer_id) AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = sqlc.arg(viewer_id) AND blocks.blocked_id = chirps.user_id)
+       OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND (
+    NOT users.is_private
+    OR chirps.user_id = sqlc.arg(viewer_id)
+    OR EXISTS (
+        SELECT 1 FROM follows
+        WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = chirps.user_id
+        AND follows.status = 'accepted'
+    )
+)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(max_rows);
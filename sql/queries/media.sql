@@ -0,0 +1,22 @@
+-- name: CreateMedia :one
+INSERT INTO media (id, created_at, owner_id, content_type, size_bytes, width, height, storage_key, thumbnail_key, thumbnail_type)
+VALUES ($1, NOW(), $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING *;
+
+-- name: GetMedia :one
+SELECT * FROM media WHERE id = $1;
+
+-- name: CountOwnedMedia :one
+SELECT COUNT(*) FROM media
+WHERE id = ANY(sqlc.arg(ids)::uuid[]) AND owner_id = sqlc.arg(owner_id);
+
+-- name: AttachMedia :exec
+INSERT INTO chirp_media (chirp_id, media_id, position)
+VALUES ($1, $2, $3);
+
+-- name: GetChirpMedia :many
+SELECT chirp_media.chirp_id, media.id, media.content_type, media.width, media.height
+FROM chirp_media
+JOIN media ON media.id = chirp_media.media_id
+WHERE chirp_media.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_media.chirp_id, chirp_media.position;
@@ -0,0 +1,91 @@
+-- name: CreateConversation :one
+-- direct conversations pass the key of both users, there is no row when the
+-- two users already have one, groups pass null
+INSERT INTO conversations (id, created_at, updated_at, direct_key)
+VALUES (gen_random_uuid(), NOW(), NOW(), sqlc.narg(direct_key))
+ON CONFLICT (direct_key) DO NOTHING
+RETURNING *;
+
+-- name: AddConversationMember :exec
+INSERT INTO conversation_members (conversation_id, user_id, joined_at)
+VALUES ($1, $2, NOW());
+
+-- name: FindDirectConversation :one
+SELECT id FROM conversations WHERE direct_key = $1;
+
+-- name: CountUsers :one
+SELECT COUNT(*) FROM users WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: CountBlocksWith :one
+-- blocks between user_id and any of ids, in either direction
+SELECT COUNT(*) FROM blocks
+WHERE (blocker_id = sqlc.arg(user_id) AND blocked_id = ANY(sqlc.arg(ids)::uuid[]))
+   OR (blocked_id = sqlc.arg(user_id) AND blocker_id = ANY(sqlc.arg(ids)::uuid[]));
+
+-- name: GetConversations :many
+-- conversations of a user, latest activity first, with the user's unread count
+SELECT conversations.id, conversations.created_at, conversations.updated_at,
+    (SELECT COUNT(*) FROM messages
+     WHERE messages.conversation_id = conversations.id
+     AND messages.sender_id <> sqlc.arg(user_id)
+     AND (me.last_read_at IS NULL OR messages.created_at > me.last_read_at))::bigint AS unread
+FROM conversations
+JOIN conversation_members me ON me.conversation_id = conversations.id AND me.user_id = sqlc.arg(user_id)
+ORDER BY conversations.updated_at DESC;
+
+-- name: GetConversation :one
+SELECT conversations.id, conversations.created_at, conversations.updated_at,
+    (SELECT COUNT(*) FROM messages
+     WHERE messages.conversation_id = conversations.id
+     AND messages.sender_id <> sqlc.arg(user_id)
+     AND (me.last_read_at IS NULL OR messages.created_at > me.last_read_at))::bigint AS unread
+FROM conversations
+JOIN conversation_members me ON me.conversation_id = conversations.id AND me.user_id = sqlc.arg(user_id)
+WHERE conversations.id = sqlc.arg(id);
+
+-- name: GetConversationMembers :many
+SELECT conversation_members.conversation_id, users.id, users.username, conversation_members.last_read_at
+FROM conversation_members
+JOIN users ON users.id = conversation_members.user_id
+WHERE conversation_members.conversation_id = ANY(sqlc.arg(conversation_ids)::uuid[])
+ORDER BY conversation_members.joined_at ASC, users.id ASC;
+
+-- name: IsConversationMember :one
+SELECT EXISTS (
+    SELECT 1 FROM conversation_members WHERE conversation_id = $1 AND user_id = $2
+);
+
+-- name: CreateMessage :one
+-- no row unless the sender is a member with no block between them and
+-- another member
+INSERT INTO messages (id, conversation_id, sender_id, body, created_at)
+SELECT gen_random_uuid(), sqlc.arg(conversation_id), sqlc.arg(sender_id), sqlc.arg(body), NOW()
+WHERE EXISTS (
+    SELECT 1 FROM conversation_members
+    WHERE conversation_id = sqlc.arg(conversation_id) AND user_id = sqlc.arg(sender_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM conversation_members other
+    JOIN blocks ON (blocks.blocker_id = sqlc.arg(sender_id) AND blocks.blocked_id = other.user_id)
+                OR (blocks.blocker_id = other.user_id AND blocks.blocked_id = sqlc.arg(sender_id))
+    WHERE other.conversation_id = sqlc.arg(conversation_id)
+)
+RETURNING *;
+
+-- name: TouchConversation :exec
+UPDATE conversations SET updated_at = $2 WHERE id = $1;
+
+-- name: GetMessages :many
+-- one page, newest first, before_id is the oldest message of the previous page
+SELECT messages.* FROM messages
+WHERE messages.conversation_id = sqlc.arg(conversation_id)
+AND (
+    sqlc.narg(before_id)::uuid IS NULL
+    OR (messages.created_at, messages.id) < (SELECT m.created_at, m.id FROM messages m WHERE m.id = sqlc.narg(before_id))
+)
+ORDER BY messages.created_at DESC, messages.id DESC
+LIMIT sqlc.arg(max_rows);
+
+-- name: MarkConversationRead :exec
+UPDATE conversation_members SET last_read_at = NOW()
+WHERE conversation_id = $1 AND user_id = $2;
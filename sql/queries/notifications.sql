@@ -0,0 +1,81 @@
+-- name: Notify :one
+-- adds actor_id to the unread group or starts one, no row when the recipient
+-- is the actor, turned the kind off, blocked or muted the actor, was blocked
+-- by them, or can not see the target chirp
+INSERT INTO notifications (id, user_id, kind, target_id, actor_ids, created_at, updated_at)
+SELECT gen_random_uuid(), sqlc.arg(user_id), sqlc.arg(kind), sqlc.arg(target_id), ARRAY[sqlc.arg(actor_id)::uuid], NOW(), NOW()
+WHERE sqlc.arg(actor_id)::uuid <> sqlc.arg(user_id)
+AND NOT EXISTS (
+    SELECT 1 FROM notification_preferences
+    WHERE notification_preferences.user_id = sqlc.arg(user_id)
+    AND notification_preferences.kind = sqlc.arg(kind)
+    AND NOT notification_preferences.enabled
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = sqlc.arg(user_id) AND blocks.blocked_id = sqlc.arg(actor_id))
+       OR (blocks.blocker_id = sqlc.arg(actor_id) AND blocks.blocked_id = sqlc.arg(user_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.arg(user_id) AND mutes.muted_id = sqlc.arg(actor_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM chirps
+    JOIN users ON users.id = chirps.user_id
+    WHERE chirps.id = sqlc.arg(target_id)
+    AND users.is_private
+    AND chirps.user_id <> sqlc.arg(user_id)
+    AND NOT EXISTS (
+        SELECT 1 FROM follows
+        WHERE follows.follower_id = sqlc.arg(user_id) AND follows.followee_id = chirps.user_id
+        AND follows.status = 'accepted'
+    )
+)
+ON CONFLICT (user_id, kind, target_id) WHERE read_at IS NULL
+DO UPDATE SET
+    actor_ids = array_prepend(sqlc.arg(actor_id)::uuid, array_remove(notifications.actor_ids, sqlc.arg(actor_id)::uuid)),
+    updated_at = NOW()
+RETURNING *;
+
+-- name: GetNotifications :many
+-- one page, latest activity first, before_id is the last one of the previous page
+SELECT notifications.* FROM notifications
+WHERE notifications.user_id = sqlc.arg(user_id)
+AND (NOT sqlc.arg(unread_only)::bool OR notifications.read_at IS NULL)
+AND (
+    sqlc.narg(before_id)::uuid IS NULL
+    OR (notifications.updated_at, notifications.id) < (SELECT n.updated_at, n.id FROM notifications n WHERE n.id = sqlc.narg(before_id))
+)
+ORDER BY notifications.updated_at DESC, notifications.id DESC
+LIMIT sqlc.arg(max_rows);
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationRead :execrows
+UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+WHERE id = $1 AND user_id = $2;
+
+-- name: MarkAllNotificationsRead :exec
+UPDATE notifications SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: GetUsersByIDs :many
+SELECT id, username FROM users WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: GetUsersByUsernames :many
+-- usernames are matched ignoring case
+SELECT id, username FROM users WHERE lower(username) = ANY(sqlc.arg(usernames)::text[]);
+
+-- name: GetNotificationPreferences :many
+SELECT kind, enabled FROM notification_preferences WHERE user_id = $1;
+
+-- name: SetNotificationPreference :exec
+INSERT INTO notification_preferences (user_id, kind, enabled)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, kind) DO UPDATE SET enabled = EXCLUDED.enabled;
+
+-- name: DeleteTargetNotifications :exec
+-- targets are not foreign keys, a deleted chirp takes its notifications along
+DELETE FROM notifications WHERE target_id = $1;
@@ -0,0 +1,36 @@
+-- name: CreateOutboxEvent :one
+INSERT INTO outbox (created_at, topic, payload)
+VALUES (NOW(), $1, $2)
+RETURNING *;
+
+-- name: GetOutboxEvents :many
+-- events after the checkpoint in (xid, id) order, only from transactions
+-- older than every running one, so no event can later show up behind the
+-- checkpoint
+SELECT * FROM outbox
+WHERE (xid, id) > (sqlc.arg(after_xid)::bigint, sqlc.arg(after_id)::bigint)
+AND xid < pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+ORDER BY xid ASC, id ASC
+LIMIT sqlc.arg(max_events);
+
+-- name: GetOutboxCheckpoint :one
+SELECT last_xid, last_id FROM outbox_checkpoints WHERE sink = $1;
+
+-- name: SaveOutboxCheckpoint :exec
+INSERT INTO outbox_checkpoints (sink, updated_at, last_xid, last_id)
+VALUES ($1, NOW(), $2, $3)
+ON CONFLICT (sink) DO UPDATE
+SET updated_at = NOW(), last_xid = EXCLUDED.last_xid, last_id = EXCLUDED.last_id;
+
+-- name: DeleteRelayedOutboxEvents :execrows
+DELETE FROM outbox
+WHERE id IN (
+    SELECT id FROM outbox
+    WHERE NOT EXISTS (
+        SELECT 1 FROM unnest(sqlc.arg(sinks)::text[]) AS s(name)
+        LEFT JOIN outbox_checkpoints c ON c.sink = s.name
+        WHERE (outbox.xid, outbox.id) > (COALESCE(c.last_xid, 0), COALESCE(c.last_id, 0))
+    )
+    AND created_at < NOW() - make_interval(secs => sqlc.arg(retention_seconds)::float8)
+    LIMIT sqlc.arg(batch_size)
+);
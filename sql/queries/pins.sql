@@ -0,0 +1,24 @@
+-- name: LockPinningUser :one
+-- taken before pinning so concurrent pins of one user count one after another,
+-- no key update leaves inserts referencing the user alone
+SELECT is_chirpy_red FROM users WHERE id = $1 FOR NO KEY UPDATE;
+
+-- name: PinChirp :execrows
+-- no row when the chirp is not the user's or max_pins other chirps are
+-- pinned, pinning a chirp twice keeps the first time and still counts as a
+-- row, the count only holds under LockPinningUser
+INSERT INTO pins (chirp_id, user_id, created_at)
+SELECT chirps.id, chirps.user_id, NOW() FROM chirps
+WHERE chirps.id = sqlc.arg(chirp_id) AND chirps.user_id = sqlc.arg(user_id)
+AND (
+    SELECT COUNT(*) FROM pins
+    WHERE pins.user_id = sqlc.arg(user_id) AND pins.chirp_id <> sqlc.arg(chirp_id)
+) < sqlc.arg(max_pins)::bigint
+ON CONFLICT (chirp_id) DO UPDATE SET created_at = pins.created_at;
+
+-- name: UnpinChirp :exec
+DELETE FROM pins WHERE chirp_id = $1 AND user_id = $2;
+
+-- name: GetPinnedChirpIDs :many
+-- latest pin first
+SELECT chirp_id FROM pins WHERE user_id = $1 ORDER BY created_at DESC, chirp_id DESC;
@@ -0,0 +1,47 @@
+-- name: CreatePoll :exec
+INSERT INTO polls (chirp_id, closes_at, created_at)
+VALUES (sqlc.arg(chirp_id), NOW() + make_interval(mins => sqlc.arg(minutes)::int), NOW());
+
+-- name: CreatePollOption :exec
+INSERT INTO poll_options (chirp_id, position, text)
+VALUES ($1, $2, $3);
+
+-- name: GetPollOptions :many
+-- options of the polls of chirps with their vote counts, closed is decided by
+-- the database clock
+SELECT polls.chirp_id, polls.closes_at, (polls.closes_at <= NOW())::bool AS closed,
+    poll_options.position, poll_options.text, COUNT(poll_votes.user_id) AS votes
+FROM polls
+JOIN poll_options ON poll_options.chirp_id = polls.chirp_id
+LEFT JOIN poll_votes ON poll_votes.chirp_id = poll_options.chirp_id AND poll_votes.position = poll_options.position
+WHERE polls.chirp_id = ANY(sqlc.arg(ids)::uuid[])
+GROUP BY polls.chirp_id, polls.closes_at, poll_options.position, poll_options.text
+ORDER BY polls.chirp_id, poll_options.position;
+
+-- name: GetPollVotesBy :many
+SELECT chirp_id, position FROM poll_votes
+WHERE chirp_id = ANY(sqlc.arg(ids)::uuid[]) AND user_id = sqlc.arg(user_id);
+
+-- name: CreateVote :execrows
+-- no row when the poll closed or the user already voted
+INSERT INTO poll_votes (chirp_id, user_id, position, created_at)
+SELECT polls.chirp_id, sqlc.arg(user_id), sqlc.arg(position), NOW() FROM polls
+WHERE polls.chirp_id = sqlc.arg(chirp_id) AND polls.closes_at > NOW()
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+-- name: ClaimClosedPoll :one
+-- a closed poll whose voters were not notified yet, claimed so only one
+-- instance notifies, skip holds polls that failed earlier in the same run
+UPDATE polls SET closed_notified_at = NOW()
+WHERE chirp_id = (
+    SELECT p.chirp_id FROM polls p
+    WHERE p.closes_at <= NOW() AND p.closed_notified_at IS NULL
+    AND NOT (p.chirp_id = ANY(sqlc.arg(skip)::uuid[]))
+    ORDER BY p.closes_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING chirp_id;
+
+-- name: GetPollVoters :many
+SELECT user_id FROM poll_votes WHERE chirp_id = $1;
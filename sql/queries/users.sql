@@ -1,7 +1,7 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3)
+RETURNING id, created_at, updated_at, email, is_chirpy_red, username;
 
 -- name: DeleteUsers :exec
 DELETE FROM users;
@@ -10,14 +10,29 @@ DELETE FROM users;
 SELECT * FROM users WHERE id = $1;
 
 -- name: GetUserByEml :one
-SELECT * FROM users WHERE email = $1;
+SELECT * FROM users WHERE lower(email) = lower(sqlc.arg(email));
 
 -- name: UpdateUser :exec
 UPDATE users 
 SET updated_at = NOW(), email = $1, hashed_password = $2 
 WHERE id = $3;
 
--- name: UpdateRed :exec 
+-- name: UpdateRed :execrows
 UPDATE users
 SET is_chirpy_red = $1
 WHERE id = $2;
+
+-- name: GetUserByUsername :one
+SELECT * FROM users WHERE lower(username) = lower(sqlc.arg(username));
+
+-- name: UpdateProfile :one
+UPDATE users
+SET updated_at = NOW(), display_name = $2, bio = $3, avatar_url = $4, avatar_media_id = $5, is_private = $6
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUsername :execrows
+UPDATE users
+SET updated_at = NOW(), username = $2, username_changed_at = NOW()
+WHERE id = $1
+AND (username_changed_at IS NULL OR username_changed_at < NOW() - make_interval(secs => sqlc.arg(cooldown_seconds)::float8));
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    topic TEXT NOT NULL,
+    payload JSONB NOT NULL
+);
+
+CREATE TABLE outbox_checkpoints (
+    sink TEXT PRIMARY KEY,
+    updated_at TIMESTAMP NOT NULL,
+    last_id BIGINT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE outbox_checkpoints;
+DROP TABLE outbox;
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE jobs (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    run_at TIMESTAMP NOT NULL,
+    locked_at TIMESTAMP,
+    last_error TEXT,
+    unique_key TEXT UNIQUE
+);
+
+CREATE INDEX jobs_queued_run_at_idx ON jobs (run_at) WHERE status = 'queued';
+
+-- +goose Down
+DROP TABLE jobs;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- one row per burst: unread notifications of the same kind about the same
+-- target collect their actors instead of adding rows
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    -- the chirp for chirp kinds, the recipient for follow kinds
+    target_id UUID NOT NULL,
+    -- newest first, without repeats
+    actor_ids UUID[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    read_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX notifications_unread_group_idx ON notifications (user_id, kind, target_id) WHERE read_at IS NULL;
+CREATE INDEX notifications_user_id_updated_at_idx ON notifications (user_id, updated_at DESC, id DESC);
+
+-- a missing row means the kind is enabled
+CREATE TABLE notification_preferences (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, kind)
+);
+
+-- +goose Down
+DROP TABLE notification_preferences;
+DROP TABLE notifications;
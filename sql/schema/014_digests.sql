@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN last_active_at TIMESTAMP,
+ADD COLUMN digest_frequency TEXT NOT NULL DEFAULT 'weekly' CHECK (digest_frequency IN ('off', 'daily', 'weekly')),
+-- end of the last period a digest was considered for, sent or not
+ADD COLUMN digest_sent_at TIMESTAMP,
+-- one-click unsubscribe links carry it instead of a login
+ADD COLUMN unsubscribe_token TEXT NOT NULL DEFAULT replace(gen_random_uuid()::text || gen_random_uuid()::text, '-', '');
+
+CREATE UNIQUE INDEX users_unsubscribe_token_idx ON users (unsubscribe_token);
+
+-- +goose Down
+DROP INDEX users_unsubscribe_token_idx;
+
+ALTER TABLE users
+DROP COLUMN last_active_at,
+DROP COLUMN digest_frequency,
+DROP COLUMN digest_sent_at,
+DROP COLUMN unsubscribe_token;
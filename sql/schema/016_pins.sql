@@ -0,0 +1,12 @@
+-- +goose Up
+-- chirps their author pinned to the top of their profile
+CREATE TABLE pins (
+    chirp_id UUID PRIMARY KEY REFERENCES chirps(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX pins_user_id_idx ON pins (user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE pins;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- not a foreign key, a quote outlives its original and shows a tombstone
+ALTER TABLE chirps
+ADD COLUMN quote_of UUID,
+ADD COLUMN quote_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX chirps_quote_of_idx ON chirps (quote_of) WHERE quote_of IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirps_quote_of_idx;
+
+ALTER TABLE chirps
+DROP COLUMN quote_of,
+DROP COLUMN quote_count;
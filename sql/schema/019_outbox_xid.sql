@@ -0,0 +1,16 @@
+-- +goose Up
+-- relaying by id alone skips a row whose transaction commits after a later
+-- id was already relayed, rows are relayed in (xid, id) order instead and
+-- only once every transaction up to their xid has finished. Existing rows
+-- keep xid 0 so they stay ordered by id behind the checkpoints
+ALTER TABLE outbox ADD COLUMN xid BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE outbox ALTER COLUMN xid SET DEFAULT pg_current_xact_id()::text::bigint;
+
+CREATE INDEX outbox_xid_id_idx ON outbox (xid, id);
+
+ALTER TABLE outbox_checkpoints ADD COLUMN last_xid BIGINT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE outbox_checkpoints DROP COLUMN last_xid;
+DROP INDEX outbox_xid_id_idx;
+ALTER TABLE outbox DROP COLUMN xid;
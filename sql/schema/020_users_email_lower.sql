@@ -0,0 +1,10 @@
+-- +goose Up
+-- emails are compared case-insensitively, older rows may still have upper
+-- case letters or spaces. Two accounts that only differ in case make this
+-- migration fail and have to be merged by hand first
+UPDATE users SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+
+CREATE UNIQUE INDEX users_email_lower_idx ON users (lower(email));
+
+-- +goose Down
+DROP INDEX users_email_lower_idx;
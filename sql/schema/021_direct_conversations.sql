@@ -0,0 +1,25 @@
+-- +goose Up
+-- two users share one direct conversation, the key is both user ids in order
+-- so concurrent requests can not create a second one. Of existing duplicates
+-- only the oldest gets the key
+ALTER TABLE conversations ADD COLUMN direct_key TEXT;
+
+UPDATE conversations SET direct_key = pairs.direct_key
+FROM (
+    SELECT DISTINCT ON (p.direct_key) p.conversation_id, p.direct_key
+    FROM (
+        SELECT conversation_id, min(user_id::text COLLATE "C") || ':' || max(user_id::text COLLATE "C") AS direct_key
+        FROM conversation_members
+        GROUP BY conversation_id
+        HAVING COUNT(*) = 2
+    ) p
+    JOIN conversations c ON c.id = p.conversation_id
+    ORDER BY p.direct_key, c.created_at ASC
+) pairs
+WHERE conversations.id = pairs.conversation_id;
+
+CREATE UNIQUE INDEX conversations_direct_key_idx ON conversations (direct_key);
+
+-- +goose Down
+DROP INDEX conversations_direct_key_idx;
+ALTER TABLE conversations DROP COLUMN direct_key;
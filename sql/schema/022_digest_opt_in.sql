@@ -0,0 +1,8 @@
+-- +goose Up
+-- digests are opt-in, users on the old weekly default are switched off,
+-- those who picked weekly themselves can not be told apart and opt in again
+ALTER TABLE users ALTER COLUMN digest_frequency SET DEFAULT 'off';
+UPDATE users SET digest_frequency = 'off' WHERE digest_frequency = 'weekly';
+
+-- +goose Down
+ALTER TABLE users ALTER COLUMN digest_frequency SET DEFAULT 'weekly';
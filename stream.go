@@ -0,0 +1,210 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "strconv"
+    "time"
+    "github.com/google/uuid"
+    "github.com/sudonetizen/outbox"
+    "github.com/sudonetizen/problem"
+    "github.com/sudonetizen/stream"
+)
+
+// feeds streaming clients from the outbox bus until ctx is cancelled, the
+// relay hands over events in commit order so resuming by id misses nothing
+func (cfg *apiConfig) relayChirps(ctx context.Context, events <-chan outbox.Event) {
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case ev := <-events:
+            var err error
+            switch ev.Topic {
+            case outbox.TopicChirpCreated:
+                err = cfg.publishChirp(ctx, ev)
+            case outbox.TopicChirpDeleted:
+                err = cfg.publishChirpDeleted(ctx, ev)
+            }
+            if err != nil {slog.ErrorContext(ctx, "error with publishing chirp event", "event_id", ev.ID, "error", err)}
+        }
+    }
+}
+
+// streams are public, private chirps are only read through the api
+func (cfg *apiConfig) publishChirp(ctx context.Context, ev outbox.Event) error {
+    ch := chirp_res{}
+    err := json.Unmarshal(ev.Payload, &ch)
+    if err != nil {return err}
+
+    // the author may be gone by the time the event is relayed
+    author, err := cfg.db.GetUser(ctx, ch.User_id)
+    if errors.Is(err, sql.ErrNoRows) {return nil}
+    if err != nil {return err}
+    if author.IsPrivate {return nil}
+
+    return cfg.stream.Publish(ctx, stream.Event{ID: ev.ID, Type: ev.Topic, Author: ch.User_id, Body: ch.Body, Data: ev.Payload})
+}
+
+// authors whose events the viewer must not get, muted ones and blocks in either direction
+func (cfg *apiConfig) hiddenAuthors(ctx context.Context, viewer uuid.UUID) (map[uuid.UUID]bool, error) {
+    ids, err := cfg.db.GetHiddenAuthors(ctx, viewer)
+    if err != nil {return nil, err}
+
+    hidden := map[uuid.UUID]bool{}
+    for _, id := range ids {hidden[id] = true}
+    return hidden, nil
+}
+
+// the viewer and the users they follow, taken when the stream starts
+func (cfg *apiConfig) timelineAuthors(ctx context.Context, viewer uuid.UUID) (map[uuid.UUID]bool, error) {
+    ids, err := cfg.db.GetFolloweeIDs(ctx, viewer)
+    if err != nil {return nil, err}
+
+    authors := map[uuid.UUID]bool{viewer: true}
+    for _, id := range ids {authors[id] = true}
+    return authors, nil
+}
+
+// deleted chirps reach streaming clients without their text, a private
+// author's chirp must not leak, the body stays on the event for tag filters
+type chirp_deleted struct {
+    Id      uuid.UUID `json:"id"`
+    User_id uuid.UUID `json:"user_id"`
+}
+
+func (cfg *apiConfig) publishChirpDeleted(ctx context.Context, ev outbox.Event) error {
+    ch := chirp_res{}
+    err := json.Unmarshal(ev.Payload, &ch)
+    if err != nil {return err}
+
+    data, err := json.Marshal(chirp_deleted{Id: ch.Id, User_id: ch.User_id})
+    if err != nil {return err}
+
+    return cfg.stream.Publish(ctx, stream.Event{ID: ev.ID, Type: ev.Topic, Author: ch.User_id, Body: ch.Body, Data: data})
+}
+
+// handles -> get /api/stream/chirps
+func (cfg *apiConfig) handlerStreamChirps(w http.ResponseWriter, r *http.Request) {
+    // getting filters
+    filter := stream.Filter{Tag: r.URL.Query().Get("tag")}
+    qVal := r.URL.Query().Get("author_id")
+    tVal := r.URL.Query().Get("timeline")
+
+    timeline := false
+    if tVal != "" {
+        t, err := strconv.ParseBool(tVal)
+        if err != nil {
+            slog.WarnContext(r.Context(), "error with parsing timeline", "error", err)
+            problem.Write(w, r, problem.New(400, problem.InvalidQuery, "timeline is not a boolean"))
+            return
+        }
+
+        timeline = t
+    }
+
+    // the timeline needs a user, other streams hide muted and blocked authors when there is one
+    viewer, ok := cfg.viewer(w, r)
+    if !ok {return}
+    if timeline && viewer == uuid.Nil {
+        problem.Write(w, r, problem.New(401, problem.MissingToken, "bearer token is required for the timeline"))
+        return
+    }
+
+    if viewer != uuid.Nil {
+        hidden, err := cfg.hiddenAuthors(r.Context(), viewer)
+        if err != nil {
+            slog.ErrorContext(r.Context(), "error with getting hidden authors", "error", err)
+            problem.Write(w, r, problem.New(500, problem.Internal, ""))
+            return
+        }
+
+        filter.Hidden = hidden
+    }
+
+    if timeline {
+        authors, err := cfg.timelineAuthors(r.Context(), viewer)
+        if err != nil {
+            slog.ErrorContext(r.Context(), "error with getting followees", "error", err)
+            problem.Write(w, r, problem.New(500, problem.Internal, ""))
+            return
+        }
+
+        filter.Authors = authors
+    }
+
+    if qVal != "" {
+        aid, err := uuid.Parse(qVal)
+        if err != nil {
+            slog.WarnContext(r.Context(), "error with parsing uuid", "error", err)
+            problem.Write(w, r, problem.New(400, problem.InvalidQuery, "author_id is not a valid id"))
+            return
+        }
+
+        filter.Author = aid
+    }
+
+    // getting last seen event for resuming
+    lastID := int64(0)
+    lVal := r.Header.Get("Last-Event-ID")
+    if lVal == "" {lVal = r.URL.Query().Get("last_event_id")}
+
+    if lVal != "" {
+        id, err := strconv.ParseInt(lVal, 10, 64)
+        if err != nil {
+            slog.WarnContext(r.Context(), "error with parsing last event id", "error", err)
+            problem.Write(w, r, problem.New(400, problem.InvalidQuery, "last event id is not a number"))
+            return
+        }
+
+        lastID = id
+    }
+
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        slog.ErrorContext(r.Context(), "error with streaming: response writer can not flush")
+        problem.Write(w, r, problem.New(500, problem.Internal, ""))
+        return
+    }
+
+    // streams outlive the server's write timeout
+    err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+    if err != nil {slog.WarnContext(r.Context(), "error with clearing write deadline", "error", err)}
+
+    // subscribing
+    client := cfg.stream.Subscribe(filter, lastID)
+    defer client.Close()
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    w.WriteHeader(200)
+    flusher.Flush()
+
+    // sending events and a heartbeat so proxies keep the connection open
+    heartbeat := time.NewTicker(15 * time.Second)
+    defer heartbeat.Stop()
+
+    for {
+        select {
+        case <-r.Context().Done():
+            return
+        case <-heartbeat.C:
+            fmt.Fprint(w, ": ping\n\n")
+        case ev, ok := <-client.Events():
+            // closed when the client was too slow or the server is stopping
+            if !ok {return}
+            // live only events have no id, a client resuming after one must
+            // keep the last id it got
+            if ev.Resumable() {fmt.Fprintf(w, "id: %d\n", ev.ID)}
+            fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, ev.Data)
+        }
+
+        flusher.Flush()
+    }
+}
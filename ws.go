@@ -0,0 +1,287 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "log/slog"
+    "net/http"
+    "sync"
+    "time"
+    "github.com/google/uuid"
+    "github.com/gorilla/websocket"
+    "github.com/sudonetizen/auth"
+    "github.com/sudonetizen/logging"
+    "github.com/sudonetizen/problem"
+    "github.com/sudonetizen/stream"
+)
+
+// websocket topics a client can subscribe to
+const (
+    wsTopicChirps        = "chirps"
+    wsTopicNotifications = "notifications"
+    wsTopicMessages      = "messages"
+)
+
+const (
+    wsWriteWait  = 10 * time.Second
+    wsPongWait   = 60 * time.Second
+    wsPingPeriod = 30 * time.Second
+    wsSendBuffer = 64
+)
+
+// one json frame in either direction
+type wsMessage struct {
+    Type     string          `json:"type"`
+    Topic    string          `json:"topic,omitempty"`
+    AuthorID string          `json:"author_id,omitempty"`
+    Tag      string          `json:"tag,omitempty"`
+    Token    string          `json:"token,omitempty"`
+    Id       int64           `json:"id,omitempty"`
+    Event    string          `json:"event,omitempty"`
+    Data     json.RawMessage `json:"data,omitempty"`
+    Error    string          `json:"error,omitempty"`
+}
+
+var wsUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// one open websocket
+type wsConn struct {
+    cfg    *apiConfig
+    conn   *websocket.Conn
+    userID uuid.UUID
+    send   chan wsMessage
+    reauth chan time.Time
+    ctx    context.Context
+    cancel context.CancelFunc
+    mu     sync.Mutex
+    subs   map[string]*stream.Client
+}
+
+// handles -> get /api/ws
+func (cfg *apiConfig) handlerWS(w http.ResponseWriter, r *http.Request) {
+    // getting token, browsers can not set headers on websockets so a query works too
+    tkn := r.URL.Query().Get("token")
+    if tkn == "" {
+        t, err := auth.GetBearerToken(r.Header)
+        if err != nil {
+            slog.WarnContext(r.Context(), "error with getting token", "error", err)
+            problem.Write(w, r, problem.New(401, problem.MissingToken, "token query parameter or bearer token is required"))
+            return
+        }
+        tkn = t
+    }
+
+    // validating JWT
+    userid, expires, err := auth.ValidateJWTExpiry(tkn, cfg.tks)
+    if err != nil {
+        slog.WarnContext(r.Context(), "error with validating jwt", "error", err)
+        problem.Write(w, r, problem.New(401, problem.InvalidToken, "token is invalid or expired"))
+        return
+    }
+    logging.SetUser(r.Context(), userid.String())
+
+    // the connection outlives the server's timeouts, the loops set their own deadlines
+    rc := http.NewResponseController(w)
+    err = rc.SetReadDeadline(time.Time{})
+    if err == nil {err = rc.SetWriteDeadline(time.Time{})}
+    if err != nil {slog.WarnContext(r.Context(), "error with clearing deadlines", "error", err)}
+
+    // upgrading, the upgrader writes the error response itself
+    conn, err := wsUpgrader.Upgrade(w, r, nil)
+    if err != nil {
+        slog.ErrorContext(r.Context(), "error with upgrading websocket", "error", err)
+        return
+    }
+
+    // keeps the request's log fields but not its cancellation
+    ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+    c := &wsConn{
+        cfg: cfg,
+        conn: conn,
+        userID: userid,
+        send: make(chan wsMessage, wsSendBuffer),
+        reauth: make(chan time.Time, 1),
+        ctx: ctx,
+        cancel: cancel,
+        subs: map[string]*stream.Client{},
+    }
+
+    // closing the connection when the server shuts down
+    stop := context.AfterFunc(cfg.streamCtx, c.close)
+    defer stop()
+
+    go c.writeLoop(expires)
+    c.readLoop()
+}
+
+// reads commands until the connection fails or is closed
+func (c *wsConn) readLoop() {
+    defer c.close()
+
+    c.conn.SetReadLimit(4096)
+    c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+    c.conn.SetPongHandler(func(string) error {
+        return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+    })
+
+    for {
+        msg := wsMessage{}
+        err := c.conn.ReadJSON(&msg)
+        if err != nil {
+            if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+                slog.WarnContext(c.ctx, "error with reading websocket", "error", err)
+            }
+            return
+        }
+
+        switch msg.Type {
+        case "ping":
+            c.push(wsMessage{Type: "pong"})
+        case "subscribe":
+            c.subscribe(msg)
+        case "unsubscribe":
+            c.unsubscribe(msg.Topic)
+        case "auth":
+            c.refresh(msg.Token)
+        default:
+            c.push(wsMessage{Type: "error", Error: "unknown message type"})
+        }
+    }
+}
+
+// writes queued frames, pings the client and closes the connection once the token expired
+func (c *wsConn) writeLoop(expires time.Time) {
+    defer c.close()
+
+    ping := time.NewTicker(wsPingPeriod)
+    defer ping.Stop()
+
+    // tokens without expiry never time out, the timer only runs for tokens with one
+    expiry := time.NewTimer(time.Hour)
+    expiry.Stop()
+    if !expires.IsZero() {expiry.Reset(time.Until(expires))}
+    defer expiry.Stop()
+
+    for {
+        select {
+        case <-c.ctx.Done():
+            c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(wsWriteWait))
+            return
+        case exp := <-c.reauth:
+            expiry.Stop()
+            if !exp.IsZero() {expiry.Reset(time.Until(exp))}
+        case <-expiry.C:
+            c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "token expired"), time.Now().Add(wsWriteWait))
+            return
+        case <-ping.C:
+            err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+            if err != nil {return}
+        case msg := <-c.send:
+            c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+            err := c.conn.WriteJSON(msg)
+            if err != nil {return}
+        }
+    }
+}
+
+// queues a frame, a client that can not keep up is disconnected so it never
+// stalls the broadcaster or other clients
+func (c *wsConn) push(msg wsMessage) bool {
+    select {
+    case c.send <- msg:
+        return true
+    case <-c.ctx.Done():
+        return false
+    default:
+        slog.WarnContext(c.ctx, "dropping slow websocket client")
+        c.close()
+        return false
+    }
+}
+
+func (c *wsConn) subscribe(msg wsMessage) {
+    filter := stream.Filter{}
+
+    switch msg.Topic {
+    case wsTopicChirps:
+        filter.Tag = msg.Tag
+        if msg.AuthorID != "" {
+            aid, err := uuid.Parse(msg.AuthorID)
+            if err != nil {
+                c.push(wsMessage{Type: "error", Topic: msg.Topic, Error: "author_id is invalid"})
+                return
+            }
+            filter.Author = aid
+        }
+
+        // same muted and blocked authors as the chirp lists
+        hidden, err := c.cfg.hiddenAuthors(c.ctx, c.userID)
+        if err != nil {
+            slog.ErrorContext(c.ctx, "error with getting hidden authors", "error", err)
+            c.push(wsMessage{Type: "error", Topic: msg.Topic, Error: "internal error"})
+            return
+        }
+        filter.Hidden = hidden
+    case wsTopicNotifications:
+        filter.Recipient = c.userID
+        filter.Kind = "notification."
+    case wsTopicMessages:
+        filter.Recipient = c.userID
+        filter.Kind = "message."
+    default:
+        c.push(wsMessage{Type: "error", Topic: msg.Topic, Error: "unknown topic"})
+        return
+    }
+
+    // a new subscribe replaces the filter of an existing one
+    c.unsubscribe(msg.Topic)
+
+    client := c.cfg.stream.Subscribe(filter, msg.Id)
+    c.mu.Lock()
+    c.subs[msg.Topic] = client
+    c.mu.Unlock()
+
+    go func() {
+        for ev := range client.Events() {
+            if !c.push(wsMessage{Type: "event", Topic: msg.Topic, Id: ev.ID, Event: ev.Type, Data: ev.Data}) {return}
+        }
+    }()
+
+    c.push(wsMessage{Type: "subscribed", Topic: msg.Topic})
+}
+
+func (c *wsConn) unsubscribe(topic string) {
+    c.mu.Lock()
+    client, ok := c.subs[topic]
+    delete(c.subs, topic)
+    c.mu.Unlock()
+
+    if ok {client.Close()}
+}
+
+// accepts a fresh access token so the connection outlives the first one
+func (c *wsConn) refresh(tkn string) {
+    userid, expires, err := auth.ValidateJWTExpiry(tkn, c.cfg.tks)
+    if err != nil || userid != c.userID {
+        c.push(wsMessage{Type: "error", Error: "invalid token"})
+        return
+    }
+
+    select {
+    case c.reauth <- expires:
+    default:
+    }
+    c.push(wsMessage{Type: "authenticated"})
+}
+
+func (c *wsConn) close() {
+    c.cancel()
+
+    c.mu.Lock()
+    subs := c.subs
+    c.subs = map[string]*stream.Client{}
+    c.mu.Unlock()
+
+    for _, client := range subs {client.Close()}
+    c.conn.Close()
+}